@@ -1,11 +1,19 @@
 package main
 
-import "ecom/internal/inittiallize"
+import (
+	"os"
+
+	"ecom/internal/inittiallize"
+)
 
 // @securityDefinitions.apiKey bearerToken
 // @in header
 // @name Authorization
 // @description Enter the token with the `Bearer ` prefix, e.g. "Bearer abcde12345"
 func main() {
+	// "server queues ..." administers the queues instead of serving, see inittiallize.RunQueueCommand
+	if len(os.Args) > 1 && os.Args[1] == "queues" {
+		os.Exit(inittiallize.RunQueueCommand(os.Args[2:]))
+	}
 	inittiallize.Run()
 }
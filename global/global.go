@@ -4,8 +4,10 @@ import (
 	"database/sql"
 	"ecom/pkg/logger"
 	"ecom/pkg/rabbitmq"
+	"ecom/pkg/ratelimit"
 	"ecom/pkg/security"
 	"ecom/pkg/setting"
+	"ecom/pkg/token"
 
 	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
@@ -21,5 +23,7 @@ var (
 	ServerSetting   *setting.ServerSetting
 	SecuritySetting *setting.SecuritySetting
 	SecurityService *security.SecurityService
-	RabbitMQManager *rabbitmq.QueueManager
+	RabbitMQManager rabbitmq.Broker
+	Authenticator   token.Authenticator
+	RateLimiter     ratelimit.Limiter
 )
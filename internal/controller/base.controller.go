@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"ecom/global"
+	"ecom/internal/middlewares"
+	"ecom/internal/service"
+	"ecom/internal/vo"
+	"ecom/pkg/response"
+	"ecom/pkg/webhook"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"go.uber.org/zap"
+)
+
+// bindEncryptedRequest reads the vo.EncryptedRequest envelope from the body, decrypts and verifies it
+// with the configured keys, then decodes and validates the payload into obj.
+func bindEncryptedRequest(c *gin.Context, obj interface{}) error {
+	var encryptedRequest vo.EncryptedRequest
+	if err := c.ShouldBindJSON(&encryptedRequest); err != nil {
+		return err
+	}
+
+	senderPubKey := global.Config.Security.CryptoKeys.Asymmetric.SenderPubKey
+	recipientAESKey := global.Config.Security.CryptoKeys.Symmetric.AESKey
+	decryptedData, err := global.SecurityService.DecryptAndVerifyEd25519(encryptedRequest.Data, recipientAESKey, senderPubKey)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(decryptedData, obj); err != nil {
+		return err
+	}
+	return binding.Validator.ValidateStruct(obj)
+}
+
+// authorizeProject checks that the caller belongs to the project with slug. A denied request is
+// aborted with a 403 AppError and false is returned, the handler stops there.
+func authorizeProject(c *gin.Context, projectService service.IProjectService, slug string) bool {
+	claims, _ := middlewares.ClaimsOf(c)
+	err := projectService.AuthorizeProject(c.Request.Context(), slug, claims)
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, service.ErrProjectAccessDenied) {
+		c.Error(response.ErrForbidden.WithMessage(err.Error()).Wrap(err))
+		c.Abort()
+		return false
+	}
+	c.Error(fmt.Errorf("authorize project %s: %w", slug, err))
+	c.Abort()
+	return false
+}
+
+// transactionErrorResponse reports the error of a deposit or withdrawal to ErrorHandlerMiddleware, the
+// rejections of the request keep their message and any other error is an internal one
+func transactionErrorResponse(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrDuplicateTransaction):
+		c.Error(response.ErrConflict.WithMessage(err.Error()).Wrap(err))
+	case errors.Is(err, service.ErrWalletIntegrationNotFound), errors.Is(err, service.ErrRateNotFound):
+		c.Error(response.ErrNotFound.WithMessage(err.Error()).Wrap(err))
+	case errors.Is(err, service.ErrInvalidAmount),
+		errors.Is(err, service.ErrAmountPrecision),
+		errors.Is(err, service.ErrAmountBelowMinDeposit),
+		errors.Is(err, service.ErrCurrencyNotSupported),
+		errors.Is(err, service.ErrAmountBelowMinWithdrawn),
+		errors.Is(err, service.ErrAmountAboveMaxWithdrawn),
+		errors.Is(err, service.ErrAmountNotCoverFee),
+		errors.Is(err, service.ErrInsufficientBalance):
+		c.Error(response.ErrBadRequest.WithMessage(err.Error()).Wrap(err))
+	default:
+		c.Error(err)
+	}
+}
+
+// notifyWebhook sends the encrypted result of a transaction to the caller's webhook in the background
+func notifyWebhook(webhookUrl string, status string, dataRequest webhook.DataRequest, dataResponse interface{}) {
+	if webhookUrl == "" {
+		return
+	}
+	go func() {
+		recipientAESKey := global.Config.Security.CryptoKeys.Symmetric.AESKey
+		err := webhook.CallWebhookWithEncryption(webhookUrl, webhook.WebhookData{
+			Status:       status,
+			DataRequest:  dataRequest,
+			DataResponse: dataResponse,
+		}, recipientAESKey, global.SecurityService)
+		if err != nil {
+			global.Logger.Error("Call webhook failed", zap.String("url", webhookUrl), zap.String("transactionCode", dataRequest.TransactionCode), zap.Error(err))
+		}
+	}()
+}
+
+// operatorOf names the caller of an admin endpoint for the audit log, the subject of the token. It is
+// empty without one and the queue service refuses the call with ErrMissingOperator.
+func operatorOf(c *gin.Context) string {
+	claims, ok := middlewares.ClaimsOf(c)
+	if !ok {
+		return ""
+	}
+	return claims.Subject
+}
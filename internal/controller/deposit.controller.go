@@ -3,18 +3,20 @@ package controller
 import (
 	"ecom/internal/service"
 	"ecom/internal/vo"
+	consts "ecom/pkg/const"
 	"ecom/pkg/response"
-	"fmt"
+	"ecom/pkg/webhook"
 
 	"github.com/gin-gonic/gin"
 )
 
 type DepositController struct {
 	depositService service.IDepositService
+	projectService service.IProjectService
 }
 
-func NewDepositController(depositService service.IDepositService) *DepositController {
-	return &DepositController{depositService: depositService}
+func NewDepositController(depositService service.IDepositService, projectService service.IProjectService) *DepositController {
+	return &DepositController{depositService: depositService, projectService: projectService}
 }
 
 // PingExample godoc
@@ -25,97 +27,48 @@ func NewDepositController(depositService service.IDepositService) *DepositContro
 // @Accept json
 // @Produce json
 // @Success 200 {object} response.ResponseData
+// @Failure 403 {object} response.ResponseData
 // @Router /deposit [post]
 // @Param data body vo.EncryptedRequest true "data"
 // @SecurityScheme bearerAuth
 // @Security bearerToken
 // @BearerFormat JWT
-// func (dc *DepositController) Deposit(c *gin.Context) {
-// 	// get from body
-
-// 	var encryptedRequest vo.EncryptedRequest
-// 	err := c.ShouldBindJSON(&encryptedRequest)
-// 	if err != nil {
-// 		response.ErrorResponse(c, response.BadRequest, err.Error())
-// 		return
-// 	}
-
-// 	// // Decrypt data
-// 	var depositRequest vo.DepositRequest
-// 	senderPubKey := global.Config.Security.CryptoKeys.Asymmetric.SenderPubKey
-// 	recipientAESKey := global.Config.Security.CryptoKeys.Symmetric.AESKey
-
-// 	decryptedData, err := global.SecurityService.DecryptAndVerifyEd25519(encryptedRequest.Data, recipientAESKey, senderPubKey)
-
-// 	if err != nil {
-// 		// call webhook
-// 		go webhook.CallWebhookWithRetry(depositRequest.WebhookUrl, webhook.WebhookData{
-// 			Status: consts.TransactionStatusFailed,
-// 			DataRequest: webhook.DataRequest{
-// 				TransactionCode: depositRequest.TransactionCode,
-// 				UserID:          depositRequest.UserID,
-// 			},
-// 			DataResponse: nil,
-// 		}, recipientAESKey, global.SecurityService)
-// 		response.ErrorResponse(c, response.BadRequest, err.Error())
-// 		return
-// 	}
-// 	fmt.Println("decryptedData", string(decryptedData))
-// 	err = json.Unmarshal(decryptedData, &depositRequest)
-// 	fmt.Println("depositRequest", depositRequest)
-// 	if err != nil {
-// 		// call webhook
-// 		go webhook.CallWebhookWithRetry(depositRequest.WebhookUrl, webhook.WebhookData{
-// 			Status: consts.TransactionStatusFailed,
-// 			DataRequest: webhook.DataRequest{
-// 				TransactionCode: depositRequest.TransactionCode,
-// 				UserID:          depositRequest.UserID,
-// 			},
-// 			DataResponse: err.Error(),
-// 		}, recipientAESKey, global.SecurityService)
-// 		response.ErrorResponse(c, response.BadRequest, err.Error())
-// 		return
-// 	}
+func (dc *DepositController) Deposit(c *gin.Context) {
+	var depositRequest vo.DepositRequest
+	err := bindEncryptedRequest(c, &depositRequest)
+	if err != nil {
+		c.Error(response.ErrBadRequest.WithMessage(err.Error()).Wrap(err))
+		return
+	}
+	if !authorizeProject(c, dc.projectService, depositRequest.Platform) {
+		return
+	}
 
-// 	result, err := dc.depositService.Deposit(depositRequest.UserID, depositRequest.Currency, depositRequest.Amount, depositRequest.RateUsd, depositRequest.ProviderKey, depositRequest.Platform, depositRequest.WebhookUrl, depositRequest.TransactionCode, depositRequest.RateCurrency)
-// 	if err != nil {
-// 		// call webhook
-// 		go webhook.CallWebhookWithRetry(depositRequest.WebhookUrl, webhook.WebhookData{
-// 			Status: consts.TransactionStatusFailed,
-// 			DataRequest: webhook.DataRequest{
-// 				TransactionCode: depositRequest.TransactionCode,
-// 				UserID:          depositRequest.UserID,
-// 			},
-// 			DataResponse: err.Error(),
-// 		}, recipientAESKey, global.SecurityService)
-// 		response.ErrorResponse(c, response.BadRequest, err.Error())
-// 		return
-// 	}
-// 	go webhook.CallWebhookWithRetry(depositRequest.WebhookUrl, webhook.WebhookData{
-// 		Status: consts.TransactionStatusSuccess,
-// 		DataRequest: webhook.DataRequest{
-// 			TransactionCode: depositRequest.TransactionCode,
-// 			UserID:          depositRequest.UserID,
-// 		},
-// 		DataResponse: result,
-// 	}, recipientAESKey, global.SecurityService)
-// 	response.SuccessResponse(c, response.Success, gin.H{"message": "Deposit successful", "result": result})
-// }
+	dataRequest := webhook.DataRequest{
+		TransactionCode: depositRequest.TransactionCode,
+		UserID:          depositRequest.UserID,
+	}
+	result, err := dc.depositService.Deposit(c.Request.Context(), &depositRequest)
+	if err != nil {
+		notifyWebhook(depositRequest.WebhookUrl, consts.TransactionStatusFailed, dataRequest, err.Error())
+		transactionErrorResponse(c, err)
+		return
+	}
+	notifyWebhook(depositRequest.WebhookUrl, consts.TransactionStatusSuccess, dataRequest, result)
+	response.SuccessResponse(c, response.Success, gin.H{"message": "Deposit successful", "result": result})
+}
 
 func (dc *DepositController) Test(c *gin.Context) {
-	// get from body
-	// Add more logging here to debug
-	fmt.Println("Test--------------------------------")
 	var data vo.TestMQRequest
 	err := c.ShouldBindJSON(&data)
 	if err != nil {
-		response.ErrorResponse(c, response.BadRequest, err.Error())
+		c.Error(response.ErrBadRequest.WithMessage(err.Error()).Wrap(err))
 		return
 	}
 
 	result, err := dc.depositService.Test(data.UserID, data.Email, data.MessageID, data.RoutingKey, data.HashKey)
 	if err != nil {
-		response.ErrorResponse(c, response.BadRequest, err.Error())
+		c.Error(err)
 		return
 	}
 
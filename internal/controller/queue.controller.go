@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"errors"
+	"io"
+	"strconv"
+
+	"ecom/internal/service"
+	"ecom/internal/vo"
+	"ecom/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+type QueueController struct {
+	queueService service.IQueueService
+}
+
+func NewQueueController(queueService service.IQueueService) *QueueController {
+	return &QueueController{queueService: queueService}
+}
+
+// PingExample godoc
+// @Summary List queues
+// @Schemes http
+// @Description Declared queues with their depth, consumers and dead letters
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} response.ResponseData
+// @Router /admin/queues [get]
+// @Security bearerToken
+func (qc *QueueController) ListQueues(c *gin.Context) {
+	queues, err := qc.queueService.ListQueues(c.Request.Context(), operatorOf(c))
+	if err != nil {
+		queueErrorResponse(c, err)
+		return
+	}
+	response.SuccessResponse(c, response.Success, queues)
+}
+
+// PingExample godoc
+// @Summary Peek dead letters
+// @Schemes http
+// @Description Oldest messages of the dead letter queue of a queue, they stay queued
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} response.ResponseData
+// @Router /admin/queues/{name}/dlq [get]
+// @Param name path string true "queue name"
+// @Param limit query int false "number of messages, 20 by default"
+// @Security bearerToken
+func (qc *QueueController) PeekDeadLetters(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	letters, err := qc.queueService.PeekDeadLetters(c.Request.Context(), operatorOf(c), c.Param("name"), limit)
+	if err != nil {
+		queueErrorResponse(c, err)
+		return
+	}
+	response.SuccessResponse(c, response.Success, letters)
+}
+
+// PingExample godoc
+// @Summary Replay dead letters
+// @Schemes http
+// @Description Publish dead letters back to their original exchange, the ones of messageIds or all of them with "all": true
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Success 200 {object} response.ResponseData
+// @Router /admin/queues/{name}/dlq/replay [post]
+// @Param name path string true "queue name"
+// @Param data body vo.DeadLetterSelectionRequest true "message ids or all"
+// @Security bearerToken
+func (qc *QueueController) ReplayDeadLetters(c *gin.Context) {
+	var selection vo.DeadLetterSelectionRequest
+	if err := bindSelection(c, &selection); err != nil {
+		c.Error(response.ErrBadRequest.WithMessage(err.Error()).Wrap(err))
+		return
+	}
+	replayed, err := qc.queueService.ReplayDeadLetters(c.Request.Context(), operatorOf(c), c.Param("name"), selection.MessageIDs)
+	if err != nil {
+		queueErrorResponse(c, err)
+		return
+	}
+	response.SuccessResponse(c, response.Success, gin.H{"replayed": replayed})
+}
+
+// PingExample godoc
+// @Summary Purge dead letters
+// @Schemes http
+// @Description Drop dead letters, the ones of messageIds or all of them with "all": true
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Success 200 {object} response.ResponseData
+// @Router /admin/queues/{name}/dlq/purge [post]
+// @Param name path string true "queue name"
+// @Param data body vo.DeadLetterSelectionRequest true "message ids or all"
+// @Security bearerToken
+func (qc *QueueController) PurgeDeadLetters(c *gin.Context) {
+	var selection vo.DeadLetterSelectionRequest
+	if err := bindSelection(c, &selection); err != nil {
+		c.Error(response.ErrBadRequest.WithMessage(err.Error()).Wrap(err))
+		return
+	}
+	purged, err := qc.queueService.PurgeDeadLetters(c.Request.Context(), operatorOf(c), c.Param("name"), selection.MessageIDs)
+	if err != nil {
+		queueErrorResponse(c, err)
+		return
+	}
+	response.SuccessResponse(c, response.Success, gin.H{"purged": purged})
+}
+
+var errNoSelection = errors.New(`select the dead letters with messageIds or "all": true`)
+
+// bindSelection reads the selection of dead letters, a missing body or selection is refused so a request
+// never acts on the whole dead letter queue by mistake. The message ids of "all" are cleared, the queue
+// service selects every dead letter without ids.
+func bindSelection(c *gin.Context, selection *vo.DeadLetterSelectionRequest) error {
+	if err := c.ShouldBindJSON(selection); err != nil {
+		if errors.Is(err, io.EOF) {
+			return errNoSelection
+		}
+		return err
+	}
+	if selection.All == (len(selection.MessageIDs) > 0) {
+		return errNoSelection
+	}
+	if selection.All {
+		selection.MessageIDs = nil
+	}
+	return nil
+}
+
+// queueErrorResponse reports err to ErrorHandlerMiddleware, the errors the operator can act on keep
+// their message
+func queueErrorResponse(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrMissingOperator):
+		c.Error(response.ErrUnauthorized.WithMessage(err.Error()).Wrap(err))
+	case errors.Is(err, service.ErrQueueNotFound):
+		c.Error(response.ErrNotFound.WithMessage(err.Error()).Wrap(err))
+	default:
+		c.Error(err)
+	}
+}
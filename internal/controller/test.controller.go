@@ -6,10 +6,9 @@ import (
 	"ecom/internal/database"
 	"ecom/internal/messaging"
 	"ecom/internal/service"
+	"ecom/pkg/rabbitmq"
 	"ecom/pkg/response"
-	"encoding/json"
-	"fmt"
-	"net/http"
+	"errors"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -17,28 +16,33 @@ import (
 
 type TestController struct {
 	testService service.ITestService
+	sequencer   *messaging.Sequencer
 }
 
-func NewTestController(testService service.ITestService) *TestController {
+func NewTestController(testService service.ITestService, sequencer *messaging.Sequencer) *TestController {
 	return &TestController{
 		testService: testService,
+		sequencer:   sequencer,
 	}
 }
 
 func (c *TestController) GetTestById(ctx *gin.Context) {
 	id := ctx.Param("id")
-	fmt.Println("id", id)
 	idUUID, err := uuid.Parse(id)
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		ctx.Error(response.ErrBadRequest.WithMessage("Invalid ID").Wrap(err))
 		return
 	}
 	test, err := c.testService.GetTestById(idUUID)
+	if errors.Is(err, sql.ErrNoRows) {
+		ctx.Error(response.ErrNotFound.WithMessage("Test not found").Wrap(err))
+		return
+	}
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get test"})
+		ctx.Error(response.ErrInternal.WithMessage("Failed to get test").Wrap(err))
 		return
 	}
-	response.SuccessResponse(ctx, 200, test)
+	response.SuccessResponse(ctx, response.Success, test)
 }
 
 // test update
@@ -62,16 +66,18 @@ func (c *TestController) UpdateTest(ctx *gin.Context) {
 		},
 	}
 	for _, message := range messagesUpdate {
-		go func() {
-			// params := message.Data.(database.UpdateTestParams)
-			// c.testService.UpdateTest(&params)
-			messageJson, err := json.Marshal(message)
-			if err != nil {
-				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to marshal message"})
-				return
-			}
-			global.RabbitMQManager.PublishToExchange(global.Config.Exchange.Test, "82f048f3-e760-44ca-b5f8-067238a52ef6", string(messageJson))
-		}()
+		// params := message.Data.(database.UpdateTestParams)
+		// c.testService.UpdateTest(&params)
+		message.Key = "82f048f3-e760-44ca-b5f8-067238a52ef6"
+		if err := c.sequencer.Stamp(ctx, &message); err != nil {
+			ctx.Error(response.ErrInternal.WithMessage("Failed to sequence message").Wrap(err))
+			return
+		}
+		err := messaging.PublishMessage(ctx.Request.Context(), global.Config.Exchange.Test, message, rabbitmq.Envelope{})
+		if err != nil {
+			ctx.Error(response.ErrInternal.WithMessage("Failed to publish message").Wrap(err))
+			return
+		}
 	}
-	ctx.JSON(http.StatusOK, gin.H{"message": "Update test"})
+	response.SuccessResponse(ctx, response.Success, gin.H{"message": "Update test"})
 }
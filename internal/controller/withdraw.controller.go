@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"ecom/internal/messaging"
+	"ecom/internal/service"
+	"ecom/internal/vo"
+	consts "ecom/pkg/const"
+	"ecom/pkg/response"
+	"ecom/pkg/webhook"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WithdrawController struct {
+	withdrawSaga   *messaging.WithdrawSaga
+	projectService service.IProjectService
+}
+
+func NewWithdrawController(withdrawSaga *messaging.WithdrawSaga, projectService service.IProjectService) *WithdrawController {
+	return &WithdrawController{withdrawSaga: withdrawSaga, projectService: projectService}
+}
+
+// PingExample godoc
+// @Summary Withdraw
+// @Schemes http
+// @Description Withdraw
+// @Tags Withdraw
+// @Accept json
+// @Produce json
+// @Success 200 {object} response.ResponseData
+// @Failure 403 {object} response.ResponseData
+// @Router /withdraw [post]
+// @Param data body vo.EncryptedRequest true "data"
+// @SecurityScheme bearerAuth
+// @Security bearerToken
+// @BearerFormat JWT
+func (wc *WithdrawController) Withdraw(c *gin.Context) {
+	var withdrawRequest vo.WithdrawRequest
+	err := bindEncryptedRequest(c, &withdrawRequest)
+	if err != nil {
+		c.Error(response.ErrBadRequest.WithMessage(err.Error()).Wrap(err))
+		return
+	}
+	if !authorizeProject(c, wc.projectService, withdrawRequest.Platform) {
+		return
+	}
+
+	dataRequest := webhook.DataRequest{
+		TransactionCode: withdrawRequest.TransactionCode,
+		UserID:          withdrawRequest.UserID,
+	}
+	// the withdrawal is pending until its saga completes, the saga notifies the webhook of the outcome
+	result, err := wc.withdrawSaga.Withdraw(c.Request.Context(), &withdrawRequest)
+	if err != nil {
+		notifyWebhook(withdrawRequest.WebhookUrl, consts.TransactionStatusFailed, dataRequest, err.Error())
+		transactionErrorResponse(c, err)
+		return
+	}
+	response.SuccessResponse(c, response.Success, gin.H{"message": "Withdraw pending", "result": result})
+}
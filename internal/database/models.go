@@ -6,6 +6,8 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -16,6 +18,20 @@ type Balance struct {
 	Balance int32
 }
 
+type OutboxEvent struct {
+	ID          uuid.UUID
+	Exchange    string
+	RoutingKey  string
+	MessageID   string
+	Payload     json.RawMessage
+	Status      string
+	Attempts    int32
+	LastError   sql.NullString
+	AvailableAt time.Time
+	CreatedAt   time.Time
+	SentAt      sql.NullTime
+}
+
 type Test struct {
 	ID      uuid.UUID
 	Name    string
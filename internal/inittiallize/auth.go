@@ -0,0 +1,19 @@
+package inittiallize
+
+import (
+	"ecom/global"
+	"ecom/internal/repo"
+	"ecom/pkg/token"
+
+	"go.uber.org/zap"
+)
+
+// initAuth sets the authenticator of AuthMiddleware, after Redis which caches introspected tokens
+func initAuth() {
+	authenticator, err := token.NewAuthenticator(global.Config.TokenValidation, repo.NewTokenRepository())
+	if err != nil {
+		global.Logger.Error("Failed to initialize token validation", zap.Error(err))
+		panic(err)
+	}
+	global.Authenticator = authenticator
+}
@@ -1,79 +1,79 @@
 package inittiallize
 
-// func TakeInterest(key string) {
-// 	walletRepo := repo.NewWalletRepository()
-// 	if walletRepo == nil {
-// 		global.Logger.Error("Failed to initialize WalletRepository")
-// 		return
-// 	}
-// 	userRepo := repo.NewUserRepository()
-// 	if userRepo == nil {
-// 		global.Logger.Error("Failed to initialize UserRepository")
-// 		return
-// 	}
-// 	transactionRepo := repo.NewTransactionRepository()
-// 	if transactionRepo == nil {
-// 		global.Logger.Error("Failed to initialize TransactionRepository")
-// 		return
-// 	}
-// 	// walletService := service.NewWalletService(walletRepo, userRepo, transactionRepo)
-// 	// all users
-// 	users, err := userRepo.GetAllUsers()
-// 	if err != nil {
-// 		global.Logger.Error("Failed to get all users", zap.Error(err))
-// 		return
-// 	}
-// 	for _, user := range users {
-// 		//send message queue
+import (
+	"context"
+	"ecom/global"
+	"ecom/internal/messaging"
+	"ecom/internal/repo"
+	"ecom/internal/vo"
+	consts "ecom/pkg/const"
+	"ecom/pkg/rabbitmq"
 
-// 		data := map[string]interface{}{
-// 			"userId":      user.ID,
-// 			"providerKey": key,
-// 			"type":        consts.TransactionTypeTakeInterest,
-// 		}
-// 		fmt.Println("data", data)
+	"github.com/robfig/cron/v3"
+	"go.uber.org/zap"
+)
 
-// 		_, err = messaging.PublishMessage(context.Background(), data, messaging.PublishOptions{
-// 			Exchange:     consts.HashedExchangeName,
-// 			RoutingKey:   string(messaging.EventTransaction),
-// 			HashKey:      user.ID,
-// 			WaitResponse: false,
-// 		})
-// 		if err != nil {
-// 			global.Logger.Error("Failed to publish message", zap.Error(err))
-// 		}
-// 		// walletService.TakeInterest(user.ID)
-// 	}
-// }
+// TakeInterest fans out one take-interest message per user of the provider through the interest
+// exchange, hashed by user so the messages of one user always land on the same queue.
+func TakeInterest(key string) {
+	walletRepo := repo.NewWalletRepository()
+	userIDs, err := walletRepo.GetUserIDsByProviderKey(key)
+	if err != nil {
+		global.Logger.Error("Failed to get users of provider", zap.String("providerKey", key), zap.Error(err))
+		return
+	}
+	global.Logger.Info("TakeInterest", zap.String("providerKey", key), zap.Int("users", len(userIDs)))
 
+	sequencer := messaging.NewSequencer(repo.NewMessageRepository())
+	for _, userID := range userIDs {
+		body := messaging.BodyMessage{
+			Action: consts.TransactionTypeTakeInterest,
+			UserID: userID,
+			Data:   vo.TakeInterestMessage{ProviderKey: key},
+		}
+		if err := sequencer.Stamp(context.Background(), &body); err != nil {
+			global.Logger.Error("Failed to sequence message", zap.String("userId", userID), zap.Error(err))
+			continue
+		}
+		err = messaging.PublishMessage(context.Background(), messaging.InterestExchange(), body, rabbitmq.Envelope{})
+		if err != nil {
+			global.Logger.Error("Failed to publish message", zap.String("userId", userID), zap.Error(err))
+		}
+	}
+}
+
+// InitCronJob schedules the take-interest job of every active wallet integration with auto take profit
+// on the integration's own cron expression, falling back to cronjob.cron_execute_interest.
 func InitCronJob() {
-	// c := cron.New()
-	// if global.Config.Cronjob.CronExecuteInterest == "" {
-	// 	global.Logger.Error("CronjobSetting is not initialized")
-	// 	return
-	// }
-	// walletIntegrationRepo := repo.NewWalletIntegrationRepository()
-	// if walletIntegrationRepo == nil {
-	// 	global.Logger.Error("Failed to initialize WalletIntegrationRepository")
-	// 	return
-	// }
-	// walletIntegrations, err := walletIntegrationRepo.GetAllWalletIntegration()
-	// if err != nil {
-	// 	global.Logger.Error("Failed to get all wallet integrations", zap.Error(err))
-	// 	return
-	// }
-	// for _, walletIntegration := range walletIntegrations {
-	// 	if walletIntegration.IsAutoTakeProfit {
-	// 		global.Logger.Info("InitCronJob", zap.String("key", walletIntegration.Cronjob))
-	// 		_, err = c.AddFunc(walletIntegration.Cronjob, func() {
-	// 			TakeInterest(walletIntegration.Key)
-	// 		})
-	// 		if err != nil {
-	// 			global.Logger.Error("InitCronJob", zap.Error(err))
-	// 		}
-	// 	}
-	// }
+	c := cron.New()
+	walletIntegrationRepo := repo.NewWalletIntegrationRepository()
+	walletIntegrations, err := walletIntegrationRepo.GetAllWalletIntegration()
+	if err != nil {
+		global.Logger.Error("Failed to get all wallet integrations", zap.Error(err))
+		return
+	}
+	for _, walletIntegration := range walletIntegrations {
+		if !walletIntegration.IsAutoTakeProfit {
+			continue
+		}
+		spec := walletIntegration.Cronjob
+		if spec == "" {
+			spec = global.Config.Cronjob.CronExecuteInterest
+		}
+		if spec == "" {
+			global.Logger.Warn("InitCronJob: no cron expression", zap.String("key", walletIntegration.Key))
+			continue
+		}
+		key := walletIntegration.Key
+		_, err = c.AddFunc(spec, func() {
+			TakeInterest(key)
+		})
+		if err != nil {
+			global.Logger.Error("InitCronJob", zap.String("key", key), zap.String("cronjob", spec), zap.Error(err))
+			continue
+		}
+		global.Logger.Info("InitCronJob", zap.String("key", key), zap.String("cronjob", spec))
+	}
 
-	// c.Start()
-	// fmt.Println("CronJob started")
+	c.Start()
 }
@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"time"
 
+	"go.uber.org/zap"
 	"gorm.io/driver/postgres"
 	"gorm.io/gen"
 	"gorm.io/gorm"
@@ -33,7 +34,8 @@ func SetPoolDbSetting() {
 	p := global.Config.PostgresSetting
 	pql, err := global.PdbSetting.DB()
 	if err != nil {
-		fmt.Println("get pql error", err)
+		global.Logger.Error("Failed to get the sql.DB of gorm", zap.Error(err))
+		return
 	}
 	pql.SetConnMaxIdleTime(time.Duration(p.MaxIdleConns))
 	pql.SetMaxOpenConns(p.MaxOpenConns)
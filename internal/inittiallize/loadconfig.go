@@ -11,7 +11,6 @@ import (
 
 func LoadConfig() {
 	environment := os.Getenv("APP_ENV")
-	fmt.Println("environment", environment)
 	if environment == "" {
 		environment = "local"
 	}
@@ -33,7 +32,7 @@ func LoadConfig() {
 
 	// config
 	if err := viper.Unmarshal(&global.Config); err != nil {
-		fmt.Println("error unmarshal config", err)
+		panic(fmt.Errorf("fatal error unmarshal config: %w", err))
 	}
 
 	// for _, database := range global.Config.Databases {
@@ -3,8 +3,12 @@ package inittiallize
 import (
 	"ecom/global"
 	"ecom/pkg/logger"
+
+	"go.uber.org/zap"
 )
 
 func initLogger() {
 	global.Logger = logger.NewLogger(global.Config.Logger)
+	// the packages that cannot import global log through zap.L(), see logger.FromContext
+	zap.ReplaceGlobals(global.Logger.Logger)
 }
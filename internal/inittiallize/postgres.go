@@ -41,7 +41,8 @@ func SetPool() {
 	p := global.Config.Postgres
 	pql, err := global.Pdb.DB()
 	if err != nil {
-		fmt.Println("get pql error", err)
+		global.Logger.Error("Failed to get the sql.DB of gorm", zap.Error(err))
+		return
 	}
 	pql.SetConnMaxIdleTime(time.Duration(p.MaxIdleConns))
 	pql.SetMaxOpenConns(p.MaxOpenConns)
@@ -55,9 +56,13 @@ func genTableDAO() {
 	})
 
 	g.UseDB(global.Pdb) // reuse your gorm db
+	// money columns are generated as money.Amount so they are never handled as float64,
+	// the transaction details as raw JSON
+	g.WithImportPkgPath("ecom/pkg/money")
 	// g.GenerateModel("users")
-	// g.GenerateModel("wallet")
-	g.GenerateModel("transactions")
+	g.GenerateModel("wallet", gen.FieldType("balance", "money.Amount"), gen.FieldType("amount_interest", "money.Amount"))
+	g.GenerateModel("transactions", gen.FieldType("amount", "money.Amount"), gen.FieldType("details", "json.RawMessage"))
+	// g.GenerateModel("outbox_events", gen.FieldType("sent_at", "*time.Time"))
 
 	//   // Generate the code
 	g.Execute()
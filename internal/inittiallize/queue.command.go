@@ -0,0 +1,99 @@
+package inittiallize
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"ecom/global"
+	"ecom/internal/wire"
+)
+
+const queueCommandUsage = `usage: server queues <command> [flags]
+
+commands:
+  list                              declared queues with depth, consumers and dead letters
+  peek   -queue NAME [-limit N]     messages of the dead letter queue of NAME, they stay queued
+  replay -queue NAME [-ids ID,...]  publish dead letters back to their original exchange, all without -ids
+  purge  -queue NAME [-ids ID,...]  drop dead letters, all without -ids
+
+every command takes -operator, the name written to the audit log, $USER by default
+`
+
+// RunQueueCommand runs the queue administration of the admin API from the command line and returns the
+// exit code. It connects to the broker and Postgres like the server, the actions are audit-logged the same.
+func RunQueueCommand(args []string) int {
+	stdout, stderr := os.Stdout, os.Stderr
+	if len(args) == 0 {
+		fmt.Fprint(stderr, queueCommandUsage)
+		return 2
+	}
+	command := args[0]
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	operator := flags.String("operator", os.Getenv("USER"), "operator written to the audit log")
+	queueName := flags.String("queue", "", "queue whose dead letters are handled")
+	limit := flags.Int("limit", 0, "number of dead letters to peek")
+	ids := flags.String("ids", "", "comma separated message ids, all dead letters when empty")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	switch command {
+	case "list":
+	case "peek", "replay", "purge":
+		if *queueName == "" {
+			fmt.Fprintln(stderr, "-queue is required")
+			return 2
+		}
+	default:
+		fmt.Fprint(stderr, queueCommandUsage)
+		return 2
+	}
+
+	LoadConfig()
+	initLogger()
+	initPostgres()
+	initRedis()
+	InitRabbitMQ()
+	defer global.RabbitMQManager.Close()
+	queueService, err := wire.InitializeQueueService()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	var messageIDs []string
+	if *ids != "" {
+		messageIDs = strings.Split(*ids, ",")
+	}
+	ctx := context.Background()
+	var result interface{}
+	switch command {
+	case "list":
+		result, err = queueService.ListQueues(ctx, *operator)
+	case "peek":
+		result, err = queueService.PeekDeadLetters(ctx, *operator, *queueName, *limit)
+	case "replay":
+		var replayed int
+		replayed, err = queueService.ReplayDeadLetters(ctx, *operator, *queueName, messageIDs)
+		result = map[string]int{"replayed": replayed}
+	case "purge":
+		var purged int
+		purged, err = queueService.PurgeDeadLetters(ctx, *operator, *queueName, messageIDs)
+		result = map[string]int{"purged": purged}
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -2,8 +2,13 @@ package inittiallize
 
 import (
 	"ecom/global"
+	"ecom/internal/messaging"
+	"ecom/internal/repo"
+	consts "ecom/pkg/const"
 	"ecom/pkg/rabbitmq"
+	"ecom/pkg/redisstream"
 	"fmt"
+	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 	"go.uber.org/zap"
@@ -11,38 +16,133 @@ import (
 
 func InitRabbitMQ() {
 	connectUrl := fmt.Sprintf("amqp://%s:%s@%s:%d/", global.Config.RabbitMQ.User, global.Config.RabbitMQ.Password, global.Config.RabbitMQ.Host, global.Config.RabbitMQ.Port)
-	fmt.Println("connectUrl", connectUrl)
-	conn, err := amqp.Dial(connectUrl)
-	if err != nil {
-		global.Logger.Error("Failed to connect to RabbitMQ", zap.Error(err))
+	global.Logger.Info("Connecting to RabbitMQ", zap.String("host", global.Config.RabbitMQ.Host), zap.Int("port", global.Config.RabbitMQ.Port))
+	options := rabbitmq.DefaultConsumerOptions()
+	cfg := global.Config.RabbitMQ
+	if cfg.Prefetch > 0 {
+		options.Prefetch = cfg.Prefetch
+	}
+	if cfg.MaxRetries != nil && *cfg.MaxRetries >= 0 {
+		options.MaxRetries = *cfg.MaxRetries
+	}
+	if cfg.RetryBaseDelayMs > 0 {
+		options.RetryBaseDelay = time.Duration(cfg.RetryBaseDelayMs) * time.Millisecond
+	}
+	if cfg.RetryMaxDelayMs > 0 {
+		options.RetryMaxDelay = time.Duration(cfg.RetryMaxDelayMs) * time.Millisecond
+	}
+	if cfg.DeadLetterExchange != "" {
+		options.DeadLetterExchange = cfg.DeadLetterExchange
+	}
+
+	switch global.Config.Messaging.Transport {
+	case "", consts.MessagingTransportRabbitMQ:
+		// the manager reconnects on its own, a broker that is down at startup only delays the consumers
+		manager := rabbitmq.NewQueueManager(connectUrl, options)
+		// scheduled messages wait in RabbitMQ, Redis records which of them are still pending
+		if err := manager.StartScheduler(repo.NewScheduleRepository()); err != nil {
+			global.Logger.Error("Failed to start the message scheduler", zap.Error(err))
+			panic(err)
+		}
+		global.RabbitMQManager = manager
+	case consts.MessagingTransportRedis:
+		// streams on the Redis connection, exchanges and bindings are routed by the publisher
+		global.RabbitMQManager = redisstream.NewBroker(global.Rdb, options, global.Config.Messaging.StreamGroup, global.Config.Messaging.StreamMaxLen)
+	default:
+		err := fmt.Errorf("unknown messaging transport %q", global.Config.Messaging.Transport)
+		global.Logger.Error("Failed to create the message broker", zap.Error(err))
 		panic(err)
 	}
 
-	channel, err := conn.Channel()
+	if err := global.RabbitMQManager.ApplyTopology(topology()); err != nil {
+		global.Logger.Error("Failed to declare RabbitMQ topology", zap.Error(err))
+		panic(err)
+	}
+	// saga commands are published through the default exchange straight to the saga queue
+	err := global.RabbitMQManager.ApplyTopology(rabbitmq.Topology{
+		Queues: []rabbitmq.QueueSpec{{Name: consts.SagaQueueName, Durable: true}},
+	})
 	if err != nil {
-		global.Logger.Error("Failed to open a channel", zap.Error(err))
+		global.Logger.Error("Failed to declare the saga queue", zap.Error(err))
 		panic(err)
 	}
 
-	global.RabbitMQManager = &rabbitmq.QueueManager{
-		Conn:    conn,
-		Channel: channel,
-		Queues:  make(map[string]amqp.Queue),
+	// messages of a user always land on the same test queue shard, hashed by the broker plugin or by the publisher
+	err = global.RabbitMQManager.DeclareShardedExchange(rabbitmq.ShardedExchange{
+		Exchange: global.Config.Exchange.Test,
+		Queue:    global.Config.Queue.Test,
+		Mode:     rabbitmq.ShardMode(cfg.Sharding),
+	})
+	if err != nil {
+		global.Logger.Error("Failed to declare the sharded test exchange", zap.Error(err))
+		panic(err)
+	}
+	// the take-interest fan-out of the cron job has its own exchange and queue, sharded by user the same way
+	err = global.RabbitMQManager.DeclareShardedExchange(rabbitmq.ShardedExchange{
+		Exchange: messaging.InterestExchange(),
+		Queue:    messaging.InterestQueue(),
+		Mode:     rabbitmq.ShardMode(cfg.Sharding),
+	})
+	if err != nil {
+		global.Logger.Error("Failed to declare the sharded interest exchange", zap.Error(err))
+		panic(err)
 	}
 
-	// Declare exchange
-	global.RabbitMQManager.DeclareExchange(global.Config.Exchange.Test, "x-consistent-hash")
+	global.Logger.Info("RabbitMQ initialized", zap.String("state", global.RabbitMQManager.State().String()))
 
-	// Declare queues
-	global.RabbitMQManager.DeclareQueue(global.Config.Queue.Test)
+}
 
-	// Bind queues to exchange
-	err = global.RabbitMQManager.BindQueue(global.Config.Queue.Test, global.Config.Exchange.Test)
-	if err != nil {
-		global.Logger.Error("Failed to bind queue to exchange", zap.Error(err))
-		panic(err)
+// topology converts the topology setting. Without one only the wallet events exchange is declared.
+func topology() rabbitmq.Topology {
+	cfg := global.Config.Topology
+	if len(cfg.Exchanges) == 0 && len(cfg.Queues) == 0 && len(cfg.Bindings) == 0 {
+		return legacyTopology()
 	}
 
-	fmt.Println("Connected to RabbitMQ successfully")
+	var topology rabbitmq.Topology
+	for _, exchange := range cfg.Exchanges {
+		topology.Exchanges = append(topology.Exchanges, rabbitmq.ExchangeSpec{
+			Name:       exchange.Name,
+			Kind:       exchange.Type,
+			Durable:    exchange.Durable == nil || *exchange.Durable,
+			AutoDelete: exchange.AutoDelete,
+			Internal:   exchange.Internal,
+			Args:       amqp.Table(exchange.Arguments),
+		})
+	}
+	for _, queue := range cfg.Queues {
+		topology.Queues = append(topology.Queues, rabbitmq.QueueSpec{
+			Name:                 queue.Name,
+			Shards:               queue.Shards,
+			Durable:              queue.Durable == nil || *queue.Durable,
+			AutoDelete:           queue.AutoDelete,
+			MessageTTL:           time.Duration(queue.MessageTTLMs) * time.Millisecond,
+			MaxLength:            queue.MaxLength,
+			DeadLetterExchange:   queue.DeadLetterExchange,
+			DeadLetterRoutingKey: queue.DeadLetterRoutingKey,
+			Args:                 amqp.Table(queue.Arguments),
+		})
+	}
+	for _, binding := range cfg.Bindings {
+		topology.Bindings = append(topology.Bindings, rabbitmq.BindingSpec{
+			Queue:      binding.Queue,
+			Exchange:   binding.Exchange,
+			RoutingKey: binding.RoutingKey,
+			Weight:     binding.Weight,
+			Args:       amqp.Table(binding.Arguments),
+		})
+	}
+	return topology
+}
 
+func legacyTopology() rabbitmq.Topology {
+	walletExchange := global.Config.Exchange.Wallet
+	if walletExchange == "" {
+		walletExchange = consts.WalletEventsExchangeName
+	}
+	return rabbitmq.Topology{
+		Exchanges: []rabbitmq.ExchangeSpec{
+			{Name: walletExchange, Kind: amqp.ExchangeTopic, Durable: true},
+		},
+	}
 }
@@ -0,0 +1,29 @@
+package inittiallize
+
+import (
+	"time"
+
+	"ecom/global"
+	"ecom/pkg/ratelimit"
+
+	"go.uber.org/zap"
+)
+
+const defaultRateLimitFallbackCooldown = 5 * time.Second
+
+// initRateLimit sets the limiter of RateLimitMiddleware: Redis, or the quotas of this instance alone
+// while Redis fails
+func initRateLimit() {
+	cooldown := time.Duration(global.Config.RateLimit.FallbackCooldownSec) * time.Second
+	if cooldown <= 0 {
+		cooldown = defaultRateLimitFallbackCooldown
+	}
+	global.RateLimiter = ratelimit.NewFallbackLimiter(
+		ratelimit.NewRedisLimiter(global.Rdb),
+		ratelimit.NewMemoryLimiter(),
+		cooldown,
+		func(err error) {
+			global.Logger.Error("Rate limiting falls back to the in-process limiter", zap.Error(err))
+		},
+	)
+}
@@ -22,9 +22,9 @@ func initRedis() {
 	_, err := rdb.Ping(ctx).Result()
 	if err != nil {
 		global.Logger.Error("Redis connect error", zap.Error(err))
+	} else {
+		global.Logger.Info("Redis connect success")
 	}
 
-	fmt.Println("Redis connect success")
-
 	global.Rdb = rdb
 }
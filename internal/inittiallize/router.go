@@ -3,7 +3,10 @@ package inittiallize
 import (
 	"ecom/docs"
 	"ecom/global"
+	"ecom/internal/middlewares"
 	"ecom/internal/routers"
+	"ecom/pkg/rabbitmq"
+	"net/http"
 
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
@@ -26,21 +29,30 @@ func InitRouter() *gin.Engine {
 		gin.SetMode((gin.ReleaseMode))
 		r = gin.New()
 	}
+	// middleware
+	r.Use(middlewares.LoggerMiddleware(), middlewares.ErrorHandlerMiddleware())
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
-	// middleware
-	// r.Use(middlewares.AuthMiddleware())
+	adminRouter := routers.RouterGroupApp.Admin
 	depositRouter := routers.RouterGroupApp.Deposit
 	testRouter := routers.RouterGroupApp.Test
+	withdrawRouter := routers.RouterGroupApp.Withdraw
 	MainGroup := r.Group("v1/api")
 	{
 		MainGroup.GET("checkStatus", func(ctx *gin.Context) {
-			ctx.JSON(200, gin.H{"message": "ok"})
+			rabbitMQState := global.RabbitMQManager.State()
+			if rabbitMQState != rabbitmq.StateConnected {
+				ctx.JSON(http.StatusServiceUnavailable, gin.H{"message": "unavailable", "rabbitmq": rabbitMQState.String()})
+				return
+			}
+			ctx.JSON(200, gin.H{"message": "ok", "rabbitmq": rabbitMQState.String()})
 		})
 	}
 	{
 		depositRouter.InitDepositRouter(MainGroup)
 		testRouter.InitTestRouter(MainGroup)
+		withdrawRouter.InitWithdrawRouter(MainGroup)
+		adminRouter.InitQueueRouter(MainGroup)
 	}
 
 	return r
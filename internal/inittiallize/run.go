@@ -1,9 +1,11 @@
 package inittiallize
 
 import (
+	"context"
 	"ecom/global"
 	"ecom/internal/wire"
-	"fmt"
+	"ecom/internal/worker"
+	"time"
 
 	"go.uber.org/zap"
 )
@@ -12,31 +14,56 @@ import (
 
 func Run() {
 	LoadConfig()
-	fmt.Println("config database", global.Config.Postgres.Host, global.Config.Postgres.Port, global.Config.Postgres.User, global.Config.Postgres.DBName)
 	initLogger()
+	global.Logger.Info("Config loaded", zap.String("dbHost", global.Config.Postgres.Host), zap.String("dbPort", global.Config.Postgres.Port),
+		zap.String("dbUser", global.Config.Postgres.User), zap.String("dbName", global.Config.Postgres.DBName))
 	initSecurity()
+	initPostgres()
 	initPostgresC()
 	initPostgresSetting()
 	InitServiceInterface()
 	initRedis()
+	initAuth()
+	initRateLimit()
 	InitRabbitMQ()
 	consumeMessage, err := wire.InitializeConsumeHandler()
 	if err != nil {
 		global.Logger.Error("Failed to initialize consume message", zap.Error(err))
 		return
 	}
-	consumeMessage.RegisterConsumers()
-	// Start worker in a separate goroutine
-	// go func() {
-	// 	w := worker.NewWorker()
-	// 	w.Start()
-	// }()
+	consumerWorker := worker.NewWorker(global.RabbitMQManager, global.Logger.GetZapLogger(), workerOptions())
+	consumeMessage.RegisterConsumers(consumerWorker)
+	withdrawSaga, err := wire.InitializeWithdrawSaga()
+	if err != nil {
+		global.Logger.Error("Failed to initialize withdraw saga", zap.Error(err))
+		return
+	}
+	withdrawSaga.RegisterConsumers(consumerWorker)
+	go withdrawSaga.Start(context.Background())
+	go consumerWorker.Start(context.Background())
+	outboxRelay, err := wire.InitializeOutboxRelay()
+	if err != nil {
+		global.Logger.Error("Failed to initialize outbox relay", zap.Error(err))
+		return
+	}
+	go outboxRelay.Start(context.Background())
 
 	r := InitRouter()
 	InitCronJob()
 
 	port := global.Config.Server.Port
-	fmt.Println("port", port)
+	global.Logger.Info("Server listening", zap.String("port", port))
 	r.Run(":" + port)
 
 }
+
+func workerOptions() worker.Options {
+	cfg := global.Config.Worker
+	return worker.Options{
+		MinConsumers:        cfg.MinConsumers,
+		MaxConsumers:        cfg.MaxConsumers,
+		MessagesPerConsumer: cfg.MessagesPerConsumer,
+		ScaleInterval:       time.Duration(cfg.ScaleIntervalSec) * time.Second,
+		DrainTimeout:        time.Duration(cfg.DrainTimeoutSec) * time.Second,
+	}
+}
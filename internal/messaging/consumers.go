@@ -1,39 +1,64 @@
 package messaging
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
-	"log"
-	"net/http"
-	"strconv"
-	"strings"
 
 	"ecom/global"
 	"ecom/internal/database"
+	"ecom/internal/repo"
 	"ecom/internal/service"
+	"ecom/internal/vo"
+	"ecom/internal/worker"
+	consts "ecom/pkg/const"
+	"ecom/pkg/logger"
 	"ecom/pkg/rabbitmq"
 
 	amqp "github.com/rabbitmq/amqp091-go"
+	"go.uber.org/zap"
 )
 
 type ConsumeMessage struct {
-	rabbitMQManager *rabbitmq.QueueManager
+	rabbitMQManager rabbitmq.Broker
+	router          *EventRouter
+	guard           *MessageGuard
 	testService     service.ITestService
+	walletService   service.IWalletService
 }
 
 func NewConsumeMessage(
 	testService service.ITestService,
+	walletService service.IWalletService,
+	messageRepository repo.IMessageRepository,
 ) *ConsumeMessage {
-	return &ConsumeMessage{
+	c := &ConsumeMessage{
 		rabbitMQManager: global.RabbitMQManager,
+		router:          NewEventRouter(),
+		guard:           NewMessageGuard(messageRepository),
 		testService:     testService,
+		walletService:   walletService,
 	}
+	c.registerHandlers()
+	return c
+}
+
+// registerHandlers maps the actions of the consumed messages to their service calls
+func (c *ConsumeMessage) registerHandlers() {
+	c.router.RegisterEventHandler("create", Handle(func(ctx context.Context, msg Message, req *database.CreateTestParams) (interface{}, error) {
+		return c.testService.CreateTest(req)
+	}))
+	c.router.RegisterEventHandler("update", Handle(func(ctx context.Context, msg Message, req *database.UpdateTestParams) (interface{}, error) {
+		return c.testService.UpdateTest(req)
+	}))
+	c.router.RegisterEventHandler(consts.TransactionTypeTakeInterest, Handle(func(ctx context.Context, msg Message, req *vo.TakeInterestMessage) (interface{}, error) {
+		return c.walletService.TakeInterest(ctx, msg.UserID, req.ProviderKey)
+	}))
 }
 
 func (c *ConsumeMessage) marshalBody(response rabbitmq.QueueResponse) []byte {
 	jsonResponse, err := json.Marshal(response)
 	if err != nil {
-		log.Printf("Failed to marshal response: %v\n", err)
+		global.Logger.Error("Failed to marshal response", zap.Error(err))
 		return []byte("{}")
 	}
 	return jsonResponse
@@ -43,151 +68,81 @@ type BodyMessage struct {
 	Data   interface{} `json:"data"`
 	Action string      `json:"action"`
 	UserID string      `json:"user_id"`
+	// MessageID identifies the message across redeliveries and duplicate publishes
+	MessageID string `json:"message_id,omitempty"`
+	// Key is the hash key the message is routed by, the user id when empty.
+	// Sequence orders the messages of a key, see Sequencer.
+	Key      string `json:"key,omitempty"`
+	Sequence int64  `json:"sequence,omitempty"`
 }
 
-func (c *ConsumeMessage) RegisterConsumers() {
-	fmt.Println("RegisterConsumers")
-	// Order Queue Consumer
-	number := strings.Split(global.Config.Queue.Test, ":")[1]
-	name := strings.Split(global.Config.Queue.Test, ":")[0]
-	numberInt, err := strconv.Atoi(number)
-	if err != nil {
-		log.Printf("Failed to convert number to int: %v\n", err)
-		return
+// InterestExchange returns the exchange of the take-interest messages, exchange.interest or
+// consts.InterestExchangeName
+func InterestExchange() string {
+	if global.Config.Exchange.Interest != "" {
+		return global.Config.Exchange.Interest
 	}
-	for i := 0; i < numberInt; i++ {
-		queue := fmt.Sprintf("%s:%d", name, i)
-		fmt.Println("queue", queue)
-		err := c.rabbitMQManager.Consume(queue, func(msg amqp.Delivery) {
-			fmt.Println("Received message:", string(msg.Body))
-			body := BodyMessage{}
-			err := json.Unmarshal(msg.Body, &body)
-			if err != nil {
-				log.Printf("Failed to unmarshal body: %v\n", err)
-				c.sendResponse(msg, rabbitmq.QueueResponse{
-					CodeResult: http.StatusBadRequest,
-					Data:       nil,
-					Error:      "Failed to parse message body",
-				})
-				return
-			}
-			fmt.Println("Body:", body)
-			var response rabbitmq.QueueResponse
-
-			switch body.Action {
-			case "create":
-				// Convert the data map to JSON bytes
-				dataBytes, err := json.Marshal(body.Data)
-				if err != nil {
-					response.CodeResult = http.StatusBadRequest
-					response.Data = nil
-					response.Error = err.Error()
-					c.sendResponse(msg, response)
-					return
-				}
-
-				var req database.CreateTestParams
-				err = json.Unmarshal(dataBytes, &req)
-				if err != nil {
-					response.CodeResult = http.StatusBadRequest
-					response.Data = nil
-					response.Error = err.Error()
-					c.sendResponse(msg, response)
-					return
-				}
-
-				test, err := c.testService.CreateTest(&req)
-				if err != nil {
-					response.CodeResult = http.StatusBadRequest
-					response.Data = nil
-					response.Error = err.Error()
-					c.sendResponse(msg, response)
-					return
-				}
-
-				jsonResponse, err := json.Marshal(test)
-				if err != nil {
-					response.CodeResult = http.StatusBadRequest
-					response.Data = nil
-					response.Error = err.Error()
-					c.sendResponse(msg, response)
-					return
-				}
-
-				response.CodeResult = http.StatusOK
-				response.Data = &jsonResponse
-				c.sendResponse(msg, response)
-				break
-			case "update":
-				// Convert the data map to JSON bytes
-				dataBytes, err := json.Marshal(body.Data)
-				if err != nil {
-					response.CodeResult = http.StatusBadRequest
-					response.Data = nil
-					response.Error = err.Error()
-					c.sendResponse(msg, response)
-					return
-				}
-
-				var req database.UpdateTestParams
-				err = json.Unmarshal(dataBytes, &req)
-				if err != nil {
-					response.CodeResult = http.StatusBadRequest
-					response.Data = nil
-					response.Error = err.Error()
-					c.sendResponse(msg, response)
-					return
-				}
-
-				test, err := c.testService.UpdateTest(&req)
-				if err != nil {
-					response.CodeResult = http.StatusBadRequest
-					response.Data = nil
-					response.Error = err.Error()
-					c.sendResponse(msg, response)
-					return
-				}
+	return consts.InterestExchangeName
+}
 
-				jsonResponse, err := json.Marshal(test)
-				if err != nil {
-					response.CodeResult = http.StatusBadRequest
-					response.Data = nil
-					response.Error = err.Error()
-					c.sendResponse(msg, response)
-					return
-				}
+// InterestQueue returns the "name:N" queue of the take-interest messages, queue.interest or
+// consts.InterestQueueName
+func InterestQueue() string {
+	if global.Config.Queue.Interest != "" {
+		return global.Config.Queue.Interest
+	}
+	return consts.InterestQueueName
+}
 
-				response.CodeResult = http.StatusOK
-				response.Data = &jsonResponse
-				c.sendResponse(msg, response)
-				break
-			default:
-				log.Printf("Unknown action in routing key: %s\n", body.Action)
-				response.CodeResult = http.StatusBadRequest
-				response.Data = nil
-				response.Error = "Unknown action"
-				c.sendResponse(msg, response)
-			}
-		})
+// RegisterConsumers adds every shard of the "name:N" test and interest queues to the worker,
+// the worker runs and scales their consumers
+func (c *ConsumeMessage) RegisterConsumers(w *worker.Worker) {
+	for _, setting := range []string{global.Config.Queue.Test, InterestQueue()} {
+		queues, err := rabbitmq.ShardNames(setting)
 		if err != nil {
-			fmt.Println("Failed to consume from log_queue:", err)
+			global.Logger.Error("Failed to parse queue", zap.String("queue", setting), zap.Error(err))
+			continue
+		}
+		for _, queue := range queues {
+			w.AddShard(queue, c.handleMessage)
+		}
+	}
+}
+
+// handleMessage runs the handler of the message action, once per message id and in order per key.
+// Malformed messages are dead-lettered right away, service errors are retried.
+// The reply is sent on success and once the message will not be retried.
+func (c *ConsumeMessage) handleMessage(msg amqp.Delivery) error {
+	ctx := rabbitmq.MessageContext(context.Background(), msg)
+	logger.FromContext(ctx).Debug("Received message", zap.ByteString("body", msg.Body))
+	lastAttempt := c.rabbitMQManager.IsLastAttempt(msg)
+	response, err := c.guard.Process(ctx, msg, lastAttempt, func() (rabbitmq.QueueResponse, error) {
+		return c.router.Dispatch(ctx, msg)
+	})
+	if err != nil {
+		logger.FromContext(ctx).Error("Failed to handle message", zap.Error(err))
+		if !rabbitmq.IsPermanent(err) && !lastAttempt {
+			return err
 		}
 	}
+	c.sendResponse(msg, response)
+	return err
 }
 
 // Helper function to send response
 func (c *ConsumeMessage) sendResponse(msg amqp.Delivery, response rabbitmq.QueueResponse) {
 	if msg.ReplyTo != "" {
-		c.rabbitMQManager.Channel.Publish(
+		err := c.rabbitMQManager.Publish(
 			"",
 			msg.ReplyTo,
-			false,
-			false,
 			amqp.Publishing{
 				ContentType:   "text/plain",
 				CorrelationId: msg.CorrelationId,
 				Body:          c.marshalBody(response),
 			},
 		)
+		if err != nil {
+			global.Logger.Error("Failed to send response", zap.String("replyTo", msg.ReplyTo), zap.Error(err))
+		}
 	}
 }
@@ -0,0 +1,180 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"ecom/internal/repo"
+	"ecom/pkg/logger"
+	"ecom/pkg/rabbitmq"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.uber.org/zap"
+)
+
+const (
+	keyLockTTL  = 30 * time.Second
+	keyLockWait = 5 * time.Second
+	keyLockPoll = 50 * time.Millisecond
+)
+
+var (
+	// ErrOutOfOrder is returned for a message whose previous sequence number was not processed yet,
+	// it is retried until the gap is filled
+	ErrOutOfOrder = errors.New("message is ahead of its key sequence")
+	// ErrKeyLocked is returned when another consumer kept the key of a message busy for too long
+	ErrKeyLocked = errors.New("message key is being processed by another consumer")
+)
+
+// Sequencer stamps outgoing messages with a message id and the next sequence number of their key
+type Sequencer struct {
+	messageRepository repo.IMessageRepository
+}
+
+func NewSequencer(messageRepository repo.IMessageRepository) *Sequencer {
+	return &Sequencer{
+		messageRepository: messageRepository,
+	}
+}
+
+// Stamp sets MessageID when empty and Sequence, the key defaults to the user id.
+// The message must be published with its key as routing key so the whole sequence lands on one shard.
+func (s *Sequencer) Stamp(ctx context.Context, msg *BodyMessage) error {
+	if msg.MessageID == "" {
+		msg.MessageID = uuid.NewString()
+	}
+	if msg.Key == "" {
+		msg.Key = msg.UserID
+	}
+	if msg.Key == "" {
+		return nil
+	}
+	sequence, err := s.messageRepository.NextSequence(ctx, msg.Key)
+	if err != nil {
+		return err
+	}
+	msg.Sequence = sequence
+	return nil
+}
+
+// MessageGuard runs every message id once and the messages of a key one at a time in sequence order.
+// A duplicate gets the response stored for the original back. The response is stored after the handler
+// returned, a crash in between runs the message again, so handlers still have to tolerate a replay.
+// A dead letter replayed by an operator already has a stored result and an applied sequence, it runs
+// once per replay id under the key lock and leaves the sequence of its key alone.
+type MessageGuard struct {
+	messageRepository repo.IMessageRepository
+}
+
+func NewMessageGuard(messageRepository repo.IMessageRepository) *MessageGuard {
+	return &MessageGuard{
+		messageRepository: messageRepository,
+	}
+}
+
+// Process runs process under the guard. lastAttempt is true when a failure dead-letters the message:
+// its result is then stored like a success so the key moves on, and a message still ahead of its
+// sequence is processed anyway instead of blocking the key behind a message that was never published.
+func (g *MessageGuard) Process(ctx context.Context, msg amqp.Delivery, lastAttempt bool, process func() (rabbitmq.QueueResponse, error)) (rabbitmq.QueueResponse, error) {
+	var body BodyMessage
+	if err := decodeBody(msg, &body); err != nil {
+		// the router rejects the body
+		return process()
+	}
+	messageID := body.MessageID
+	if messageID == "" {
+		messageID = msg.MessageId
+	}
+	key := body.Key
+	if key == "" {
+		key = body.UserID
+	}
+	if body.Sequence == 0 {
+		key = ""
+	}
+	lockKey := key
+	if replayID, _ := msg.Headers[rabbitmq.HeaderReplayID].(string); replayID != "" && messageID != "" {
+		messageID += ":replay:" + replayID
+		key = ""
+	}
+	if messageID == "" && key == "" {
+		return process()
+	}
+
+	if lockKey == "" {
+		lockKey = messageID
+	}
+	token := uuid.NewString()
+	if err := g.lock(ctx, lockKey, token); err != nil {
+		return rabbitmq.QueueResponse{CodeResult: http.StatusServiceUnavailable, Error: err.Error()}, err
+	}
+	defer func() {
+		if err := g.messageRepository.ReleaseKeyLock(context.Background(), lockKey, token); err != nil {
+			logger.FromContext(ctx).Error("Failed to release message lock", zap.String("lockKey", lockKey), zap.Error(err))
+		}
+	}()
+
+	if messageID != "" {
+		stored, err := g.messageRepository.GetResponse(ctx, messageID)
+		if err != nil {
+			return rabbitmq.QueueResponse{CodeResult: http.StatusServiceUnavailable, Error: err.Error()}, err
+		}
+		if stored != nil {
+			logger.FromContext(ctx).Info("Duplicate message, replying with the stored response")
+			return *stored, nil
+		}
+	}
+	if key != "" {
+		applied, err := g.messageRepository.GetAppliedSequence(ctx, key)
+		if err != nil {
+			return rabbitmq.QueueResponse{CodeResult: http.StatusServiceUnavailable, Error: err.Error()}, err
+		}
+		if body.Sequence <= applied {
+			// the original is older than the stored responses or was skipped over
+			return rabbitmq.QueueResponse{CodeResult: http.StatusConflict, Error: "duplicate message"}, nil
+		}
+		if body.Sequence > applied+1 {
+			if !lastAttempt {
+				return rabbitmq.QueueResponse{CodeResult: http.StatusConflict, Error: ErrOutOfOrder.Error()}, ErrOutOfOrder
+			}
+			logger.FromContext(ctx).Warn("Skipping sequence", zap.Int64("from", applied+1), zap.Int64("to", body.Sequence-1), zap.String("key", key))
+		}
+	}
+
+	response, err := process()
+	if err == nil || rabbitmq.IsPermanent(err) || lastAttempt {
+		sequence := body.Sequence
+		if key == "" {
+			sequence = 0
+		}
+		if saveErr := g.messageRepository.SaveResult(ctx, messageID, key, sequence, response); saveErr != nil {
+			logger.FromContext(ctx).Error("Failed to save the message result", zap.Error(saveErr))
+		}
+	}
+	return response, err
+}
+
+// lock waits up to keyLockWait for the lock of a key
+func (g *MessageGuard) lock(ctx context.Context, key, token string) error {
+	deadline := time.Now().Add(keyLockWait)
+	for {
+		ok, err := g.messageRepository.AcquireKeyLock(ctx, key, token, keyLockTTL)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return ErrKeyLocked
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(keyLockPoll):
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package messaging
+
+import (
+	"context"
+
+	"ecom/global"
+	"ecom/pkg/rabbitmq"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// defaultProducer names the publisher in the envelope when messaging.producer is not set
+const defaultProducer = "ecom"
+
+// PublishMessage publishes msg with its envelope in the codec of messaging.codec, routed by its key.
+// The event type defaults to the action and the message id to the one stamped by the Sequencer.
+func PublishMessage(ctx context.Context, exchange string, msg BodyMessage, envelope rabbitmq.Envelope) error {
+	codec, err := rabbitmq.CodecByName(global.Config.Messaging.Codec)
+	if err != nil {
+		return err
+	}
+	if envelope.EventType == "" {
+		envelope.EventType = msg.Action
+	}
+	if envelope.MessageID == "" {
+		envelope.MessageID = msg.MessageID
+	}
+	if envelope.Producer == "" {
+		envelope.Producer = producer()
+	}
+	routingKey := msg.Key
+	if routingKey == "" {
+		routingKey = msg.UserID
+	}
+	publishCtx, cancel := context.WithTimeout(ctx, rabbitmq.DefaultConfirmTimeout)
+	defer cancel()
+	return rabbitmq.PublishEnvelope(publishCtx, global.RabbitMQManager, exchange, routingKey, envelope, codec, msg)
+}
+
+func producer() string {
+	if global.Config.Messaging.Producer != "" {
+		return global.Config.Messaging.Producer
+	}
+	return defaultProducer
+}
+
+// decodeBody decodes a delivery with the codec of its content type
+func decodeBody(delivery amqp.Delivery, v interface{}) error {
+	codec, err := rabbitmq.CodecFor(delivery.ContentType)
+	if err != nil {
+		return err
+	}
+	return codec.Unmarshal(delivery.Body, v)
+}
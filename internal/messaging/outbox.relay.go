@@ -0,0 +1,96 @@
+package messaging
+
+import (
+	"context"
+	"time"
+
+	"ecom/global"
+	"ecom/internal/repo"
+	"ecom/pkg/logger"
+	"ecom/pkg/rabbitmq"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	outboxPollInterval   = time.Second
+	outboxBatchSize      = 100
+	outboxRetryBaseDelay = time.Second
+	outboxRetryMaxDelay  = 5 * time.Minute
+)
+
+// OutboxRelay publishes the events written to the outbox by the services. An event is marked sent only
+// after the broker confirmed it, so every committed event is delivered at least once.
+// Consumers deduplicate on the message id.
+type OutboxRelay struct {
+	rabbitMQManager  rabbitmq.Broker
+	outboxRepository repo.IOutboxRepository
+}
+
+func NewOutboxRelay(outboxRepository repo.IOutboxRepository) *OutboxRelay {
+	return &OutboxRelay{
+		rabbitMQManager:  global.RabbitMQManager,
+		outboxRepository: outboxRepository,
+	}
+}
+
+// Start polls the outbox until ctx is done
+func (r *OutboxRelay) Start(ctx context.Context) {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !r.rabbitMQManager.IsConnected() {
+			continue
+		}
+		if err := r.relayBatch(ctx); err != nil {
+			logger.FromContext(ctx).Error("Failed to relay outbox events", zap.Error(err))
+		}
+	}
+}
+
+// relayBatch publishes one batch of due events. The rows stay locked until every event of the batch
+// has been confirmed or postponed, a concurrent relay skips them.
+func (r *OutboxRelay) relayBatch(ctx context.Context) error {
+	return repo.RunInTx(ctx, func(tx *gorm.DB) error {
+		outboxRepository := r.outboxRepository.WithTx(tx)
+		events, err := outboxRepository.LockPendingEvents(outboxBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			msg := amqp.Publishing{
+				ContentType:  rabbitmq.ContentTypeJSON,
+				DeliveryMode: amqp.Persistent,
+				Body:         event.Payload,
+			}
+			rabbitmq.Envelope{
+				EventType: event.RoutingKey,
+				MessageID: event.MessageID,
+				Producer:  producer(),
+				Timestamp: event.CreatedAt,
+			}.Apply(&msg)
+			publishCtx, cancel := context.WithTimeout(ctx, rabbitmq.DefaultConfirmTimeout)
+			err := r.rabbitMQManager.PublishWithConfirm(publishCtx, event.Exchange, event.RoutingKey, msg)
+			cancel()
+			if err != nil {
+				logger.FromContext(ctx).Error("Failed to publish outbox event", zap.String("eventId", event.ID), zap.Int32("attempt", event.Attempts+1), zap.Error(err))
+				delay := rabbitmq.RetryDelay(int(event.Attempts)+1, outboxRetryBaseDelay, outboxRetryMaxDelay)
+				if err := outboxRepository.MarkEventFailed(event.ID, err.Error(), time.Now().Add(delay)); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := outboxRepository.MarkEventSent(event.ID, time.Now()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,173 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"ecom/pkg/rabbitmq"
+
+	"github.com/gin-gonic/gin/binding"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Message is a consumed BodyMessage whose data has not been decoded yet
+type Message struct {
+	Action   string
+	UserID   string
+	Data     json.RawMessage
+	Envelope rabbitmq.Envelope
+	Delivery amqp.Delivery
+}
+
+// EventHandler handles the message of an action, its result is the data of the reply
+type EventHandler func(ctx context.Context, msg Message) (interface{}, error)
+
+// Validator is implemented by payloads with checks the binding tags cannot express
+type Validator interface {
+	Validate() error
+}
+
+// Handle adapts a typed handler to an EventHandler. The message data is decoded into a T and validated
+// with its binding tags and its Validate method, data that fails either is a permanent error.
+func Handle[T any](handler func(ctx context.Context, msg Message, data *T) (interface{}, error)) EventHandler {
+	return func(ctx context.Context, msg Message) (interface{}, error) {
+		data := new(T)
+		if len(msg.Data) > 0 {
+			if err := json.Unmarshal(msg.Data, data); err != nil {
+				return nil, rabbitmq.Permanent(fmt.Errorf("decode %s data: %w", msg.Action, err))
+			}
+		}
+		if err := binding.Validator.ValidateStruct(data); err != nil {
+			return nil, rabbitmq.Permanent(fmt.Errorf("validate %s data: %w", msg.Action, err))
+		}
+		if v, ok := any(data).(Validator); ok {
+			if err := v.Validate(); err != nil {
+				return nil, rabbitmq.Permanent(fmt.Errorf("validate %s data: %w", msg.Action, err))
+			}
+		}
+		return handler(ctx, msg, data)
+	}
+}
+
+type patternHandler struct {
+	pattern string
+	handler EventHandler
+}
+
+// EventRouter maps actions to handlers. An action is matched exactly first, then against the patterns
+// in registration order. Patterns are dot separated like AMQP topic bindings, "*" matches one word
+// and "#" zero or more words, e.g. "wallet.*" or "user.registered.#".
+// A handler registered for a schema version takes the messages of that version before the others,
+// so old and new payloads of an action can be consumed side by side during a rollout.
+type EventRouter struct {
+	mu       sync.RWMutex
+	handlers map[string]EventHandler
+	versions map[string]map[int]EventHandler
+	patterns []patternHandler
+}
+
+func NewEventRouter() *EventRouter {
+	return &EventRouter{
+		handlers: make(map[string]EventHandler),
+		versions: make(map[string]map[int]EventHandler),
+	}
+}
+
+func (r *EventRouter) RegisterEventHandler(action string, handler EventHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[action] = handler
+}
+
+// RegisterEventHandlerVersion registers the handler of one schema version of an action
+func (r *EventRouter) RegisterEventHandlerVersion(action string, version int, handler EventHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.versions[action] == nil {
+		r.versions[action] = make(map[int]EventHandler)
+	}
+	r.versions[action][version] = handler
+}
+
+func (r *EventRouter) RegisterEventHandlerWithPattern(pattern string, handler EventHandler) {
+	if !strings.ContainsAny(pattern, "*#") {
+		r.RegisterEventHandler(pattern, handler)
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.patterns = append(r.patterns, patternHandler{pattern: pattern, handler: handler})
+}
+
+// MatchVersion returns the handler of a schema version of an action, falling back to Match
+func (r *EventRouter) MatchVersion(action string, version int) (EventHandler, bool) {
+	r.mu.RLock()
+	handler, ok := r.versions[action][version]
+	r.mu.RUnlock()
+	if ok {
+		return handler, true
+	}
+	return r.Match(action)
+}
+
+// Match returns the handler of an action
+func (r *EventRouter) Match(action string) (EventHandler, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if handler, ok := r.handlers[action]; ok {
+		return handler, true
+	}
+	for _, p := range r.patterns {
+		if rabbitmq.MatchTopic(p.pattern, action) {
+			return p.handler, true
+		}
+	}
+	return nil, false
+}
+
+// Dispatch decodes a delivery with the codec of its content type, runs the handler of its action and
+// schema version and builds the reply. A body without action takes the event type of its envelope.
+// The returned error decides whether the delivery is retried, see rabbitmq.Handler.
+func (r *EventRouter) Dispatch(ctx context.Context, delivery amqp.Delivery) (rabbitmq.QueueResponse, error) {
+	var body struct {
+		Data   json.RawMessage `json:"data"`
+		Action string          `json:"action"`
+		UserID string          `json:"user_id"`
+	}
+	if err := decodeBody(delivery, &body); err != nil {
+		return rabbitmq.QueueResponse{
+			CodeResult: http.StatusBadRequest,
+			Error:      "Failed to parse message body",
+		}, rabbitmq.Permanent(err)
+	}
+	envelope := rabbitmq.EnvelopeOf(delivery)
+	if body.Action == "" {
+		body.Action = envelope.EventType
+	}
+
+	handler, ok := r.MatchVersion(body.Action, envelope.SchemaVersion)
+	if !ok {
+		err := rabbitmq.Permanent(fmt.Errorf("unknown action %q", body.Action))
+		return rabbitmq.QueueResponse{CodeResult: http.StatusBadRequest, Error: err.Error()}, err
+	}
+
+	result, err := handler(ctx, Message{
+		Action:   body.Action,
+		UserID:   body.UserID,
+		Data:     body.Data,
+		Envelope: envelope,
+		Delivery: delivery,
+	})
+	if err == nil {
+		var data []byte
+		if data, err = json.Marshal(result); err == nil {
+			return rabbitmq.QueueResponse{CodeResult: http.StatusOK, Data: &data}, nil
+		}
+		err = rabbitmq.Permanent(err)
+	}
+	return rabbitmq.QueueResponse{CodeResult: http.StatusBadRequest, Error: err.Error()}, err
+}
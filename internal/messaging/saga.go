@@ -0,0 +1,465 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"ecom/global"
+	"ecom/internal/model"
+	"ecom/internal/repo"
+	"ecom/internal/worker"
+	consts "ecom/pkg/const"
+	"ecom/pkg/logger"
+	"ecom/pkg/rabbitmq"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultSagaTimeout       = 10 * time.Minute
+	defaultSagaSweepInterval = 30 * time.Second
+	sagaSweepBatch           = 100
+	sagaStepSavePoint        = "saga_step"
+)
+
+var ErrUnknownSaga = errors.New("unknown saga type")
+
+// SagaCommand asks the orchestrator to run or compensate one step of a saga
+type SagaCommand struct {
+	SagaID     string `json:"sagaId"`
+	Step       int    `json:"step"`
+	Compensate bool   `json:"compensate"`
+}
+
+// SagaStep is one step of a saga. Action and Compensate run in the transaction that records the outcome
+// of the step, their writes through SagaContext.Tx commit with it. A failed Action is rolled back before
+// the compensations start. Compensate is nil for a step with nothing to undo.
+// A Permanent error fails the step at once, other errors are retried like any message and fail the step
+// on the last attempt.
+type SagaStep struct {
+	Name       string
+	Action     func(ctx context.Context, saga *SagaContext) error
+	Compensate func(ctx context.Context, saga *SagaContext) error
+	// Pivot marks the step that cannot be undone, e.g. a payment through an external system. Its Action
+	// runs outside the transaction, without Tx, so a slow call does not hold the saga lock, and must be
+	// idempotent since a duplicate command may repeat it. Once it succeeded the saga only moves forward:
+	// a later step failing on its last attempt fails the saga for a manual repair instead of compensating,
+	// and the timeout leaves the saga alone from the pivot on. The first step cannot be a pivot.
+	Pivot bool
+}
+
+type SagaDefinition struct {
+	Type  string
+	Steps []SagaStep
+	// Timeout bounds a running saga, once it runs longer its completed steps are compensated
+	Timeout time.Duration
+	// OnFinish runs in the transaction that ends the saga completed, compensated or failed
+	OnFinish func(ctx context.Context, saga *SagaContext) error
+
+	// pivot is the index of the first pivot step, len(Steps) without one
+	pivot int
+}
+
+// SagaContext is the state of a saga handed to its steps
+type SagaContext struct {
+	ID        string
+	Type      string
+	Reference string
+	Status    string
+	Step      int
+	// Error is the failure that started the compensation
+	Error string
+	// Committed is set once the pivot step succeeded, a failed saga then could not be compensated
+	Committed bool
+	Tx        *gorm.DB
+	data      json.RawMessage
+}
+
+// Decode unmarshals the saga data into v
+func (s *SagaContext) Decode(v interface{}) error {
+	return json.Unmarshal(s.data, v)
+}
+
+// Update replaces the saga data, it is saved with the outcome of the step
+func (s *SagaContext) Update(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s.data = data
+	return nil
+}
+
+// SagaOrchestrator runs sagas: sequences of steps each undone by a compensation when a later step fails.
+// The saga state is a row in Postgres locked while a step runs, every next step is a SagaCommand written
+// to the outbox in the same transaction and consumed from the saga queue, so a saga survives restarts and
+// a duplicate command finds its step already done and is dropped. Running sagas past their timeout are
+// compensated by Start, unless they reached their pivot step.
+type SagaOrchestrator struct {
+	rabbitMQManager  rabbitmq.Broker
+	sagaRepository   repo.ISagaRepository
+	outboxRepository repo.IOutboxRepository
+	sweepInterval    time.Duration
+
+	mu          sync.RWMutex
+	definitions map[string]SagaDefinition
+}
+
+func NewSagaOrchestrator(sagaRepository repo.ISagaRepository, outboxRepository repo.IOutboxRepository) *SagaOrchestrator {
+	sweepInterval := time.Duration(global.Config.Saga.SweepIntervalSec) * time.Second
+	if sweepInterval <= 0 {
+		sweepInterval = defaultSagaSweepInterval
+	}
+	return &SagaOrchestrator{
+		rabbitMQManager:  global.RabbitMQManager,
+		sagaRepository:   sagaRepository,
+		outboxRepository: outboxRepository,
+		sweepInterval:    sweepInterval,
+		definitions:      make(map[string]SagaDefinition),
+	}
+}
+
+// Register adds a saga definition, its timeout defaults to saga.timeout_sec
+func (o *SagaOrchestrator) Register(definition SagaDefinition) {
+	if definition.Timeout <= 0 {
+		definition.Timeout = time.Duration(global.Config.Saga.TimeoutSec) * time.Second
+	}
+	if definition.Timeout <= 0 {
+		definition.Timeout = defaultSagaTimeout
+	}
+	definition.pivot = len(definition.Steps)
+	for i, step := range definition.Steps {
+		if step.Pivot {
+			definition.pivot = i
+			break
+		}
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.definitions[definition.Type] = definition
+}
+
+func (o *SagaOrchestrator) definition(sagaType string) (SagaDefinition, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	definition, ok := o.definitions[sagaType]
+	if !ok {
+		return SagaDefinition{}, fmt.Errorf("%w: %s", ErrUnknownSaga, sagaType)
+	}
+	return definition, nil
+}
+
+// Begin creates a saga and runs its first step in the same transaction. When the first step fails nothing
+// is saved and its error is returned, the caller can reject the request as before. The other steps run
+// from the saga queue. The returned context holds the data after the first step, its Tx is done.
+func (o *SagaOrchestrator) Begin(ctx context.Context, sagaType, reference string, data interface{}) (*SagaContext, error) {
+	definition, err := o.definition(sagaType)
+	if err != nil {
+		return nil, err
+	}
+	if len(definition.Steps) == 0 {
+		return nil, fmt.Errorf("saga %s has no steps", sagaType)
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var saga *SagaContext
+	err = repo.RunInTx(ctx, func(tx *gorm.DB) error {
+		now := time.Now()
+		row := model.Saga{
+			SagaType:  sagaType,
+			Reference: reference,
+			Status:    consts.SagaStatusRunning,
+			Data:      payload,
+			TimeoutAt: now.Add(definition.Timeout),
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if err := o.sagaRepository.WithTx(tx).CreateSaga(&row); err != nil {
+			return err
+		}
+		saga = newSagaContext(definition, row, tx)
+		if err := definition.Steps[0].Action(ctx, saga); err != nil {
+			return err
+		}
+		return o.advance(ctx, tx, definition, &row, saga)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return saga, nil
+}
+
+func newSagaContext(definition SagaDefinition, row model.Saga, tx *gorm.DB) *SagaContext {
+	return &SagaContext{
+		ID:        row.ID,
+		Type:      row.SagaType,
+		Reference: row.Reference,
+		Status:    row.Status,
+		Step:      int(row.Step),
+		Error:     row.LastError,
+		Committed: int(row.Step) > definition.pivot,
+		Tx:        tx,
+		data:      row.Data,
+	}
+}
+
+// RegisterConsumers adds the saga queue to the worker
+func (o *SagaOrchestrator) RegisterConsumers(w *worker.Worker) {
+	w.AddShard(consts.SagaQueueName, o.handleCommand)
+}
+
+func (o *SagaOrchestrator) handleCommand(msg amqp.Delivery) error {
+	var command SagaCommand
+	if err := decodeBody(msg, &command); err != nil {
+		return rabbitmq.Permanent(fmt.Errorf("decode saga command: %w", err))
+	}
+	return o.Execute(rabbitmq.MessageContext(context.Background(), msg), command, o.rabbitMQManager.IsLastAttempt(msg))
+}
+
+// Execute runs the step of a command. A command that does not match the saga state anymore, because it
+// was delivered twice or the saga timed out meanwhile, is dropped. lastAttempt turns a retried step error
+// into a step failure.
+func (o *SagaOrchestrator) Execute(ctx context.Context, command SagaCommand, lastAttempt bool) error {
+	l := logger.FromContext(ctx).With(zap.String("sagaId", command.SagaID))
+	var pivot func(ctx context.Context, saga *SagaContext) error
+	if !command.Compensate {
+		var err error
+		if pivot, err = o.runPivot(ctx, command); err != nil {
+			return err
+		}
+	}
+	return repo.RunInTx(ctx, func(tx *gorm.DB) error {
+		row, definition, err := o.lockCommand(tx, command)
+		if err != nil {
+			return err
+		}
+		if !command.matches(row, definition) {
+			l.Info("Dropping stale saga command", zap.Int("commandStep", command.Step), zap.String("status", row.Status), zap.Int32("step", row.Step))
+			return nil
+		}
+
+		saga := newSagaContext(definition, row, tx)
+		step := definition.Steps[command.Step]
+		if err := tx.SavePoint(sagaStepSavePoint).Error; err != nil {
+			return err
+		}
+		if !command.Compensate {
+			action := step.Action
+			if step.Pivot && pivot != nil {
+				action = pivot
+			}
+			if err := action(ctx, saga); err != nil {
+				if !rabbitmq.IsPermanent(err) && !lastAttempt {
+					return err
+				}
+				if err := tx.RollbackTo(sagaStepSavePoint).Error; err != nil {
+					return err
+				}
+				row.LastError = fmt.Sprintf("%s: %v", step.Name, err)
+				if saga.Committed {
+					l.Error("Saga step failed past its pivot, needs a manual repair", zap.String("step", step.Name), zap.Error(err))
+					row.Status = consts.SagaStatusFailed
+					return o.finish(ctx, tx, definition, &row, saga)
+				}
+				l.Warn("Saga step failed, compensating", zap.String("step", step.Name), zap.Error(err))
+				row.Status = consts.SagaStatusCompensating
+				return o.compensate(ctx, tx, definition, &row, saga, command.Step-1)
+			}
+			return o.advance(ctx, tx, definition, &row, saga)
+		}
+
+		if err := step.Compensate(ctx, saga); err != nil {
+			if !rabbitmq.IsPermanent(err) && !lastAttempt {
+				return err
+			}
+			l.Error("Saga compensation failed", zap.String("step", step.Name), zap.Error(err))
+			if err := tx.RollbackTo(sagaStepSavePoint).Error; err != nil {
+				return err
+			}
+			row.Status = consts.SagaStatusFailed
+			row.LastError = fmt.Sprintf("%s; compensate %s: %v", row.LastError, step.Name, err)
+			return o.finish(ctx, tx, definition, &row, saga)
+		}
+		return o.compensate(ctx, tx, definition, &row, saga, command.Step-1)
+	})
+}
+
+// runPivot runs the action of a pivot step before the transaction locking the saga, it returns the
+// outcome of the action for that transaction to record, or nil when the command is not for a pivot step.
+// The saga is read without the lock, the transaction checks the command again.
+func (o *SagaOrchestrator) runPivot(ctx context.Context, command SagaCommand) (func(ctx context.Context, saga *SagaContext) error, error) {
+	row, err := o.sagaRepository.GetSaga(command.SagaID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	definition, err := o.definition(row.SagaType)
+	if err != nil || !command.matches(row, definition) || !definition.Steps[command.Step].Pivot {
+		return nil, nil
+	}
+	saga := newSagaContext(definition, row, nil)
+	actionErr := definition.Steps[command.Step].Action(ctx, saga)
+	return func(ctx context.Context, locked *SagaContext) error {
+		if actionErr != nil {
+			return actionErr
+		}
+		locked.data = saga.data
+		return nil
+	}, nil
+}
+
+// lockCommand locks the saga of a command and returns it with its definition
+func (o *SagaOrchestrator) lockCommand(tx *gorm.DB, command SagaCommand) (model.Saga, SagaDefinition, error) {
+	row, err := o.sagaRepository.WithTx(tx).LockSaga(command.SagaID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.Saga{}, SagaDefinition{}, rabbitmq.Permanent(fmt.Errorf("saga %s not found", command.SagaID))
+		}
+		return model.Saga{}, SagaDefinition{}, err
+	}
+	definition, err := o.definition(row.SagaType)
+	if err != nil {
+		return model.Saga{}, SagaDefinition{}, rabbitmq.Permanent(err)
+	}
+	return row, definition, nil
+}
+
+// matches tells whether the saga still waits for the command
+func (c SagaCommand) matches(row model.Saga, definition SagaDefinition) bool {
+	status := consts.SagaStatusRunning
+	if c.Compensate {
+		status = consts.SagaStatusCompensating
+	}
+	return row.Status == status && int(row.Step) == c.Step && c.Step < len(definition.Steps)
+}
+
+// advance saves a completed step and sends the command of the next one, or completes the saga
+func (o *SagaOrchestrator) advance(ctx context.Context, tx *gorm.DB, definition SagaDefinition, row *model.Saga, saga *SagaContext) error {
+	row.Data = saga.data
+	next := int(row.Step) + 1
+	if next >= len(definition.Steps) {
+		row.Status = consts.SagaStatusCompleted
+		return o.finish(ctx, tx, definition, row, saga)
+	}
+	row.Step = int32(next)
+	row.UpdatedAt = time.Now()
+	if err := o.sagaRepository.WithTx(tx).UpdateSaga(row); err != nil {
+		return err
+	}
+	return o.enqueue(tx, SagaCommand{SagaID: row.ID, Step: next})
+}
+
+// compensate sends the command compensating the last completed step up to from with a compensation,
+// the saga ends compensated when there is none left
+func (o *SagaOrchestrator) compensate(ctx context.Context, tx *gorm.DB, definition SagaDefinition, row *model.Saga, saga *SagaContext, from int) error {
+	row.Data = saga.data
+	for step := from; step >= 0; step-- {
+		if definition.Steps[step].Compensate == nil {
+			continue
+		}
+		row.Step = int32(step)
+		row.UpdatedAt = time.Now()
+		if err := o.sagaRepository.WithTx(tx).UpdateSaga(row); err != nil {
+			return err
+		}
+		return o.enqueue(tx, SagaCommand{SagaID: row.ID, Step: step, Compensate: true})
+	}
+	row.Status = consts.SagaStatusCompensated
+	return o.finish(ctx, tx, definition, row, saga)
+}
+
+// finish saves the final status of a saga and runs OnFinish in the same transaction
+func (o *SagaOrchestrator) finish(ctx context.Context, tx *gorm.DB, definition SagaDefinition, row *model.Saga, saga *SagaContext) error {
+	row.Data = saga.data
+	row.UpdatedAt = time.Now()
+	if err := o.sagaRepository.WithTx(tx).UpdateSaga(row); err != nil {
+		return err
+	}
+	if definition.OnFinish == nil {
+		return nil
+	}
+	saga.Status = row.Status
+	saga.Error = row.LastError
+	return definition.OnFinish(ctx, saga)
+}
+
+func (o *SagaOrchestrator) enqueue(tx *gorm.DB, command SagaCommand) error {
+	payload, err := json.Marshal(command)
+	if err != nil {
+		return err
+	}
+	direction := "run"
+	if command.Compensate {
+		direction = "compensate"
+	}
+	return o.outboxRepository.WithTx(tx).CreateEvent(&model.OutboxEvent{
+		// through the default exchange straight to the saga queue
+		Exchange:    "",
+		RoutingKey:  consts.SagaQueueName,
+		MessageID:   fmt.Sprintf("%s:%d:%s", command.SagaID, command.Step, direction),
+		Payload:     payload,
+		Status:      consts.OutboxStatusPending,
+		AvailableAt: time.Now(),
+	})
+}
+
+// Start sweeps the timed out sagas until ctx is done
+func (o *SagaOrchestrator) Start(ctx context.Context) {
+	ticker := time.NewTicker(o.sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := o.Sweep(ctx); err != nil {
+			logger.FromContext(ctx).Error("Failed to time out sagas", zap.Error(err))
+		}
+	}
+}
+
+// Sweep compensates the running sagas past their timeout. A saga at or past its pivot step is skipped, it
+// cannot be undone and its pending command moves it forward.
+func (o *SagaOrchestrator) Sweep(ctx context.Context) error {
+	return repo.RunInTx(ctx, func(tx *gorm.DB) error {
+		rows, err := o.sagaRepository.WithTx(tx).LockTimedOutSagas(sagaSweepBatch)
+		if err != nil {
+			return err
+		}
+		for i := range rows {
+			row := &rows[i]
+			definition, err := o.definition(row.SagaType)
+			if err != nil {
+				logger.FromContext(ctx).Error("Skipping timed out saga", zap.String("sagaId", row.ID), zap.Error(err))
+				continue
+			}
+			if int(row.Step) >= definition.pivot {
+				logger.FromContext(ctx).Warn("Saga timed out past its pivot, leaving it to its pending step", zap.String("sagaId", row.ID), zap.Int32("step", row.Step))
+				continue
+			}
+			logger.FromContext(ctx).Warn("Saga timed out, compensating", zap.String("sagaId", row.ID), zap.Int32("step", row.Step))
+			stepName := ""
+			if int(row.Step) < len(definition.Steps) {
+				stepName = definition.Steps[row.Step].Name
+			}
+			row.Status = consts.SagaStatusCompensating
+			row.LastError = fmt.Sprintf("%s: timed out", stepName)
+			if err := o.compensate(ctx, tx, definition, row, newSagaContext(definition, *row, tx), int(row.Step)-1); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
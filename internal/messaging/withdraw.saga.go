@@ -0,0 +1,192 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+
+	"ecom/global"
+	"ecom/internal/model"
+	"ecom/internal/service"
+	"ecom/internal/vo"
+	consts "ecom/pkg/const"
+	"ecom/pkg/logger"
+	"ecom/pkg/rabbitmq"
+	"ecom/pkg/webhook"
+
+	"go.uber.org/zap"
+)
+
+// withdrawSagaData is the data of a withdrawal saga after its reserve step
+type withdrawSagaData struct {
+	Reservation vo.WithdrawReservation `json:"reservation"`
+	Transaction model.Transaction      `json:"transaction"`
+}
+
+// WithdrawSaga runs a withdrawal as a saga: reserve the amount, charge the fee, pay out through the
+// caller's webhook and complete the transaction. The transaction stays pending until the saga completes
+// and turns failed when it is compensated.
+type WithdrawSaga struct {
+	*SagaOrchestrator
+	withdrawService service.IWithdrawService
+}
+
+func NewWithdrawSaga(orchestrator *SagaOrchestrator, withdrawService service.IWithdrawService) *WithdrawSaga {
+	ws := &WithdrawSaga{
+		SagaOrchestrator: orchestrator,
+		withdrawService:  withdrawService,
+	}
+	orchestrator.Register(SagaDefinition{
+		Type: consts.SagaTypeWithdraw,
+		Steps: []SagaStep{
+			{Name: "reserve", Action: ws.reserve, Compensate: ws.release},
+			{Name: "charge_fee", Action: ws.chargeFee, Compensate: ws.refundFee},
+			{Name: "payout", Action: ws.payout, Pivot: true},
+			{Name: "complete", Action: ws.complete},
+		},
+		OnFinish: ws.finish,
+	})
+	return ws
+}
+
+// Withdraw reserves the withdrawal and returns its pending transaction, the other steps run from the
+// saga queue. A rejected withdrawal returns the error of the service and leaves nothing behind.
+func (ws *WithdrawSaga) Withdraw(ctx context.Context, req *vo.WithdrawRequest) (model.Transaction, error) {
+	saga, err := ws.Begin(ctx, consts.SagaTypeWithdraw, req.TransactionCode, req)
+	if err != nil {
+		return model.Transaction{}, err
+	}
+	var data withdrawSagaData
+	if err := saga.Decode(&data); err != nil {
+		return model.Transaction{}, err
+	}
+	return data.Transaction, nil
+}
+
+func (ws *WithdrawSaga) reserve(ctx context.Context, saga *SagaContext) error {
+	var req vo.WithdrawRequest
+	if err := saga.Decode(&req); err != nil {
+		return err
+	}
+	reservation, transaction, err := ws.withdrawService.ReserveWithdraw(ctx, saga.Tx, &req)
+	if err != nil {
+		return err
+	}
+	return saga.Update(withdrawSagaData{Reservation: reservation, Transaction: transaction})
+}
+
+func (ws *WithdrawSaga) release(ctx context.Context, saga *SagaContext) error {
+	var data withdrawSagaData
+	if err := saga.Decode(&data); err != nil {
+		return rabbitmq.Permanent(err)
+	}
+	return ws.withdrawService.ReleaseWithdraw(ctx, saga.Tx, &data.Reservation)
+}
+
+func (ws *WithdrawSaga) chargeFee(ctx context.Context, saga *SagaContext) error {
+	var data withdrawSagaData
+	if err := saga.Decode(&data); err != nil {
+		return rabbitmq.Permanent(err)
+	}
+	err := ws.withdrawService.ChargeWithdrawFee(ctx, saga.Tx, &data.Reservation)
+	if errors.Is(err, service.ErrInsufficientBalance) {
+		return rabbitmq.Permanent(err)
+	}
+	return err
+}
+
+func (ws *WithdrawSaga) refundFee(ctx context.Context, saga *SagaContext) error {
+	var data withdrawSagaData
+	if err := saga.Decode(&data); err != nil {
+		return rabbitmq.Permanent(err)
+	}
+	return ws.withdrawService.RefundWithdrawFee(ctx, saga.Tx, &data.Reservation)
+}
+
+// payout hands the withdrawal to the caller's webhook with the pending transaction, a failing webhook
+// is retried and the withdrawal compensated once the retries are used up. It is the pivot of the saga:
+// it runs outside the saga transaction and once it succeeded the withdrawal is never refunded. The
+// caller is told about the success once the transaction is completed.
+func (ws *WithdrawSaga) payout(ctx context.Context, saga *SagaContext) error {
+	var data withdrawSagaData
+	if err := saga.Decode(&data); err != nil {
+		return rabbitmq.Permanent(err)
+	}
+	req := data.Reservation.Request
+	if req.WebhookUrl == "" {
+		return nil
+	}
+	return webhook.CallWebhookWithEncryption(req.WebhookUrl, webhook.WebhookData{
+		Status: data.Transaction.Status,
+		DataRequest: webhook.DataRequest{
+			TransactionCode: req.TransactionCode,
+			UserID:          req.UserID,
+		},
+		DataResponse: data.Transaction,
+	}, global.Config.Security.CryptoKeys.Symmetric.AESKey, global.SecurityService)
+}
+
+func (ws *WithdrawSaga) complete(ctx context.Context, saga *SagaContext) error {
+	var data withdrawSagaData
+	if err := saga.Decode(&data); err != nil {
+		return rabbitmq.Permanent(err)
+	}
+	transaction, err := ws.withdrawService.CompleteWithdraw(ctx, saga.Tx, &data.Reservation)
+	if err != nil {
+		return err
+	}
+	data.Transaction = transaction
+	return saga.Update(data)
+}
+
+// finish tells the caller about a completed withdrawal, or fails the transaction of a compensated or
+// failed withdrawal and tells the caller. A failed saga could not undo all its steps, the wallet needs
+// a manual correction. A saga failing after the payout paid the user, its transaction is left pending
+// for the manual completion.
+func (ws *WithdrawSaga) finish(ctx context.Context, saga *SagaContext) error {
+	if saga.Status == consts.SagaStatusCompleted {
+		var data withdrawSagaData
+		if err := saga.Decode(&data); err != nil {
+			return err
+		}
+		ws.notify(ctx, data.Reservation.Request, data.Transaction.Status, data.Transaction)
+		return nil
+	}
+	if saga.Committed {
+		logger.FromContext(ctx).Error("Withdraw saga failed after the payout",
+			zap.String("sagaId", saga.ID), zap.String("transactionCode", saga.Reference), zap.String("error", saga.Error))
+		return nil
+	}
+	var data withdrawSagaData
+	if err := saga.Decode(&data); err != nil {
+		return err
+	}
+	if saga.Status == consts.SagaStatusFailed {
+		logger.FromContext(ctx).Error("Withdraw saga failed to compensate",
+			zap.String("sagaId", saga.ID), zap.String("transactionCode", saga.Reference), zap.String("error", saga.Error))
+	}
+	if err := ws.withdrawService.FailWithdraw(ctx, saga.Tx, &data.Reservation); err != nil {
+		return err
+	}
+	ws.notify(ctx, data.Reservation.Request, consts.TransactionStatusFailed, saga.Error)
+	return nil
+}
+
+// notify calls the caller's webhook with the final status of the withdrawal in the background
+func (ws *WithdrawSaga) notify(ctx context.Context, req vo.WithdrawRequest, status string, response interface{}) {
+	if req.WebhookUrl == "" {
+		return
+	}
+	go func() {
+		err := webhook.CallWebhookWithEncryption(req.WebhookUrl, webhook.WebhookData{
+			Status: status,
+			DataRequest: webhook.DataRequest{
+				TransactionCode: req.TransactionCode,
+				UserID:          req.UserID,
+			},
+			DataResponse: response,
+		}, global.Config.Security.CryptoKeys.Symmetric.AESKey, global.SecurityService)
+		if err != nil {
+			logger.FromContext(ctx).Error("Call webhook failed", zap.String("url", req.WebhookUrl), zap.String("transactionCode", req.TransactionCode), zap.Error(err))
+		}
+	}()
+}
@@ -1,9 +1,43 @@
 package middlewares
 
-import "github.com/gin-gonic/gin"
+import (
+	"fmt"
+	"runtime/debug"
 
+	"ecom/pkg/logger"
+	"ecom/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ErrorHandlerMiddleware renders the last error a handler reported with c.Error into the envelope with
+// its HTTP status, see response.AppError, when the handler wrote no response itself. Errors that are not
+// an AppError become a 500 without their message. A panic is logged with its stack and answered with a
+// 500 as well.
 func ErrorHandlerMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.FromContext(c.Request.Context()).Error("Recovered from panic",
+					zap.String("panic", fmt.Sprint(r)), zap.ByteString("stack", debug.Stack()))
+				if c.Writer.Written() {
+					c.Abort()
+					return
+				}
+				response.AbortWithAppError(c, response.ErrInternal)
+			}
+		}()
+
 		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+		appErr := response.AsAppError(c.Errors.Last().Err)
+		if appErr.Status >= 500 {
+			logger.FromContext(c.Request.Context()).Error("Request failed", zap.String("errorCode", appErr.Code), zap.Error(appErr))
+		}
+		response.AbortWithAppError(c, appErr)
 	}
-}
\ No newline at end of file
+}
@@ -1,9 +1,65 @@
 package middlewares
 
-import "github.com/gin-gonic/gin"
+import (
+	"time"
 
+	"ecom/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	// HeaderRequestID identifies a request across the services, it is generated when the caller sends none
+	HeaderRequestID = "X-Request-ID"
+	// ContextKeyRequestID is the request id in the gin context
+	ContextKeyRequestID = "requestId"
+	// maxRequestIDLength bounds the request ids taken from callers
+	maxRequestIDLength = 128
+)
+
+// LoggerMiddleware propagates or generates the X-Request-ID of the request, puts a logger tagged with
+// it into the request context, see logger.FromContext, and writes the access log once the request is
+// served. The request id is the correlation id of the messages the request publishes.
 func LoggerMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		start := time.Now()
+		requestID := c.GetHeader(HeaderRequestID)
+		if requestID == "" || len(requestID) > maxRequestIDLength {
+			requestID = uuid.NewString()
+		}
+		c.Set(ContextKeyRequestID, requestID)
+		c.Header(HeaderRequestID, requestID)
+		c.Request = c.Request.WithContext(logger.WithCorrelationID(c.Request.Context(), requestID))
+
 		c.Next()
+
+		status := c.Writer.Status()
+		fields := []zap.Field{
+			zap.String("method", c.Request.Method),
+			zap.String("route", c.FullPath()),
+			zap.String("path", c.Request.URL.Path),
+			zap.Int("status", status),
+			zap.Duration("latency", time.Since(start)),
+			zap.String("clientIp", c.ClientIP()),
+			zap.Int("bytes", c.Writer.Size()),
+		}
+		if userID := c.GetString(ContextKeyUserID); userID != "" {
+			fields = append(fields, zap.String("userId", userID))
+		}
+		if len(c.Errors) > 0 {
+			fields = append(fields, zap.String("errors", c.Errors.String()))
+		}
+		// the request context, AuthMiddleware may have tagged its logger with the caller
+		l := logger.FromContext(c.Request.Context())
+		switch {
+		case status >= 500:
+			l.Error("Request served", fields...)
+		case status >= 400:
+			l.Warn("Request served", fields...)
+		default:
+			l.Info("Request served", fields...)
+		}
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,58 @@
+package middlewares
+
+import (
+	consts "ecom/pkg/const"
+	"ecom/pkg/response"
+	"ecom/pkg/token"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Policy is what a route group requires of the caller: one of Roles when any are set, and every one of
+// Scopes. The consts.RoleAdmin role passes every policy.
+type Policy struct {
+	Roles  []string
+	Scopes []string
+}
+
+// Allows reports whether claims satisfy the policy
+func (p Policy) Allows(claims *token.Claims) bool {
+	if claims == nil {
+		return false
+	}
+	if claims.HasRole(consts.RoleAdmin) {
+		return true
+	}
+	if len(p.Roles) > 0 {
+		granted := false
+		for _, role := range p.Roles {
+			if claims.HasRole(role) {
+				granted = true
+				break
+			}
+		}
+		if !granted {
+			return false
+		}
+	}
+	for _, scope := range p.Scopes {
+		if !claims.HasScope(scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// Authorize aborts the requests whose claims do not satisfy policy with a 403 AppError, it runs after
+// AuthMiddleware
+func Authorize(policy Policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, _ := ClaimsOf(c)
+		if !policy.Allows(claims) {
+			c.Error(response.ErrForbidden)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -1,9 +1,142 @@
 package middlewares
 
-import "github.com/gin-gonic/gin"
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
 
+	"ecom/global"
+	"ecom/pkg/logger"
+	"ecom/pkg/ratelimit"
+	"ecom/pkg/response"
+	"ecom/pkg/setting"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// rateLimitRule is a setting.RateLimitRule ready to match requests
+type rateLimitRule struct {
+	name   string
+	routes map[string]bool
+	by     []string
+	limit  ratelimit.Limit
+}
+
+func (r rateLimitRule) matches(route string) bool {
+	return len(r.routes) == 0 || r.routes[route]
+}
+
+// key builds the key of the request under the rule. A missing user falls back to the client ip so
+// anonymous callers do not share one quota. The project is the one the token was issued to, the request
+// itself cannot be trusted to name it, and the rule does not apply without one: ok is false.
+func (r rateLimitRule) key(c *gin.Context) (string, bool) {
+	parts := []string{"ratelimit", r.name}
+	for _, by := range r.by {
+		switch by {
+		case "user":
+			if userID := c.GetString(ContextKeyUserID); userID != "" {
+				parts = append(parts, "user="+userID)
+				continue
+			}
+		case "project":
+			claims, ok := ClaimsOf(c)
+			if !ok || claims.Project == "" {
+				return "", false
+			}
+			parts = append(parts, "project="+claims.Project)
+			continue
+		case "route":
+			parts = append(parts, "route="+c.Request.Method+" "+c.FullPath())
+			continue
+		}
+		parts = append(parts, "ip="+c.ClientIP())
+	}
+	return strings.Join(parts, ":"), true
+}
+
+func newRateLimitRules(settings []setting.RateLimitRule) []rateLimitRule {
+	rules := make([]rateLimitRule, 0, len(settings))
+	for _, s := range settings {
+		if s.Limit <= 0 || s.PeriodSec <= 0 {
+			continue
+		}
+		rule := rateLimitRule{
+			name:  s.Name,
+			by:    s.By,
+			limit: ratelimit.Limit{Rate: s.Limit, Period: time.Duration(s.PeriodSec) * time.Second},
+		}
+		if len(rule.by) == 0 {
+			rule.by = []string{"ip"}
+		}
+		if len(s.Routes) > 0 {
+			rule.routes = make(map[string]bool, len(s.Routes))
+			for _, route := range s.Routes {
+				rule.routes[route] = true
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// RateLimitMiddleware checks the request against the rate_limit rules matching its route with
+// global.RateLimiter and answers 429 when one of them is exhausted. The RateLimit-* headers report the
+// most constrained rule. It runs after AuthMiddleware for the rules keyed by user.
 func RateLimitMiddleware() gin.HandlerFunc {
+	rules := newRateLimitRules(global.Config.RateLimit.Rules)
 	return func(c *gin.Context) {
+		var tightest *ratelimit.Result
+		route := c.FullPath()
+		for _, rule := range rules {
+			if !rule.matches(route) {
+				continue
+			}
+			key, ok := rule.key(c)
+			if !ok {
+				continue
+			}
+			res, err := global.RateLimiter.Allow(c.Request.Context(), key, rule.limit)
+			if err != nil {
+				logger.FromContext(c.Request.Context()).Error("Failed to check rate limit", zap.String("rule", rule.name), zap.Error(err))
+				continue
+			}
+			if tightest == nil || tighter(res, *tightest) {
+				tightest = &res
+			}
+		}
+		if tightest == nil {
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(tightest.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(tightest.Remaining))
+		c.Header("RateLimit-Reset", seconds(tightest.ResetAfter))
+		if !tightest.Allowed {
+			c.Header("Retry-After", seconds(tightest.RetryAfter))
+			c.Error(response.ErrTooManyRequests)
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
-}
\ No newline at end of file
+}
+
+// tighter reports whether a constrains the caller more than b: it is denied for longer, or allows fewer
+// requests
+func tighter(a, b ratelimit.Result) bool {
+	if a.Allowed != b.Allowed {
+		return !a.Allowed
+	}
+	if !a.Allowed {
+		return a.RetryAfter > b.RetryAfter
+	}
+	return a.Remaining < b.Remaining
+}
+
+// seconds formats d in whole seconds rounded up, the unit of the rate limit headers
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
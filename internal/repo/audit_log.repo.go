@@ -0,0 +1,33 @@
+package repo
+
+import (
+	"ecom/global"
+	"ecom/internal/model"
+
+	"gorm.io/gorm"
+)
+
+type IAuditLogRepository interface {
+	WithTx(tx *gorm.DB) IAuditLogRepository
+	CreateAuditLog(log *model.AuditLog) error
+}
+
+type auditLogRepository struct {
+	db *gorm.DB
+}
+
+func NewAuditLogRepository() IAuditLogRepository {
+	return &auditLogRepository{
+		db: global.Pdb,
+	}
+}
+
+func (r *auditLogRepository) WithTx(tx *gorm.DB) IAuditLogRepository {
+	return &auditLogRepository{
+		db: tx,
+	}
+}
+
+func (r *auditLogRepository) CreateAuditLog(log *model.AuditLog) error {
+	return r.db.Create(log).Error
+}
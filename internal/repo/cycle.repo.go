@@ -7,6 +7,7 @@ import (
 
 type ICycleRepository interface {
 	GetCycleById(id int32) (model.Cycle, error)
+	GetCyclesByIds(ids []int32) ([]model.Cycle, error)
 }
 
 type cycleRepository struct {
@@ -25,3 +26,15 @@ func (r *cycleRepository) GetCycleById(id int32) (model.Cycle, error) {
 	}
 	return cycle, nil
 }
+
+func (r *cycleRepository) GetCyclesByIds(ids []int32) ([]model.Cycle, error) {
+	var cycles []model.Cycle
+	if len(ids) == 0 {
+		return cycles, nil
+	}
+	err := global.PdbSetting.Select("id, key, value").Where("id IN ?", ids).Find(&cycles).Error
+	if err != nil {
+		return nil, err
+	}
+	return cycles, nil
+}
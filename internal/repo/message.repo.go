@@ -0,0 +1,106 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"ecom/global"
+	"ecom/pkg/rabbitmq"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	messageSequenceKey = "msg:seq:"
+	messageAppliedKey  = "msg:applied:"
+	messageDoneKey     = "msg:done:"
+	messageLockKey     = "msg:lock:"
+	// messageDoneTTL is how long a duplicate still gets the stored response back
+	messageDoneTTL = 7 * 24 * time.Hour
+)
+
+// releaseLockScript deletes a lock only if it is still held by the same token
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// IMessageRepository keeps the per-key sequence numbers and the processed messages in Redis
+type IMessageRepository interface {
+	// NextSequence returns the next publish sequence number of a key, starting at 1
+	NextSequence(ctx context.Context, key string) (int64, error)
+	// AcquireKeyLock takes the processing lock of a key, it returns false when another consumer holds it
+	AcquireKeyLock(ctx context.Context, key, token string, ttl time.Duration) (bool, error)
+	ReleaseKeyLock(ctx context.Context, key, token string) error
+	// GetResponse returns the stored response of a processed message, nil when it was not processed
+	GetResponse(ctx context.Context, messageID string) (*rabbitmq.QueueResponse, error)
+	// GetAppliedSequence returns the sequence number of the last message of a key processed, 0 when none
+	GetAppliedSequence(ctx context.Context, key string) (int64, error)
+	// SaveResult stores the response of a message and advances the applied sequence of its key
+	SaveResult(ctx context.Context, messageID, key string, sequence int64, response rabbitmq.QueueResponse) error
+}
+
+type messageRepository struct {
+	rdb *redis.Client
+}
+
+func NewMessageRepository() IMessageRepository {
+	return &messageRepository{
+		rdb: global.Rdb,
+	}
+}
+
+func (r *messageRepository) NextSequence(ctx context.Context, key string) (int64, error) {
+	return r.rdb.Incr(ctx, messageSequenceKey+key).Result()
+}
+
+func (r *messageRepository) AcquireKeyLock(ctx context.Context, key, token string, ttl time.Duration) (bool, error) {
+	return r.rdb.SetNX(ctx, messageLockKey+key, token, ttl).Result()
+}
+
+func (r *messageRepository) ReleaseKeyLock(ctx context.Context, key, token string) error {
+	return releaseLockScript.Run(ctx, r.rdb, []string{messageLockKey + key}, token).Err()
+}
+
+func (r *messageRepository) GetResponse(ctx context.Context, messageID string) (*rabbitmq.QueueResponse, error) {
+	data, err := r.rdb.Get(ctx, messageDoneKey+messageID).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var response rabbitmq.QueueResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+func (r *messageRepository) GetAppliedSequence(ctx context.Context, key string) (int64, error) {
+	sequence, err := r.rdb.Get(ctx, messageAppliedKey+key).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return sequence, err
+}
+
+func (r *messageRepository) SaveResult(ctx context.Context, messageID, key string, sequence int64, response rabbitmq.QueueResponse) error {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	_, err = r.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if messageID != "" {
+			pipe.Set(ctx, messageDoneKey+messageID, data, messageDoneTTL)
+		}
+		if sequence > 0 {
+			pipe.Set(ctx, messageAppliedKey+key, sequence, 0)
+		}
+		return nil
+	})
+	return err
+}
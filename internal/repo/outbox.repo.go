@@ -0,0 +1,74 @@
+package repo
+
+import (
+	"ecom/global"
+	"ecom/internal/model"
+	consts "ecom/pkg/const"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IOutboxRepository interface {
+	WithTx(tx *gorm.DB) IOutboxRepository
+	CreateEvent(event *model.OutboxEvent) error
+	LockPendingEvents(limit int) ([]model.OutboxEvent, error)
+	MarkEventSent(id string, sentAt time.Time) error
+	MarkEventFailed(id string, lastError string, availableAt time.Time) error
+}
+
+type outboxRepository struct {
+	db *gorm.DB
+}
+
+func NewOutboxRepository() IOutboxRepository {
+	return &outboxRepository{
+		db: global.Pdb,
+	}
+}
+
+func (r *outboxRepository) WithTx(tx *gorm.DB) IOutboxRepository {
+	return &outboxRepository{
+		db: tx,
+	}
+}
+
+func (r *outboxRepository) CreateEvent(event *model.OutboxEvent) error {
+	return r.db.Create(event).Error
+}
+
+// LockPendingEvents locks the oldest events due for publishing, rows locked by another relay are skipped.
+// It must run inside a transaction, the locks are held until it ends.
+func (r *outboxRepository) LockPendingEvents(limit int) ([]model.OutboxEvent, error) {
+	var events []model.OutboxEvent
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("status = ? AND available_at <= ?", consts.OutboxStatusPending, time.Now()).
+		Order("available_at, created_at").
+		Limit(limit).
+		Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (r *outboxRepository) MarkEventSent(id string, sentAt time.Time) error {
+	return r.db.Model(&model.OutboxEvent{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":  consts.OutboxStatusSent,
+			"sent_at": sentAt,
+		}).Error
+}
+
+// MarkEventFailed records a failed publish and postpones the next attempt until availableAt
+func (r *outboxRepository) MarkEventFailed(id string, lastError string, availableAt time.Time) error {
+	return r.db.Model(&model.OutboxEvent{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"attempts":     gorm.Expr("attempts + 1"),
+			"last_error":   lastError,
+			"available_at": availableAt,
+		}).Error
+}
@@ -0,0 +1,29 @@
+package repo
+
+import (
+	"ecom/global"
+	"ecom/internal/model"
+)
+
+type IPlatformInterestRateRepository interface {
+	GetPlatformInterestRatesByIds(ids []int32) ([]model.PlatformInterestRate, error)
+}
+
+type platformInterestRateRepository struct {
+}
+
+func NewPlatformInterestRateRepository() IPlatformInterestRateRepository {
+	return &platformInterestRateRepository{}
+}
+
+func (r *platformInterestRateRepository) GetPlatformInterestRatesByIds(ids []int32) ([]model.PlatformInterestRate, error) {
+	var rates []model.PlatformInterestRate
+	if len(ids) == 0 {
+		return rates, nil
+	}
+	err := global.PdbSetting.Where("id IN ?", ids).Order("sort").Find(&rates).Error
+	if err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
@@ -0,0 +1,36 @@
+package repo
+
+import (
+	"ecom/global"
+	"ecom/internal/model"
+)
+
+type IProjectRepository interface {
+	GetProjectByWalletIntegration(walletIntegrationID int32) (model.Project, error)
+	GetProjectBySlug(slug string) (model.Project, error)
+}
+
+type projectRepository struct {
+}
+
+func NewProjectRepository() IProjectRepository {
+	return &projectRepository{}
+}
+
+func (r *projectRepository) GetProjectByWalletIntegration(walletIntegrationID int32) (model.Project, error) {
+	project := model.Project{}
+	err := global.PdbSetting.Where("wallet_integrations = ?", walletIntegrationID).Order("sort").First(&project).Error
+	if err != nil {
+		return model.Project{}, err
+	}
+	return project, nil
+}
+
+func (r *projectRepository) GetProjectBySlug(slug string) (model.Project, error) {
+	project := model.Project{}
+	err := global.PdbSetting.Where("slug = ?", slug).First(&project).Error
+	if err != nil {
+		return model.Project{}, err
+	}
+	return project, nil
+}
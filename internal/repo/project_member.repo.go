@@ -0,0 +1,33 @@
+package repo
+
+import (
+	"ecom/global"
+	"ecom/internal/model"
+
+	"gorm.io/gorm"
+)
+
+type IProjectMemberRepository interface {
+	IsProjectMember(projectID int32, userID string) (bool, error)
+}
+
+type projectMemberRepository struct {
+	db *gorm.DB
+}
+
+func NewProjectMemberRepository() IProjectMemberRepository {
+	return &projectMemberRepository{
+		db: global.Pdb,
+	}
+}
+
+func (r *projectMemberRepository) IsProjectMember(projectID int32, userID string) (bool, error) {
+	var count int64
+	err := r.db.Model(&model.ProjectMember{}).
+		Where("project_id = ? AND user_id = ?", projectID, userID).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
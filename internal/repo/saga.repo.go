@@ -0,0 +1,88 @@
+package repo
+
+import (
+	"ecom/global"
+	"ecom/internal/model"
+	consts "ecom/pkg/const"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ISagaRepository interface {
+	WithTx(tx *gorm.DB) ISagaRepository
+	CreateSaga(saga *model.Saga) error
+	GetSaga(id string) (model.Saga, error)
+	// LockSaga reads a saga and locks it until the transaction ends
+	LockSaga(id string) (model.Saga, error)
+	UpdateSaga(saga *model.Saga) error
+	LockTimedOutSagas(limit int) ([]model.Saga, error)
+}
+
+type sagaRepository struct {
+	db *gorm.DB
+}
+
+func NewSagaRepository() ISagaRepository {
+	return &sagaRepository{
+		db: global.Pdb,
+	}
+}
+
+func (r *sagaRepository) WithTx(tx *gorm.DB) ISagaRepository {
+	return &sagaRepository{
+		db: tx,
+	}
+}
+
+func (r *sagaRepository) CreateSaga(saga *model.Saga) error {
+	return r.db.Create(saga).Error
+}
+
+func (r *sagaRepository) GetSaga(id string) (model.Saga, error) {
+	saga := model.Saga{}
+	err := r.db.Where("id = ?", id).First(&saga).Error
+	if err != nil {
+		return model.Saga{}, err
+	}
+	return saga, nil
+}
+
+func (r *sagaRepository) LockSaga(id string) (model.Saga, error) {
+	saga := model.Saga{}
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ?", id).
+		First(&saga).Error
+	if err != nil {
+		return model.Saga{}, err
+	}
+	return saga, nil
+}
+
+func (r *sagaRepository) UpdateSaga(saga *model.Saga) error {
+	return r.db.Model(&model.Saga{}).
+		Where("id = ?", saga.ID).
+		Updates(map[string]interface{}{
+			"status":     saga.Status,
+			"step":       saga.Step,
+			"data":       saga.Data,
+			"last_error": saga.LastError,
+			"updated_at": saga.UpdatedAt,
+		}).Error
+}
+
+// LockTimedOutSagas locks the running sagas past their timeout, sagas whose step is running right now
+// hold their lock and are skipped. It must run inside a transaction.
+func (r *sagaRepository) LockTimedOutSagas(limit int) ([]model.Saga, error) {
+	var sagas []model.Saga
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("status = ? AND timeout_at <= ?", consts.SagaStatusRunning, time.Now()).
+		Order("timeout_at").
+		Limit(limit).
+		Find(&sagas).Error
+	if err != nil {
+		return nil, err
+	}
+	return sagas, nil
+}
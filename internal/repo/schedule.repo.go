@@ -0,0 +1,46 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"ecom/global"
+	"ecom/pkg/rabbitmq"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	messageScheduledKey = "msg:scheduled:"
+	// scheduleGrace keeps a pending schedule past its delivery time for a scheduler that was down
+	scheduleGrace = 24 * time.Hour
+)
+
+// IScheduleRepository keeps the pending scheduled messages of the RabbitMQ scheduler in Redis
+type IScheduleRepository interface {
+	rabbitmq.ScheduleStore
+}
+
+type scheduleRepository struct {
+	rdb *redis.Client
+}
+
+func NewScheduleRepository() IScheduleRepository {
+	return &scheduleRepository{
+		rdb: global.Rdb,
+	}
+}
+
+func (r *scheduleRepository) AddSchedule(ctx context.Context, id string, at time.Time) error {
+	return r.rdb.Set(ctx, messageScheduledKey+id, at.UnixMilli(), time.Until(at)+scheduleGrace).Err()
+}
+
+func (r *scheduleRepository) IsSchedulePending(ctx context.Context, id string) (bool, error) {
+	n, err := r.rdb.Exists(ctx, messageScheduledKey+id).Result()
+	return n > 0, err
+}
+
+func (r *scheduleRepository) RemoveSchedule(ctx context.Context, id string) (bool, error) {
+	n, err := r.rdb.Del(ctx, messageScheduledKey+id).Result()
+	return n > 0, err
+}
@@ -0,0 +1,44 @@
+package repo
+
+import (
+	"ecom/global"
+)
+
+// settingTables are the tables an interest setting is built from
+var settingTables = []string{
+	"wallet_integrations",
+	"wallet_integration_currencies",
+	"platform_interest_rates",
+	"cycle",
+	"project",
+	"transaction_type",
+	"currency",
+}
+
+type ISettingRepository interface {
+	GetSettingVersion() (string, error)
+}
+
+type settingRepository struct {
+}
+
+func NewSettingRepository() ISettingRepository {
+	return &settingRepository{}
+}
+
+// GetSettingVersion returns a hash of every row of the setting tables, it changes whenever a row
+// is inserted, updated or deleted. The tables are small so hashing them is cheaper than a stale cache.
+func (r *settingRepository) GetSettingVersion() (string, error) {
+	query := "SELECT md5(concat_ws('|'"
+	for _, table := range settingTables {
+		query += ", (SELECT string_agg(t::text, ',' ORDER BY t.id) FROM " + table + " t)"
+	}
+	query += "))"
+
+	var version string
+	err := global.PdbSetting.Raw(query).Scan(&version).Error
+	if err != nil {
+		return "", err
+	}
+	return version, nil
+}
@@ -5,14 +5,15 @@ import (
 	"database/sql"
 	"ecom/global"
 	"ecom/internal/database"
+	"ecom/pkg/money"
 	"errors"
-	"fmt"
-	"strconv"
 
 	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
+const testBalanceScale = 2
+
 type ITestRepository interface {
 	GetTestById(id uuid.UUID) (database.Test, error)
 	CreateTest(req *database.CreateTestParams) (database.Test, error)
@@ -48,7 +49,6 @@ func (r *testRepository) CreateTest(req *database.CreateTestParams) (database.Te
 func (r *testRepository) UpdateTest(req *database.UpdateTestParams) (database.Test, error) {
 	// check if id is exist
 	id := uuid.MustParse(req.ID.String())
-	fmt.Println("id", id)
 	test, err := r.sqlc.GetTestById(context.Background(), id)
 	if err != nil {
 		global.Logger.Error("GetTestById", zap.Error(err))
@@ -58,19 +58,20 @@ func (r *testRepository) UpdateTest(req *database.UpdateTestParams) (database.Te
 		global.Logger.Error("GetTestById", zap.Error(errors.New("id not found")))
 		return database.Test{}, errors.New("id not found")
 	}
-	balance, err := strconv.ParseFloat(test.Balance.String, 64)
+	balance, err := money.Parse(test.Balance.String)
 	if err != nil {
-		global.Logger.Error("ParseFloat", zap.Error(err))
+		global.Logger.Error("Parse balance", zap.Error(err))
 		return database.Test{}, err
 	}
-	balanceFloat, err := strconv.ParseFloat(req.Balance.String, 64)
+	amount, err := money.Parse(req.Balance.String)
 	if err != nil {
-		global.Logger.Error("ParseFloat", zap.Error(err))
+		global.Logger.Error("Parse balance", zap.Error(err))
 		return database.Test{}, err
 	}
-	balance += balanceFloat
+	// test.balance is a decimal(10, 2) column
+	balance = balance.Add(amount).Round(testBalanceScale, money.RoundHalfEven)
 	req.Balance = sql.NullString{
-		String: strconv.FormatFloat(balance, 'f', -1, 64),
+		String: balance.StringFixed(testBalanceScale),
 		Valid:  true,
 	}
 	order, err := r.sqlc.UpdateTest(context.Background(), *req)
@@ -0,0 +1,53 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"ecom/global"
+	"ecom/pkg/token"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const tokenIntrospectionKey = "token:introspection:"
+
+// ITokenRepository caches the claims of introspected tokens in Redis
+type ITokenRepository interface {
+	token.IntrospectionCache
+}
+
+type tokenRepository struct {
+	rdb *redis.Client
+}
+
+func NewTokenRepository() ITokenRepository {
+	return &tokenRepository{
+		rdb: global.Rdb,
+	}
+}
+
+func (r *tokenRepository) GetClaims(ctx context.Context, key string) (*token.Claims, bool, error) {
+	data, err := r.rdb.Get(ctx, tokenIntrospectionKey+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	claims := &token.Claims{}
+	if err := json.Unmarshal(data, claims); err != nil {
+		return nil, false, err
+	}
+	return claims, true, nil
+}
+
+func (r *tokenRepository) SetClaims(ctx context.Context, key string, claims *token.Claims, ttl time.Duration) error {
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return err
+	}
+	return r.rdb.Set(ctx, tokenIntrospectionKey+key, data, ttl).Err()
+}
@@ -0,0 +1,70 @@
+package repo
+
+import (
+	"ecom/global"
+	"ecom/internal/model"
+	consts "ecom/pkg/const"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ITransactionRepository interface {
+	WithTx(tx *gorm.DB) ITransactionRepository
+	CreateTransaction(transaction *model.Transaction) error
+	GetTransactionByCode(code string) (model.Transaction, error)
+	UpdateTransactionStatus(id string, status string, dateUpdated time.Time) error
+	CountTransactionsSince(userID string, providerKey string, transactionType string, since time.Time) (int64, error)
+}
+
+type transactionRepository struct {
+	db *gorm.DB
+}
+
+func NewTransactionRepository() ITransactionRepository {
+	return &transactionRepository{
+		db: global.Pdb,
+	}
+}
+
+func (r *transactionRepository) WithTx(tx *gorm.DB) ITransactionRepository {
+	return &transactionRepository{
+		db: tx,
+	}
+}
+
+func (r *transactionRepository) CreateTransaction(transaction *model.Transaction) error {
+	return r.db.Create(transaction).Error
+}
+
+func (r *transactionRepository) GetTransactionByCode(code string) (model.Transaction, error) {
+	transaction := model.Transaction{}
+	err := r.db.Where("code = ?", code).First(&transaction).Error
+	if err != nil {
+		return model.Transaction{}, err
+	}
+	return transaction, nil
+}
+
+func (r *transactionRepository) UpdateTransactionStatus(id string, status string, dateUpdated time.Time) error {
+	return r.db.Model(&model.Transaction{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":       status,
+			"date_updated": dateUpdated,
+		}).Error
+}
+
+// CountTransactionsSince counts the transactions of one type a user made on a provider since the given
+// time, the pending ones included and the failed ones left out. The provider key is read from the details column.
+func (r *transactionRepository) CountTransactionsSince(userID string, providerKey string, transactionType string, since time.Time) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.Transaction{}).
+		Where("user_id = ? AND transaction_type = ? AND status <> ?", userID, transactionType, consts.TransactionStatusFailed).
+		Where("details->>'providerKey' = ? AND date_created >= ?", providerKey, since).
+		Count(&count).Error
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
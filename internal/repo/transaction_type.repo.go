@@ -0,0 +1,26 @@
+package repo
+
+import (
+	"ecom/global"
+	"ecom/internal/model"
+)
+
+type ITransactionTypeRepository interface {
+	GetAllTransactionType() ([]model.TransactionType, error)
+}
+
+type transactionTypeRepository struct {
+}
+
+func NewTransactionTypeRepository() ITransactionTypeRepository {
+	return &transactionTypeRepository{}
+}
+
+func (r *transactionTypeRepository) GetAllTransactionType() ([]model.TransactionType, error) {
+	var transactionTypes []model.TransactionType
+	err := global.PdbSetting.Find(&transactionTypes).Error
+	if err != nil {
+		return nil, err
+	}
+	return transactionTypes, nil
+}
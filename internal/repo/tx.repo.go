@@ -0,0 +1,14 @@
+package repo
+
+import (
+	"context"
+	"ecom/global"
+
+	"gorm.io/gorm"
+)
+
+// RunInTx runs fn inside a single database transaction on the core database.
+// Repositories that take part in the transaction must be bound with WithTx(tx).
+func RunInTx(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	return global.Pdb.WithContext(ctx).Transaction(fn)
+}
@@ -0,0 +1,82 @@
+package repo
+
+import (
+	"ecom/global"
+	"ecom/internal/model"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+type IWalletRepository interface {
+	WithTx(tx *gorm.DB) IWalletRepository
+	LockWallet(userID string, providerKey string, currency string) error
+	GetWallet(userID string, providerKey string, currency string) (model.Wallet, error)
+	GetWalletsByUser(userID string, providerKey string) ([]model.Wallet, error)
+	GetUserIDsByProviderKey(providerKey string) ([]string, error)
+	CreateWallet(wallet *model.Wallet) error
+	UpdateWallet(wallet *model.Wallet) error
+}
+
+type walletRepository struct {
+	db *gorm.DB
+}
+
+func NewWalletRepository() IWalletRepository {
+	return &walletRepository{
+		db: global.Pdb,
+	}
+}
+
+func (r *walletRepository) WithTx(tx *gorm.DB) IWalletRepository {
+	return &walletRepository{
+		db: tx,
+	}
+}
+
+// LockWallet takes a transaction scoped advisory lock on the wallet key, so
+// concurrent balance changes (and the first insert) for the same wallet are serialized.
+// It must be called inside a transaction.
+func (r *walletRepository) LockWallet(userID string, providerKey string, currency string) error {
+	key := fmt.Sprintf("wallet:%s:%s:%s", userID, providerKey, currency)
+	return r.db.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", key).Error
+}
+
+func (r *walletRepository) GetWallet(userID string, providerKey string, currency string) (model.Wallet, error) {
+	wallet := model.Wallet{}
+	err := r.db.Where("user_id = ? AND provider_key = ? AND currency = ?", userID, providerKey, currency).First(&wallet).Error
+	if err != nil {
+		return model.Wallet{}, err
+	}
+	return wallet, nil
+}
+
+func (r *walletRepository) GetWalletsByUser(userID string, providerKey string) ([]model.Wallet, error) {
+	var wallets []model.Wallet
+	err := r.db.Where("user_id = ? AND provider_key = ?", userID, providerKey).Find(&wallets).Error
+	if err != nil {
+		return nil, err
+	}
+	return wallets, nil
+}
+
+// GetUserIDsByProviderKey returns every user holding at least one wallet on the provider
+func (r *walletRepository) GetUserIDsByProviderKey(providerKey string) ([]string, error) {
+	var userIDs []string
+	err := r.db.Model(&model.Wallet{}).Where("provider_key = ?", providerKey).Distinct().Pluck("user_id", &userIDs).Error
+	if err != nil {
+		return nil, err
+	}
+	return userIDs, nil
+}
+
+func (r *walletRepository) CreateWallet(wallet *model.Wallet) error {
+	return r.db.Create(wallet).Error
+}
+
+func (r *walletRepository) UpdateWallet(wallet *model.Wallet) error {
+	// select the columns explicitly so zero values (is_new = false) are written too
+	return r.db.Model(wallet).
+		Select("balance", "amount_interest", "time_deposit", "last_time_update", "is_new", "date_updated").
+		Updates(wallet).Error
+}
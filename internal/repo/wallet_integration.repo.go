@@ -0,0 +1,37 @@
+package repo
+
+import (
+	"ecom/global"
+	"ecom/internal/model"
+	consts "ecom/pkg/const"
+)
+
+type IWalletIntegrationRepository interface {
+	GetWalletIntegrationByKey(key string) (model.WalletIntegration, error)
+	GetAllWalletIntegration() ([]model.WalletIntegration, error)
+}
+
+type walletIntegrationRepository struct {
+}
+
+func NewWalletIntegrationRepository() IWalletIntegrationRepository {
+	return &walletIntegrationRepository{}
+}
+
+func (r *walletIntegrationRepository) GetWalletIntegrationByKey(key string) (model.WalletIntegration, error) {
+	walletIntegration := model.WalletIntegration{}
+	err := global.PdbSetting.Where("key = ? AND status = ?", key, consts.SettingStatusPublished).First(&walletIntegration).Error
+	if err != nil {
+		return model.WalletIntegration{}, err
+	}
+	return walletIntegration, nil
+}
+
+func (r *walletIntegrationRepository) GetAllWalletIntegration() ([]model.WalletIntegration, error) {
+	var walletIntegrations []model.WalletIntegration
+	err := global.PdbSetting.Where("status = ?", consts.SettingStatusPublished).Order("sort").Find(&walletIntegrations).Error
+	if err != nil {
+		return nil, err
+	}
+	return walletIntegrations, nil
+}
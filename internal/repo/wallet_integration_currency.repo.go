@@ -0,0 +1,49 @@
+package repo
+
+import (
+	"ecom/global"
+	"ecom/internal/model"
+)
+
+type IWalletIntegrationCurrencyRepository interface {
+	GetCurrenciesByType(walletIntegrationID int32, currencyType string) ([]model.Currency, error)
+	GetWalletIntegrationCurrencies(walletIntegrationID int32) ([]model.WalletIntegrationCurrency, error)
+}
+
+type walletIntegrationCurrencyRepository struct {
+}
+
+func NewWalletIntegrationCurrencyRepository() IWalletIntegrationCurrencyRepository {
+	return &walletIntegrationCurrencyRepository{}
+}
+
+// GetCurrenciesByType returns the currencies linked to a wallet integration for one usage
+// (deposit, withdrawn input or withdrawn output), see consts.WalletIntegrationCurrencyType*.
+func (r *walletIntegrationCurrencyRepository) GetCurrenciesByType(walletIntegrationID int32, currencyType string) ([]model.Currency, error) {
+	var items []model.WalletIntegrationCurrency
+	err := global.PdbSetting.Preload("Currency").
+		Where("wallet_integrations_id = ? AND type = ?", walletIntegrationID, currencyType).
+		Order("sort").
+		Find(&items).Error
+	if err != nil {
+		return nil, err
+	}
+	currencies := make([]model.Currency, 0, len(items))
+	for _, item := range items {
+		currencies = append(currencies, item.Currency)
+	}
+	return currencies, nil
+}
+
+// GetWalletIntegrationCurrencies returns the currencies of every usage of a wallet integration
+func (r *walletIntegrationCurrencyRepository) GetWalletIntegrationCurrencies(walletIntegrationID int32) ([]model.WalletIntegrationCurrency, error) {
+	var items []model.WalletIntegrationCurrency
+	err := global.PdbSetting.Preload("Currency").
+		Where("wallet_integrations_id = ?", walletIntegrationID).
+		Order("sort").
+		Find(&items).Error
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
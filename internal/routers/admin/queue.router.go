@@ -0,0 +1,28 @@
+package admin
+
+import (
+	"ecom/internal/middlewares"
+	"ecom/internal/wire"
+	consts "ecom/pkg/const"
+
+	"github.com/gin-gonic/gin"
+)
+
+type QueueRouter struct{}
+
+func (u *QueueRouter) InitQueueRouter(Router *gin.RouterGroup) {
+	queueController, err := wire.InitializeQueueHandler()
+	if err != nil {
+		panic(err)
+	}
+
+	queueRouterPrivate := Router.Group("/admin/queues")
+	queueRouterPrivate.Use(middlewares.AuthMiddleware(), middlewares.RateLimitMiddleware(), middlewares.Authorize(middlewares.Policy{Scopes: []string{consts.ScopeQueuesRead}}))
+	writeQueues := middlewares.Authorize(middlewares.Policy{Scopes: []string{consts.ScopeQueuesWrite}})
+	{
+		queueRouterPrivate.GET("", queueController.ListQueues)
+		queueRouterPrivate.GET("/:name/dlq", queueController.PeekDeadLetters)
+		queueRouterPrivate.POST("/:name/dlq/replay", writeQueues, queueController.ReplayDeadLetters)
+		queueRouterPrivate.POST("/:name/dlq/purge", writeQueues, queueController.PurgeDeadLetters)
+	}
+}
@@ -3,6 +3,7 @@ package deposit
 import (
 	"ecom/internal/middlewares"
 	"ecom/internal/wire"
+	consts "ecom/pkg/const"
 
 	"github.com/gin-gonic/gin"
 )
@@ -16,9 +17,9 @@ func (u *DepositRouter) InitDepositRouter(Router *gin.RouterGroup) {
 	}
 
 	depositRouterPrivate := Router.Group("/deposit")
-	depositRouterPrivate.Use(middlewares.AuthMiddleware())
+	depositRouterPrivate.Use(middlewares.AuthMiddleware(), middlewares.RateLimitMiddleware(), middlewares.Authorize(middlewares.Policy{Scopes: []string{consts.ScopeDeposit}}))
 	{
-		// depositRouterPrivate.POST("", depositController.Deposit)
-		depositRouterPrivate.POST("/test", depositController.Test)
+		depositRouterPrivate.POST("", depositController.Deposit)
+		depositRouterPrivate.POST("/test", middlewares.Authorize(middlewares.Policy{Roles: []string{consts.RoleAdmin}}), depositController.Test)
 	}
 }
@@ -1,13 +1,17 @@
 package routers
 
 import (
+	"ecom/internal/routers/admin"
 	"ecom/internal/routers/deposit"
 	"ecom/internal/routers/test"
+	"ecom/internal/routers/withdraw"
 )
 
 type RouterGroup struct {
-	Deposit deposit.DepositRouterGroup
-	Test    test.TestRouterGroup
+	Admin    admin.AdminRouterGroup
+	Deposit  deposit.DepositRouterGroup
+	Test     test.TestRouterGroup
+	Withdraw withdraw.WithdrawRouterGroup
 }
 
 var RouterGroupApp = new(RouterGroup)
@@ -1,7 +1,9 @@
 package test
 
 import (
+	"ecom/internal/middlewares"
 	"ecom/internal/wire"
+	consts "ecom/pkg/const"
 
 	"github.com/gin-gonic/gin"
 )
@@ -15,7 +17,7 @@ func (u *TestRouter) InitTestRouter(Router *gin.RouterGroup) {
 	}
 
 	testRouterPrivate := Router.Group("/test")
-	// testRouterPrivate.Use(middlewares.AuthMiddleware())
+	testRouterPrivate.Use(middlewares.AuthMiddleware(), middlewares.RateLimitMiddleware(), middlewares.Authorize(middlewares.Policy{Roles: []string{consts.RoleAdmin}}))
 	{
 		testRouterPrivate.GET("/:id", testController.GetTestById)
 		testRouterPrivate.POST("/update", testController.UpdateTest)
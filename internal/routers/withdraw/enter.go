@@ -0,0 +1,5 @@
+package withdraw
+
+type WithdrawRouterGroup struct {
+	WithdrawRouter
+}
@@ -0,0 +1,24 @@
+package withdraw
+
+import (
+	"ecom/internal/middlewares"
+	"ecom/internal/wire"
+	consts "ecom/pkg/const"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WithdrawRouter struct{}
+
+func (u *WithdrawRouter) InitWithdrawRouter(Router *gin.RouterGroup) {
+	withdrawController, err := wire.InitializeWithdrawHandler()
+	if err != nil {
+		panic(err)
+	}
+
+	withdrawRouterPrivate := Router.Group("/withdraw")
+	withdrawRouterPrivate.Use(middlewares.AuthMiddleware(), middlewares.RateLimitMiddleware(), middlewares.Authorize(middlewares.Policy{Scopes: []string{consts.ScopeWithdraw}}))
+	{
+		withdrawRouterPrivate.POST("", withdrawController.Withdraw)
+	}
+}
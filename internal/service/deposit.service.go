@@ -1,21 +1,57 @@
 package service
 
 import (
+	"context"
 	"ecom/internal/model"
 	"ecom/internal/repo"
+	"ecom/internal/vo"
+	consts "ecom/pkg/const"
+	"ecom/pkg/money"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidAmount             = errors.New("amount must be greater than zero")
+	ErrWalletIntegrationNotFound = errors.New("wallet integration not found")
+	ErrCurrencyNotSupported      = errors.New("currency is not supported")
+	ErrAmountBelowMinDeposit     = errors.New("amount is less than the minimum deposit")
+	ErrDuplicateTransaction      = errors.New("transaction code already exists")
+	ErrAmountPrecision           = errors.New("amount has more decimal places than the currency allows")
 )
 
 type IDepositService interface {
 	Test(userID string, email string, messageID string, routingKey string, hashKey string) (model.Cycle, error)
+	Deposit(ctx context.Context, req *vo.DepositRequest) (model.Transaction, error)
 }
 
 type depositService struct {
-	cycleRepository repo.ICycleRepository
+	cycleRepository       repo.ICycleRepository
+	walletRepository      repo.IWalletRepository
+	transactionRepository repo.ITransactionRepository
+	outboxRepository      repo.IOutboxRepository
+	settingService        ISettingService
 }
 
-func NewDepositService(cycleRepository repo.ICycleRepository) IDepositService {
+func NewDepositService(
+	cycleRepository repo.ICycleRepository,
+	walletRepository repo.IWalletRepository,
+	transactionRepository repo.ITransactionRepository,
+	outboxRepository repo.IOutboxRepository,
+	settingService ISettingService,
+) IDepositService {
 	return &depositService{
-		cycleRepository: cycleRepository,
+		cycleRepository:       cycleRepository,
+		walletRepository:      walletRepository,
+		transactionRepository: transactionRepository,
+		outboxRepository:      outboxRepository,
+		settingService:        settingService,
 	}
 }
 
@@ -27,3 +63,135 @@ func (ds *depositService) Test(userID string, email string, messageID string, ro
 
 	return cycle, nil
 }
+
+// Deposit credits the user's wallet and records the deposit transaction.
+// The wallet update, the transaction row and the wallet event are written in one database transaction.
+func (ds *depositService) Deposit(ctx context.Context, req *vo.DepositRequest) (model.Transaction, error) {
+	if !req.Amount.IsPositive() {
+		return model.Transaction{}, ErrInvalidAmount
+	}
+	currency := strings.ToLower(req.Currency)
+	if !isCurrencyAmount(req.Amount, currency) {
+		return model.Transaction{}, fmt.Errorf("%w: %d", ErrAmountPrecision, money.Scale(currency))
+	}
+
+	setting, err := ds.settingService.GetSettingByProviderKey(ctx, req.ProviderKey)
+	if err != nil {
+		return model.Transaction{}, err
+	}
+	if req.Amount.LessThan(money.NewFromFloat(setting.Deposit.MinDeposit)) {
+		return model.Transaction{}, fmt.Errorf("%w: %v", ErrAmountBelowMinDeposit, setting.Deposit.MinDeposit)
+	}
+	if !containsCurrency(setting.Deposit.CurrencySupportDeposit, req.Currency) {
+		return model.Transaction{}, fmt.Errorf("%w: %s", ErrCurrencyNotSupported, req.Currency)
+	}
+
+	var transaction model.Transaction
+	err = repo.RunInTx(ctx, func(tx *gorm.DB) error {
+		walletRepository := ds.walletRepository.WithTx(tx)
+		transactionRepository := ds.transactionRepository.WithTx(tx)
+
+		if err := walletRepository.LockWallet(req.UserID, req.ProviderKey, currency); err != nil {
+			return err
+		}
+		if _, err := transactionRepository.GetTransactionByCode(req.TransactionCode); err == nil {
+			return ErrDuplicateTransaction
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		now := time.Now()
+		nowUnix := strconv.FormatInt(now.Unix(), 10)
+		wallet, err := walletRepository.GetWallet(req.UserID, req.ProviderKey, currency)
+		isNewWallet := errors.Is(err, gorm.ErrRecordNotFound)
+		if err != nil && !isNewWallet {
+			return err
+		}
+		if !isNewWallet {
+			if _, err := accrueInterest(&wallet, setting, now); err != nil {
+				return err
+			}
+		}
+
+		balanceBefore := wallet.Balance
+		wallet.Balance = balanceBefore.Add(req.Amount)
+		wallet.TimeDeposit = nowUnix
+		wallet.DateUpdated = now
+		if isNewWallet {
+			wallet.UserID = req.UserID
+			wallet.ProviderKey = req.ProviderKey
+			wallet.Currency = currency
+			wallet.IsNew = true
+			wallet.AmountInterest = money.Zero
+			wallet.LastTimeUpdate = nowUnix
+			err = walletRepository.CreateWallet(&wallet)
+		} else {
+			err = walletRepository.UpdateWallet(&wallet)
+		}
+		if err != nil {
+			return err
+		}
+
+		details, err := json.Marshal(map[string]interface{}{
+			"providerKey":   req.ProviderKey,
+			"walletId":      wallet.ID,
+			"balanceBefore": balanceBefore,
+			"balanceAfter":  wallet.Balance,
+			"rateCurrency":  req.RateCurrency,
+		})
+		if err != nil {
+			return err
+		}
+
+		transaction = model.Transaction{
+			Details:         details,
+			Amount:          req.Amount,
+			RateUsd:         req.RateUsd,
+			UserID:          req.UserID,
+			DateUpdated:     now,
+			TransactionType: consts.TransactionTypeDeposit,
+			Platform:        req.Platform,
+			Icon:            consts.TransactionIconDeposit,
+			Code:            req.TransactionCode,
+			Status:          consts.TransactionStatusSuccess,
+			Description:     "Deposit " + currency,
+			Currency:        currency,
+		}
+		if err := transactionRepository.CreateTransaction(&transaction); err != nil {
+			return err
+		}
+		return enqueueWalletEvent(ds.outboxRepository.WithTx(tx), vo.WalletEvent{
+			Type:            consts.WalletEventDeposited,
+			UserID:          req.UserID,
+			ProviderKey:     req.ProviderKey,
+			Currency:        currency,
+			WalletID:        wallet.ID,
+			TransactionID:   transaction.ID,
+			TransactionCode: transaction.Code,
+			Amount:          req.Amount,
+			BalanceBefore:   balanceBefore,
+			BalanceAfter:    wallet.Balance,
+			AmountInterest:  wallet.AmountInterest,
+			OccurredAt:      now.Unix(),
+		})
+	})
+	if err != nil {
+		return model.Transaction{}, err
+	}
+
+	return transaction, nil
+}
+
+func containsCurrency(currencies []model.Currency, currency string) bool {
+	for _, c := range currencies {
+		if strings.EqualFold(c.Slug, currency) || strings.EqualFold(c.Name, currency) {
+			return true
+		}
+	}
+	return false
+}
+
+// isCurrencyAmount reports whether the amount fits in the scale of the currency
+func isCurrencyAmount(amount money.Amount, currency string) bool {
+	return amount.Equal(amount.RoundCurrency(currency, money.RoundDown))
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"ecom/internal/repo"
+	consts "ecom/pkg/const"
+	"ecom/pkg/token"
+
+	"gorm.io/gorm"
+)
+
+// ErrProjectAccessDenied is returned for a caller outside the project, an unknown project included so
+// the response does not tell which projects exist
+var ErrProjectAccessDenied = errors.New("access to the project denied")
+
+// IProjectService checks the access of the callers to the projects, the platforms of the requests
+type IProjectService interface {
+	AuthorizeProject(ctx context.Context, slug string, claims *token.Claims) error
+}
+
+type projectService struct {
+	projectRepository       repo.IProjectRepository
+	projectMemberRepository repo.IProjectMemberRepository
+}
+
+func NewProjectService(
+	projectRepository repo.IProjectRepository,
+	projectMemberRepository repo.IProjectMemberRepository,
+) IProjectService {
+	return &projectService{
+		projectRepository:       projectRepository,
+		projectMemberRepository: projectMemberRepository,
+	}
+}
+
+// AuthorizeProject returns ErrProjectAccessDenied unless the caller is a member of the project with
+// slug or holds the admin role
+func (ps *projectService) AuthorizeProject(ctx context.Context, slug string, claims *token.Claims) error {
+	if claims == nil || slug == "" {
+		return ErrProjectAccessDenied
+	}
+	if claims.HasRole(consts.RoleAdmin) {
+		return nil
+	}
+	project, err := ps.projectRepository.GetProjectBySlug(slug)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrProjectAccessDenied
+	}
+	if err != nil {
+		return err
+	}
+	member, err := ps.projectMemberRepository.IsProjectMember(project.ID, claims.Subject)
+	if err != nil {
+		return err
+	}
+	if !member {
+		return ErrProjectAccessDenied
+	}
+	return nil
+}
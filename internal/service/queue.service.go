@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"ecom/global"
+	"ecom/internal/model"
+	"ecom/internal/repo"
+	"ecom/internal/vo"
+	consts "ecom/pkg/const"
+	"ecom/pkg/rabbitmq"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultPeekLimit = 20
+	maxPeekLimit     = 500
+)
+
+var (
+	ErrQueueNotFound   = errors.New("queue not found")
+	ErrMissingOperator = errors.New("missing operator")
+)
+
+// IQueueService administers the queues of the broker. Every call names the operator doing it and is
+// written to the audit log, failed calls included.
+type IQueueService interface {
+	ListQueues(ctx context.Context, operator string) ([]vo.QueueInfo, error)
+	PeekDeadLetters(ctx context.Context, operator, queueName string, limit int) ([]rabbitmq.DeadLetter, error)
+	ReplayDeadLetters(ctx context.Context, operator, queueName string, messageIDs []string) (int, error)
+	PurgeDeadLetters(ctx context.Context, operator, queueName string, messageIDs []string) (int, error)
+}
+
+type queueService struct {
+	rabbitMQManager    rabbitmq.Broker
+	auditLogRepository repo.IAuditLogRepository
+}
+
+func NewQueueService(auditLogRepository repo.IAuditLogRepository) IQueueService {
+	return &queueService{
+		rabbitMQManager:    global.RabbitMQManager,
+		auditLogRepository: auditLogRepository,
+	}
+}
+
+// ListQueues returns the declared queues with their ready messages, consumers and dead letters.
+// A queue whose depth cannot be read is listed with its error.
+func (qs *queueService) ListQueues(ctx context.Context, operator string) ([]vo.QueueInfo, error) {
+	if operator == "" {
+		return nil, ErrMissingOperator
+	}
+	names := qs.rabbitMQManager.QueueNames()
+	queues := make([]vo.QueueInfo, 0, len(names))
+	for _, name := range names {
+		info := vo.QueueInfo{Name: name}
+		var err error
+		info.Messages, info.Consumers, err = qs.rabbitMQManager.QueueDepth(name)
+		if err != nil {
+			info.Error = err.Error()
+		}
+		// a queue never consumed has no dead letter queue
+		info.DeadLetters, _, _ = qs.rabbitMQManager.QueueDepth(rabbitmq.DeadLetterQueueName(name))
+		queues = append(queues, info)
+	}
+	qs.audit(operator, consts.AuditActionListQueues, "", map[string]interface{}{"queues": len(queues)}, nil)
+	return queues, nil
+}
+
+// PeekDeadLetters returns the oldest dead letters of a queue without removing them, limit defaults to
+// defaultPeekLimit and is capped at maxPeekLimit
+func (qs *queueService) PeekDeadLetters(ctx context.Context, operator, queueName string, limit int) ([]rabbitmq.DeadLetter, error) {
+	if limit <= 0 {
+		limit = defaultPeekLimit
+	}
+	if limit > maxPeekLimit {
+		limit = maxPeekLimit
+	}
+	var letters []rabbitmq.DeadLetter
+	name, err := qs.queueName(operator, queueName)
+	if err == nil {
+		letters, err = qs.rabbitMQManager.PeekDeadLetters(ctx, name, limit)
+	}
+	qs.audit(operator, consts.AuditActionPeekDeadLetters, queueName, map[string]interface{}{
+		"limit":    limit,
+		"returned": len(letters),
+	}, err)
+	return letters, err
+}
+
+// ReplayDeadLetters publishes the selected dead letters of a queue back to their original exchange
+func (qs *queueService) ReplayDeadLetters(ctx context.Context, operator, queueName string, messageIDs []string) (int, error) {
+	replayed := 0
+	name, err := qs.queueName(operator, queueName)
+	if err == nil {
+		replayed, err = qs.rabbitMQManager.ReplayDeadLetters(ctx, name, messageIDs)
+	}
+	qs.audit(operator, consts.AuditActionReplayDeadLetter, queueName, map[string]interface{}{
+		"messageIds": messageIDs,
+		"replayed":   replayed,
+	}, err)
+	return replayed, err
+}
+
+// PurgeDeadLetters drops the selected dead letters of a queue
+func (qs *queueService) PurgeDeadLetters(ctx context.Context, operator, queueName string, messageIDs []string) (int, error) {
+	purged := 0
+	name, err := qs.queueName(operator, queueName)
+	if err == nil {
+		purged, err = qs.rabbitMQManager.PurgeDeadLetters(ctx, name, messageIDs)
+	}
+	qs.audit(operator, consts.AuditActionPurgeDeadLetter, queueName, map[string]interface{}{
+		"messageIds": messageIDs,
+		"purged":     purged,
+	}, err)
+	return purged, err
+}
+
+// queueName returns the declared queue named by name, which may also name its dead letter queue
+func (qs *queueService) queueName(operator, name string) (string, error) {
+	if operator == "" {
+		return "", ErrMissingOperator
+	}
+	name = strings.TrimSuffix(name, rabbitmq.DeadLetterQueueName(""))
+	for _, declared := range qs.rabbitMQManager.QueueNames() {
+		if declared == name {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrQueueNotFound, name)
+}
+
+// audit writes an action to the audit log and the application log. A failed write is only logged,
+// the action already happened.
+func (qs *queueService) audit(operator, action, target string, details map[string]interface{}, actionErr error) {
+	fields := []zap.Field{
+		zap.String("operator", operator),
+		zap.String("action", action),
+		zap.String("target", target),
+		zap.Any("details", details),
+	}
+	entry := model.AuditLog{
+		Operator:  operator,
+		Action:    action,
+		Target:    target,
+		CreatedAt: time.Now(),
+	}
+	if actionErr != nil {
+		entry.Error = actionErr.Error()
+		fields = append(fields, zap.Error(actionErr))
+	}
+	global.Logger.Info("Audit", fields...)
+
+	if data, err := json.Marshal(details); err == nil {
+		entry.Details = data
+	}
+	if err := qs.auditLogRepository.CreateAuditLog(&entry); err != nil {
+		global.Logger.Error("Failed to write audit log", append(fields, zap.NamedError("auditError", err))...)
+	}
+}
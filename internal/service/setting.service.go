@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"ecom/global"
+	"ecom/internal/repo"
+	"ecom/internal/utils/convert"
+	"ecom/internal/utils/interest"
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// settingVersionCheckInterval is how often the cached settings are compared against the setting tables
+var settingVersionCheckInterval = 30 * time.Second
+
+type ISettingService interface {
+	GetSettingByProviderKey(ctx context.Context, providerKey string) (*interest.InterestSetting, error)
+	Invalidate(providerKey string)
+	InvalidateAll()
+}
+
+// settingCache is shared by every setting service so an invalidation is seen by all handlers
+type settingCache struct {
+	mu        sync.RWMutex
+	settings  map[string]*interest.InterestSetting
+	version   string
+	checkedAt time.Time
+}
+
+var defaultSettingCache = &settingCache{
+	settings: make(map[string]*interest.InterestSetting),
+}
+
+type settingService struct {
+	cache                               *settingCache
+	settingRepository                   repo.ISettingRepository
+	walletIntegrationRepository         repo.IWalletIntegrationRepository
+	walletIntegrationCurrencyRepository repo.IWalletIntegrationCurrencyRepository
+	platformInterestRateRepository      repo.IPlatformInterestRateRepository
+	cycleRepository                     repo.ICycleRepository
+	transactionTypeRepository           repo.ITransactionTypeRepository
+	projectRepository                   repo.IProjectRepository
+}
+
+func NewSettingService(
+	settingRepository repo.ISettingRepository,
+	walletIntegrationRepository repo.IWalletIntegrationRepository,
+	walletIntegrationCurrencyRepository repo.IWalletIntegrationCurrencyRepository,
+	platformInterestRateRepository repo.IPlatformInterestRateRepository,
+	cycleRepository repo.ICycleRepository,
+	transactionTypeRepository repo.ITransactionTypeRepository,
+	projectRepository repo.IProjectRepository,
+) ISettingService {
+	return &settingService{
+		cache:                               defaultSettingCache,
+		settingRepository:                   settingRepository,
+		walletIntegrationRepository:         walletIntegrationRepository,
+		walletIntegrationCurrencyRepository: walletIntegrationCurrencyRepository,
+		platformInterestRateRepository:      platformInterestRateRepository,
+		cycleRepository:                     cycleRepository,
+		transactionTypeRepository:           transactionTypeRepository,
+		projectRepository:                   projectRepository,
+	}
+}
+
+// GetSettingByProviderKey returns the interest setting of an active wallet integration.
+// Settings are cached per provider key and the whole cache is dropped when the setting tables change,
+// which is checked at most every settingVersionCheckInterval. The returned setting is shared, callers
+// must not modify it.
+func (ss *settingService) GetSettingByProviderKey(ctx context.Context, providerKey string) (*interest.InterestSetting, error) {
+	ss.checkVersion()
+
+	ss.cache.mu.RLock()
+	setting, ok := ss.cache.settings[providerKey]
+	ss.cache.mu.RUnlock()
+	if ok {
+		return setting, nil
+	}
+
+	setting, err := ss.loadSetting(providerKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ss.cache.mu.Lock()
+	ss.cache.settings[providerKey] = setting
+	ss.cache.mu.Unlock()
+	return setting, nil
+}
+
+func (ss *settingService) Invalidate(providerKey string) {
+	ss.cache.mu.Lock()
+	delete(ss.cache.settings, providerKey)
+	ss.cache.mu.Unlock()
+}
+
+func (ss *settingService) InvalidateAll() {
+	ss.cache.mu.Lock()
+	ss.cache.settings = make(map[string]*interest.InterestSetting)
+	ss.cache.mu.Unlock()
+}
+
+// checkVersion drops the cached settings when the hash of the setting tables has changed
+func (ss *settingService) checkVersion() {
+	ss.cache.mu.RLock()
+	fresh := time.Since(ss.cache.checkedAt) < settingVersionCheckInterval
+	ss.cache.mu.RUnlock()
+	if fresh {
+		return
+	}
+
+	version, err := ss.settingRepository.GetSettingVersion()
+	if err != nil {
+		// keep serving the cached settings, the next call checks again
+		global.Logger.Error("Failed to get setting version", zap.Error(err))
+		return
+	}
+
+	ss.cache.mu.Lock()
+	defer ss.cache.mu.Unlock()
+	if version != ss.cache.version {
+		ss.cache.settings = make(map[string]*interest.InterestSetting)
+		ss.cache.version = version
+	}
+	ss.cache.checkedAt = time.Now()
+}
+
+func (ss *settingService) loadSetting(providerKey string) (*interest.InterestSetting, error) {
+	walletIntegration, err := ss.walletIntegrationRepository.GetWalletIntegrationByKey(providerKey)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWalletIntegrationNotFound
+		}
+		return nil, err
+	}
+
+	cycleIDs, rateIDs, err := convert.InterestReferences(walletIntegration)
+	if err != nil {
+		return nil, err
+	}
+	rates, err := ss.platformInterestRateRepository.GetPlatformInterestRatesByIds(rateIDs)
+	if err != nil {
+		return nil, err
+	}
+	cycles, err := ss.cycleRepository.GetCyclesByIds(cycleIDs)
+	if err != nil {
+		return nil, err
+	}
+	transactionTypes, err := ss.transactionTypeRepository.GetAllTransactionType()
+	if err != nil {
+		return nil, err
+	}
+	currencies, err := ss.walletIntegrationCurrencyRepository.GetWalletIntegrationCurrencies(walletIntegration.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	source := convert.SettingInterestSource{
+		WalletIntegration: walletIntegration,
+		InterestRates:     rates,
+		Cycles:            cycles,
+		TransactionTypes:  transactionTypes,
+		Currencies:        currencies,
+	}
+	project, err := ss.projectRepository.GetProjectByWalletIntegration(walletIntegration.ID)
+	if err == nil {
+		source.Project = &project
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	return convert.ConvertSettingInterest(source)
+}
@@ -3,7 +3,6 @@ package service
 import (
 	"ecom/internal/database"
 	"ecom/internal/repo"
-	"fmt"
 	"time"
 
 	"github.com/google/uuid"
@@ -28,7 +27,6 @@ func NewTestService(repo repo.ITestRepository) ITestService {
 func (s *testService) GetTestById(id uuid.UUID) (database.Test, error) {
 	data, err := s.repo.GetTestById(id)
 	if err != nil {
-		fmt.Println("error", err)
 		return database.Test{}, err
 	}
 	return data, nil
@@ -37,17 +35,14 @@ func (s *testService) GetTestById(id uuid.UUID) (database.Test, error) {
 func (s *testService) CreateTest(req *database.CreateTestParams) (database.Test, error) {
 	data, err := s.repo.CreateTest(req)
 	if err != nil {
-		fmt.Println("error", err)
 		return database.Test{}, err
 	}
 	return data, nil
 }
 
 func (s *testService) UpdateTest(req *database.UpdateTestParams) (database.Test, error) {
-	fmt.Println("UpdateTest", req)
 	data, err := s.repo.UpdateTest(req)
 	if err != nil {
-		fmt.Println("error", err)
 		return database.Test{}, err
 	}
 	time.Sleep(10 * time.Second)
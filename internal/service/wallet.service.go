@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"ecom/global"
+	"ecom/internal/model"
+	"ecom/internal/repo"
+	"ecom/internal/utils/interest"
+	"ecom/internal/vo"
+	consts "ecom/pkg/const"
+	"ecom/pkg/money"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type IWalletService interface {
+	TakeInterest(ctx context.Context, userID string, providerKey string) ([]model.Transaction, error)
+}
+
+type walletService struct {
+	walletRepository      repo.IWalletRepository
+	transactionRepository repo.ITransactionRepository
+	outboxRepository      repo.IOutboxRepository
+	settingService        ISettingService
+}
+
+func NewWalletService(
+	walletRepository repo.IWalletRepository,
+	transactionRepository repo.ITransactionRepository,
+	outboxRepository repo.IOutboxRepository,
+	settingService ISettingService,
+) IWalletService {
+	return &walletService{
+		walletRepository:      walletRepository,
+		transactionRepository: transactionRepository,
+		outboxRepository:      outboxRepository,
+		settingService:        settingService,
+	}
+}
+
+// TakeInterest accrues the interest earned since the last update on every wallet the user holds
+// on the provider and records one take-interest transaction per wallet that earned something.
+func (ws *walletService) TakeInterest(ctx context.Context, userID string, providerKey string) ([]model.Transaction, error) {
+	setting, err := ws.settingService.GetSettingByProviderKey(ctx, providerKey)
+	if err != nil {
+		return nil, err
+	}
+
+	wallets, err := ws.walletRepository.GetWalletsByUser(userID, providerKey)
+	if err != nil {
+		return nil, err
+	}
+
+	transactions := make([]model.Transaction, 0, len(wallets))
+	for _, wallet := range wallets {
+		err = repo.RunInTx(ctx, func(tx *gorm.DB) error {
+			walletRepository := ws.walletRepository.WithTx(tx)
+			transactionRepository := ws.transactionRepository.WithTx(tx)
+
+			if err := walletRepository.LockWallet(userID, providerKey, wallet.Currency); err != nil {
+				return err
+			}
+			// reload under the lock, the wallet may have changed since it was listed
+			current, err := walletRepository.GetWallet(userID, providerKey, wallet.Currency)
+			if err != nil {
+				return err
+			}
+
+			now := time.Now()
+			amountInterestBefore := current.AmountInterest
+			amountInterest, err := accrueInterest(&current, setting, now)
+			if err != nil {
+				return err
+			}
+			current.DateUpdated = now
+			if err := walletRepository.UpdateWallet(&current); err != nil {
+				return err
+			}
+			if !amountInterest.IsPositive() {
+				return nil
+			}
+
+			details, err := json.Marshal(map[string]interface{}{
+				"providerKey":          providerKey,
+				"walletId":             current.ID,
+				"balance":              current.Balance,
+				"amountInterestBefore": amountInterestBefore,
+				"amountInterestAfter":  current.AmountInterest,
+				"lastTimeUpdate":       current.LastTimeUpdate,
+			})
+			if err != nil {
+				return err
+			}
+			transaction := model.Transaction{
+				Details:         details,
+				Amount:          amountInterest,
+				UserID:          userID,
+				DateUpdated:     now,
+				TransactionType: consts.TransactionTypeTakeInterest,
+				Platform:        setting.Platform,
+				Icon:            consts.TransactionIconTakeInterest,
+				Code:            uuid.NewString(),
+				Status:          consts.TransactionStatusSuccess,
+				Description:     "Take interest " + current.Currency,
+				Currency:        current.Currency,
+			}
+			if err := transactionRepository.CreateTransaction(&transaction); err != nil {
+				return err
+			}
+			err = enqueueWalletEvent(ws.outboxRepository.WithTx(tx), vo.WalletEvent{
+				Type:            consts.WalletEventInterestTaken,
+				UserID:          userID,
+				ProviderKey:     providerKey,
+				Currency:        current.Currency,
+				WalletID:        current.ID,
+				TransactionID:   transaction.ID,
+				TransactionCode: transaction.Code,
+				Amount:          amountInterest,
+				BalanceBefore:   current.Balance,
+				BalanceAfter:    current.Balance,
+				AmountInterest:  current.AmountInterest,
+				OccurredAt:      now.Unix(),
+			})
+			if err != nil {
+				return err
+			}
+			transactions = append(transactions, transaction)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return transactions, nil
+}
+
+// accrueInterest adds the interest earned since wallet.LastTimeUpdate to wallet.AmountInterest
+// and moves LastTimeUpdate forward. It must run before any balance change so the interest of the
+// previous period is computed on the previous balance. The caller persists the wallet.
+func accrueInterest(wallet *model.Wallet, setting *interest.InterestSetting, now time.Time) (money.Amount, error) {
+	if wallet.LastTimeUpdate == "" {
+		wallet.LastTimeUpdate = strconv.FormatInt(now.Unix(), 10)
+		return money.Zero, nil
+	}
+	lastTimeUpdate, amountInterest := interest.CalculateInterest(wallet, setting, now.Unix())
+	if lastTimeUpdate == 0 {
+		// the wallet could not be parsed, leave it untouched
+		return money.Zero, nil
+	}
+	wallet.AmountInterest = wallet.AmountInterest.Add(amountInterest)
+	wallet.LastTimeUpdate = strconv.FormatInt(lastTimeUpdate, 10)
+	return amountInterest, nil
+}
+
+// enqueueWalletEvent records a wallet event in the outbox with the repository bound to the caller's
+// transaction, so the event exists if and only if the balance change is committed.
+// The outbox relay publishes it afterwards.
+func enqueueWalletEvent(outboxRepository repo.IOutboxRepository, event vo.WalletEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	exchange := global.Config.Exchange.Wallet
+	if exchange == "" {
+		exchange = consts.WalletEventsExchangeName
+	}
+	return outboxRepository.CreateEvent(&model.OutboxEvent{
+		Exchange:    exchange,
+		RoutingKey:  event.Type,
+		MessageID:   uuid.NewString(),
+		Payload:     payload,
+		Status:      consts.OutboxStatusPending,
+		AvailableAt: time.Now(),
+	})
+}
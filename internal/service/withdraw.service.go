@@ -0,0 +1,356 @@
+package service
+
+import (
+	"context"
+	"ecom/internal/model"
+	"ecom/internal/repo"
+	"ecom/internal/utils/convert"
+	"ecom/internal/vo"
+	consts "ecom/pkg/const"
+	"ecom/pkg/money"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAmountBelowMinWithdrawn = errors.New("amount is less than the minimum withdrawal")
+	ErrAmountAboveMaxWithdrawn = errors.New("amount is greater than the maximum withdrawal")
+	ErrInsufficientBalance     = errors.New("insufficient balance")
+	ErrAmountNotCoverFee       = errors.New("amount does not cover the withdrawal fee")
+	ErrRateNotFound            = errors.New("currency rate not found")
+)
+
+// IWithdrawService runs the steps of a withdrawal, each inside the transaction of its saga step,
+// see messaging.WithdrawSaga
+type IWithdrawService interface {
+	// ReserveWithdraw checks a withdrawal, debits its amount and records it as a pending transaction
+	ReserveWithdraw(ctx context.Context, tx *gorm.DB, req *vo.WithdrawRequest) (vo.WithdrawReservation, model.Transaction, error)
+	// ReleaseWithdraw credits the reserved amount back
+	ReleaseWithdraw(ctx context.Context, tx *gorm.DB, reservation *vo.WithdrawReservation) error
+	// ChargeWithdrawFee debits the fee not taken from the amount
+	ChargeWithdrawFee(ctx context.Context, tx *gorm.DB, reservation *vo.WithdrawReservation) error
+	RefundWithdrawFee(ctx context.Context, tx *gorm.DB, reservation *vo.WithdrawReservation) error
+	// CompleteWithdraw marks the transaction successful and publishes the withdrawn event
+	CompleteWithdraw(ctx context.Context, tx *gorm.DB, reservation *vo.WithdrawReservation) (model.Transaction, error)
+	// FailWithdraw marks the transaction failed
+	FailWithdraw(ctx context.Context, tx *gorm.DB, reservation *vo.WithdrawReservation) error
+}
+
+type withdrawService struct {
+	walletRepository      repo.IWalletRepository
+	transactionRepository repo.ITransactionRepository
+	outboxRepository      repo.IOutboxRepository
+	settingService        ISettingService
+}
+
+func NewWithdrawService(
+	walletRepository repo.IWalletRepository,
+	transactionRepository repo.ITransactionRepository,
+	outboxRepository repo.IOutboxRepository,
+	settingService ISettingService,
+) IWithdrawService {
+	return &withdrawService{
+		walletRepository:      walletRepository,
+		transactionRepository: transactionRepository,
+		outboxRepository:      outboxRepository,
+		settingService:        settingService,
+	}
+}
+
+// withdrawFee is the fee breakdown stored in Transaction.Details
+type withdrawFee struct {
+	IsLocked            bool         `json:"isLocked"`
+	UnlockTime          int64        `json:"unlockTime"`
+	UrgentFeePercent    float64      `json:"urgentFeePercent"`
+	UrgentFee           money.Amount `json:"urgentFee"`
+	IsFreeWithdrawal    bool         `json:"isFreeWithdrawal"`
+	FreeWithdrawalsUsed int64        `json:"freeWithdrawalsUsed"`
+	WithdrawalFeeFixed  float64      `json:"withdrawalFeeFixed"`
+	WithdrawalFeePct    float64      `json:"withdrawalFeePercent"`
+	WithdrawalFee       money.Amount `json:"withdrawalFee"`
+	FeeIn               bool         `json:"feeIn"`
+	TotalFee            money.Amount `json:"totalFee"`
+}
+
+// ReserveWithdraw debits the amount of a withdrawal from the user's wallet and records a pending
+// withdrawn transaction. A regular fee not taken from the amount is left to ChargeWithdrawFee, the
+// balance must cover both.
+//
+// Funds deposited less than DepositLockTime seconds ago pay UrgentWithdrawalFeePercent on top of
+// the regular withdrawn fee from FeeSetting. The first FreeWithdrawalsCount withdrawals of a calendar
+// month (UTC) up to FreeWithdrawalLimit are exempt from the regular fee. The net amount is converted
+// to ToCurrency with the USD rates in RateCurrency. Fees are rounded half up to the currency scale,
+// the received amount is rounded down so the user is never paid more than the converted value.
+func (ws *withdrawService) ReserveWithdraw(ctx context.Context, tx *gorm.DB, req *vo.WithdrawRequest) (vo.WithdrawReservation, model.Transaction, error) {
+	if !req.Amount.IsPositive() {
+		return vo.WithdrawReservation{}, model.Transaction{}, ErrInvalidAmount
+	}
+	currency := strings.ToLower(req.Currency)
+	if !isCurrencyAmount(req.Amount, currency) {
+		return vo.WithdrawReservation{}, model.Transaction{}, fmt.Errorf("%w: %d", ErrAmountPrecision, money.Scale(currency))
+	}
+
+	setting, err := ws.settingService.GetSettingByProviderKey(ctx, req.ProviderKey)
+	if err != nil {
+		return vo.WithdrawReservation{}, model.Transaction{}, err
+	}
+	if req.Amount.LessThan(money.NewFromFloat(setting.Withdrawn.MinWithdrawn)) {
+		return vo.WithdrawReservation{}, model.Transaction{}, fmt.Errorf("%w: %v", ErrAmountBelowMinWithdrawn, setting.Withdrawn.MinWithdrawn)
+	}
+	if setting.Withdrawn.MaxWithdrawn > 0 && req.Amount.GreaterThan(money.NewFromFloat(setting.Withdrawn.MaxWithdrawn)) {
+		return vo.WithdrawReservation{}, model.Transaction{}, fmt.Errorf("%w: %v", ErrAmountAboveMaxWithdrawn, setting.Withdrawn.MaxWithdrawn)
+	}
+
+	toCurrency := req.ToCurrency
+	if toCurrency == "" {
+		toCurrency = req.Currency
+	}
+	if !containsCurrency(setting.Withdrawn.CurrencySupportInput, req.Currency) {
+		return vo.WithdrawReservation{}, model.Transaction{}, fmt.Errorf("%w: %s", ErrCurrencyNotSupported, req.Currency)
+	}
+	if !containsCurrency(setting.Withdrawn.CurrencySupportOutput, toCurrency) {
+		return vo.WithdrawReservation{}, model.Transaction{}, fmt.Errorf("%w: %s", ErrCurrencyNotSupported, toCurrency)
+	}
+
+	rateFrom, ok := rateToUsd(req.RateCurrency, req.Currency)
+	if !ok {
+		return vo.WithdrawReservation{}, model.Transaction{}, fmt.Errorf("%w: %s", ErrRateNotFound, req.Currency)
+	}
+	rateTo, ok := rateToUsd(req.RateCurrency, toCurrency)
+	if !ok {
+		return vo.WithdrawReservation{}, model.Transaction{}, fmt.Errorf("%w: %s", ErrRateNotFound, toCurrency)
+	}
+
+	feeSetting, _ := convert.FindFeeSetting(setting.FeeSetting, consts.TransactionTypeWithdrawn)
+
+	toCurrency = strings.ToLower(toCurrency)
+	rate := money.NewFromFloat(rateFrom).Div(money.NewFromFloat(rateTo))
+	walletRepository := ws.walletRepository.WithTx(tx)
+	transactionRepository := ws.transactionRepository.WithTx(tx)
+
+	if err := walletRepository.LockWallet(req.UserID, req.ProviderKey, currency); err != nil {
+		return vo.WithdrawReservation{}, model.Transaction{}, err
+	}
+	if _, err := transactionRepository.GetTransactionByCode(req.TransactionCode); err == nil {
+		return vo.WithdrawReservation{}, model.Transaction{}, ErrDuplicateTransaction
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return vo.WithdrawReservation{}, model.Transaction{}, err
+	}
+
+	wallet, err := walletRepository.GetWallet(req.UserID, req.ProviderKey, currency)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return vo.WithdrawReservation{}, model.Transaction{}, ErrInsufficientBalance
+		}
+		return vo.WithdrawReservation{}, model.Transaction{}, err
+	}
+	now := time.Now()
+	if _, err := accrueInterest(&wallet, setting, now); err != nil {
+		return vo.WithdrawReservation{}, model.Transaction{}, err
+	}
+	balanceBefore := wallet.Balance
+
+	fee := withdrawFee{
+		UrgentFeePercent:   setting.UrgentWithdrawalFeePercent,
+		WithdrawalFeeFixed: feeSetting.FeeFixed,
+		WithdrawalFeePct:   feeSetting.FeePercent,
+		FeeIn:              feeSetting.FeeIn,
+	}
+	timeDeposit, _ := strconv.ParseInt(wallet.TimeDeposit, 10, 64)
+	fee.UnlockTime = timeDeposit + int64(setting.DepositLockTime)
+	if now.Unix() < fee.UnlockTime {
+		fee.IsLocked = true
+		fee.UrgentFee = req.Amount.Percent(money.NewFromFloat(setting.UrgentWithdrawalFeePercent)).
+			RoundCurrency(currency, money.RoundHalfUp)
+	}
+
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	fee.FreeWithdrawalsUsed, err = transactionRepository.CountTransactionsSince(req.UserID, req.ProviderKey, consts.TransactionTypeWithdrawn, monthStart)
+	if err != nil {
+		return vo.WithdrawReservation{}, model.Transaction{}, err
+	}
+	fee.IsFreeWithdrawal = fee.FreeWithdrawalsUsed < int64(setting.FreeWithdrawalsCount) &&
+		(setting.FreeWithdrawalLimit <= 0 || !req.Amount.GreaterThan(money.NewFromFloat(setting.FreeWithdrawalLimit)))
+	if !fee.IsFreeWithdrawal {
+		fee.WithdrawalFee = money.NewFromFloat(feeSetting.FeeFixed).
+			Add(req.Amount.Percent(money.NewFromFloat(feeSetting.FeePercent))).
+			RoundCurrency(currency, money.RoundHalfUp)
+	}
+	fee.TotalFee = fee.UrgentFee.Add(fee.WithdrawalFee)
+
+	// the urgent fee is always taken from the amount, the regular fee only when FeeIn is set
+	debitAmount := req.Amount
+	netAmount := req.Amount.Sub(fee.UrgentFee)
+	var chargedFee money.Amount
+	if fee.FeeIn {
+		netAmount = netAmount.Sub(fee.WithdrawalFee)
+	} else {
+		chargedFee = fee.WithdrawalFee
+		debitAmount = debitAmount.Add(chargedFee)
+	}
+	if !netAmount.IsPositive() {
+		return vo.WithdrawReservation{}, model.Transaction{}, ErrAmountNotCoverFee
+	}
+	if balanceBefore.LessThan(debitAmount) {
+		return vo.WithdrawReservation{}, model.Transaction{}, ErrInsufficientBalance
+	}
+	receiveAmount := netAmount.Mul(rate).RoundCurrency(toCurrency, money.RoundDown)
+
+	wallet.Balance = balanceBefore.Sub(req.Amount)
+	wallet.DateUpdated = now
+	if err := walletRepository.UpdateWallet(&wallet); err != nil {
+		return vo.WithdrawReservation{}, model.Transaction{}, err
+	}
+
+	details, err := json.Marshal(map[string]interface{}{
+		"providerKey":   req.ProviderKey,
+		"walletId":      wallet.ID,
+		"balanceBefore": balanceBefore,
+		"balanceAfter":  balanceBefore.Sub(debitAmount),
+		"amount":        req.Amount,
+		"debitAmount":   debitAmount,
+		"netAmount":     netAmount,
+		"toCurrency":    toCurrency,
+		"rate":          rate,
+		"receiveAmount": receiveAmount,
+		"fee":           fee,
+		"rateCurrency":  req.RateCurrency,
+	})
+	if err != nil {
+		return vo.WithdrawReservation{}, model.Transaction{}, err
+	}
+
+	transaction := model.Transaction{
+		Details:         details,
+		Amount:          debitAmount,
+		RateUsd:         req.RateUsd,
+		UserID:          req.UserID,
+		DateUpdated:     now,
+		TransactionType: consts.TransactionTypeWithdrawn,
+		Platform:        req.Platform,
+		Icon:            consts.TransactionIconWithdraw,
+		Code:            req.TransactionCode,
+		Status:          consts.TransactionStatusPending,
+		Description:     "Withdraw " + currency,
+		Currency:        currency,
+	}
+	if err := transactionRepository.CreateTransaction(&transaction); err != nil {
+		return vo.WithdrawReservation{}, model.Transaction{}, err
+	}
+	return vo.WithdrawReservation{
+		Request:        *req,
+		TransactionID:  transaction.ID,
+		WalletID:       wallet.ID,
+		Currency:       currency,
+		ReservedAmount: req.Amount,
+		ChargedFee:     chargedFee,
+		BalanceBefore:  balanceBefore,
+	}, transaction, nil
+}
+
+// ReleaseWithdraw credits the reserved amount back to the wallet
+func (ws *withdrawService) ReleaseWithdraw(ctx context.Context, tx *gorm.DB, reservation *vo.WithdrawReservation) error {
+	return ws.creditWallet(tx, reservation, reservation.ReservedAmount)
+}
+
+// ChargeWithdrawFee debits the regular fee when it is not taken from the amount. The balance was checked
+// by ReserveWithdraw but may have been spent meanwhile, then ErrInsufficientBalance is returned.
+func (ws *withdrawService) ChargeWithdrawFee(ctx context.Context, tx *gorm.DB, reservation *vo.WithdrawReservation) error {
+	if !reservation.ChargedFee.IsPositive() {
+		return nil
+	}
+	walletRepository := ws.walletRepository.WithTx(tx)
+	req := reservation.Request
+	if err := walletRepository.LockWallet(req.UserID, req.ProviderKey, reservation.Currency); err != nil {
+		return err
+	}
+	wallet, err := walletRepository.GetWallet(req.UserID, req.ProviderKey, reservation.Currency)
+	if err != nil {
+		return err
+	}
+	if wallet.Balance.LessThan(reservation.ChargedFee) {
+		return ErrInsufficientBalance
+	}
+	wallet.Balance = wallet.Balance.Sub(reservation.ChargedFee)
+	wallet.DateUpdated = time.Now()
+	return walletRepository.UpdateWallet(&wallet)
+}
+
+// RefundWithdrawFee credits the charged fee back to the wallet
+func (ws *withdrawService) RefundWithdrawFee(ctx context.Context, tx *gorm.DB, reservation *vo.WithdrawReservation) error {
+	if !reservation.ChargedFee.IsPositive() {
+		return nil
+	}
+	return ws.creditWallet(tx, reservation, reservation.ChargedFee)
+}
+
+func (ws *withdrawService) creditWallet(tx *gorm.DB, reservation *vo.WithdrawReservation, amount money.Amount) error {
+	walletRepository := ws.walletRepository.WithTx(tx)
+	req := reservation.Request
+	if err := walletRepository.LockWallet(req.UserID, req.ProviderKey, reservation.Currency); err != nil {
+		return err
+	}
+	wallet, err := walletRepository.GetWallet(req.UserID, req.ProviderKey, reservation.Currency)
+	if err != nil {
+		return err
+	}
+	wallet.Balance = wallet.Balance.Add(amount)
+	wallet.DateUpdated = time.Now()
+	return walletRepository.UpdateWallet(&wallet)
+}
+
+// CompleteWithdraw marks the withdrawn transaction successful and writes the withdrawn event to the outbox
+func (ws *withdrawService) CompleteWithdraw(ctx context.Context, tx *gorm.DB, reservation *vo.WithdrawReservation) (model.Transaction, error) {
+	transactionRepository := ws.transactionRepository.WithTx(tx)
+	now := time.Now()
+	if err := transactionRepository.UpdateTransactionStatus(reservation.TransactionID, consts.TransactionStatusSuccess, now); err != nil {
+		return model.Transaction{}, err
+	}
+	transaction, err := transactionRepository.GetTransactionByCode(reservation.Request.TransactionCode)
+	if err != nil {
+		return model.Transaction{}, err
+	}
+	req := reservation.Request
+	wallet, err := ws.walletRepository.WithTx(tx).GetWallet(req.UserID, req.ProviderKey, reservation.Currency)
+	if err != nil {
+		return model.Transaction{}, err
+	}
+	err = enqueueWalletEvent(ws.outboxRepository.WithTx(tx), vo.WalletEvent{
+		Type:            consts.WalletEventWithdrawn,
+		UserID:          req.UserID,
+		ProviderKey:     req.ProviderKey,
+		Currency:        reservation.Currency,
+		WalletID:        reservation.WalletID,
+		TransactionID:   transaction.ID,
+		TransactionCode: transaction.Code,
+		Amount:          transaction.Amount,
+		BalanceBefore:   reservation.BalanceBefore,
+		BalanceAfter:    reservation.BalanceBefore.Sub(transaction.Amount),
+		AmountInterest:  wallet.AmountInterest,
+		OccurredAt:      now.Unix(),
+	})
+	if err != nil {
+		return model.Transaction{}, err
+	}
+	return transaction, nil
+}
+
+func (ws *withdrawService) FailWithdraw(ctx context.Context, tx *gorm.DB, reservation *vo.WithdrawReservation) error {
+	return ws.transactionRepository.WithTx(tx).UpdateTransactionStatus(reservation.TransactionID, consts.TransactionStatusFailed, time.Now())
+}
+
+// rateToUsd looks up the USD rate of a currency, the rate keys are usually upper case
+func rateToUsd(rates consts.CurrencyRates, currency string) (float64, bool) {
+	for _, key := range []string{currency, strings.ToUpper(currency), strings.ToLower(currency)} {
+		if rate, ok := rates[key]; ok && rate.USD > 0 {
+			return rate.USD, true
+		}
+	}
+	return 0, false
+}
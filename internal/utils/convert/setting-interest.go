@@ -3,10 +3,218 @@ package convert
 import (
 	"ecom/internal/model"
 	"ecom/internal/utils/interest"
+	consts "ecom/pkg/const"
+	"encoding/json"
 	"fmt"
+	"sort"
 )
 
-func ConvertSettingInterest(settingInterest model.WalletIntegration) *interest.InterestSetting {
-	fmt.Println("settingInterest", settingInterest)
-	return &interest.InterestSetting{}
+// InterestDetailItem is one entry of the WalletIntegration.InterestDetail JSON column, the rates of
+// Rates apply from the deposit until the end of Cycle. Both are ids of setting rows.
+type InterestDetailItem struct {
+	Cycle int32   `json:"cycle"`
+	Rates []int32 `json:"rates"`
+}
+
+// SettingInterestSource holds the setting rows a wallet integration references
+type SettingInterestSource struct {
+	WalletIntegration model.WalletIntegration
+	InterestRates     []model.PlatformInterestRate
+	Cycles            []model.Cycle
+	TransactionTypes  []model.TransactionType
+	Currencies        []model.WalletIntegrationCurrency
+	Project           *model.Project
+}
+
+// ParseInterestDetail decodes the InterestDetail JSON column
+func ParseInterestDetail(interestDetail string) ([]InterestDetailItem, error) {
+	if interestDetail == "" {
+		return []InterestDetailItem{}, nil
+	}
+	var items []InterestDetailItem
+	if err := json.Unmarshal([]byte(interestDetail), &items); err != nil {
+		return nil, fmt.Errorf("invalid interest detail: %w", err)
+	}
+	return items, nil
+}
+
+// InterestReferences returns the ids of the cycles and platform interest rates a wallet integration
+// references through InterestDetail, InterestDefault and ProfitTakingCycle.
+func InterestReferences(walletIntegration model.WalletIntegration) (cycleIDs []int32, rateIDs []int32, err error) {
+	items, err := ParseInterestDetail(walletIntegration.InterestDetail)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, item := range items {
+		cycleIDs = append(cycleIDs, item.Cycle)
+		rateIDs = append(rateIDs, item.Rates...)
+	}
+	if walletIntegration.InterestDefault != 0 {
+		rateIDs = append(rateIDs, walletIntegration.InterestDefault)
+	}
+	if walletIntegration.ProfitTakingCycle != 0 {
+		cycleIDs = append(cycleIDs, walletIntegration.ProfitTakingCycle)
+	}
+	return cycleIDs, rateIDs, nil
+}
+
+// ConvertSettingInterest builds the interest setting of a wallet integration from its setting rows.
+// Percents are sorted by cycle length because CalculateInterest walks them in order.
+func ConvertSettingInterest(source SettingInterestSource) (*interest.InterestSetting, error) {
+	walletIntegration := source.WalletIntegration
+
+	rateByID := make(map[int32]model.PlatformInterestRate, len(source.InterestRates))
+	for _, rate := range source.InterestRates {
+		rateByID[rate.ID] = rate
+	}
+	cycleByID := make(map[int32]model.Cycle, len(source.Cycles))
+	for _, cycle := range source.Cycles {
+		cycleByID[cycle.ID] = cycle
+	}
+
+	setting := &interest.InterestSetting{
+		ID:                         walletIntegration.ID,
+		DepositLockTime:            int(walletIntegration.DepositLockTime),
+		UrgentWithdrawalFeePercent: walletIntegration.UrgentWithdrawalFeePercent,
+		FreeWithdrawalsCount:       int(walletIntegration.FreeWithdrawalsCount),
+		FreeWithdrawalLimit:        walletIntegration.FreeWithdrawalLimit,
+		CurrencyMergeEnabled:       walletIntegration.CurrencyMergeEnabled,
+		IsAutoTakeProfit:           walletIntegration.IsAutoTakeProfit,
+		Cronjob:                    walletIntegration.Cronjob,
+		Percents:                   []interest.Percent{},
+		Deposit: interest.Deposit{
+			CurrencySupportDeposit: []model.Currency{},
+			MinDeposit:             walletIntegration.MinDeposit,
+		},
+		Withdrawn: interest.Withdrawn{
+			CurrencySupportInput:  []model.Currency{},
+			CurrencySupportOutput: []model.Currency{},
+			MinWithdrawn:          walletIntegration.MinWithdrawn,
+			MaxWithdrawn:          walletIntegration.MaxWithdrawn,
+		},
+		Platform: walletIntegration.Key,
+	}
+	if source.Project != nil && source.Project.Slug != "" {
+		setting.Platform = source.Project.Slug
+	}
+
+	if walletIntegration.InterestDefault != 0 {
+		rate, ok := rateByID[walletIntegration.InterestDefault]
+		if !ok {
+			return nil, fmt.Errorf("invalid interest default: unknown interest rate %d", walletIntegration.InterestDefault)
+		}
+		setting.LockTimeDefault = interest.LockTimeDefault{
+			PercentDefault:         rate.PercentInterest,
+			PercentPrincipal:       rate.PercentPrincipal,
+			LockTimeDefault:        int64(rate.LockTime),
+			PercentForAdminDefault: rate.PercentForAdmin,
+		}
+	}
+
+	if walletIntegration.ProfitTakingCycle != 0 {
+		cycle, ok := cycleByID[walletIntegration.ProfitTakingCycle]
+		if !ok {
+			return nil, fmt.Errorf("invalid profit taking cycle: unknown cycle %d", walletIntegration.ProfitTakingCycle)
+		}
+		setting.ProfitTakingCycle = int(cycle.Value)
+	}
+
+	items, err := ParseInterestDetail(walletIntegration.InterestDetail)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		cycle, ok := cycleByID[item.Cycle]
+		if !ok {
+			return nil, fmt.Errorf("invalid interest detail: unknown cycle %d", item.Cycle)
+		}
+		percent := interest.Percent{
+			Seconds:  int(cycle.Value),
+			Settings: make([]interest.PercentSetting, 0, len(item.Rates)),
+		}
+		for _, rateID := range item.Rates {
+			rate, ok := rateByID[rateID]
+			if !ok {
+				return nil, fmt.Errorf("invalid interest detail: unknown interest rate %d", rateID)
+			}
+			percent.Settings = append(percent.Settings, interest.PercentSetting{
+				PercentPrincipal: rate.PercentPrincipal,
+				LockTime:         int64(rate.LockTime),
+				PercentInterest:  rate.PercentInterest,
+				PercentForAdmin:  rate.PercentForAdmin,
+			})
+		}
+		setting.Percents = append(setting.Percents, percent)
+	}
+	sort.SliceStable(setting.Percents, func(i, j int) bool {
+		return setting.Percents[i].Seconds < setting.Percents[j].Seconds
+	})
+
+	setting.FeeSetting, err = ConvertFeeSetting(walletIntegration.FeeSetting, source.TransactionTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range source.Currencies {
+		switch item.Type {
+		case consts.WalletIntegrationCurrencyTypeDeposit:
+			setting.Deposit.CurrencySupportDeposit = append(setting.Deposit.CurrencySupportDeposit, item.Currency)
+		case consts.WalletIntegrationCurrencyTypeInputWithdrawn:
+			setting.Withdrawn.CurrencySupportInput = append(setting.Withdrawn.CurrencySupportInput, item.Currency)
+		case consts.WalletIntegrationCurrencyTypeOutputWithdrawn:
+			setting.Withdrawn.CurrencySupportOutput = append(setting.Withdrawn.CurrencySupportOutput, item.Currency)
+		}
+	}
+
+	return setting, nil
+}
+
+// feeSettingItem is one entry of the WalletIntegration.FeeSetting JSON column,
+// the transaction type is stored as the id of a transaction_type row.
+type feeSettingItem struct {
+	TransactionType int32   `json:"transactionType"`
+	FeeFixed        float64 `json:"feeFixed"`
+	FeePercent      float64 `json:"feePercent"`
+	FeeIn           bool    `json:"feeIn"`
+}
+
+// ConvertFeeSetting decodes the FeeSetting JSON column and resolves each transaction type
+func ConvertFeeSetting(feeSetting string, transactionTypes []model.TransactionType) ([]interest.FeeSettingItem, error) {
+	if feeSetting == "" {
+		return []interest.FeeSettingItem{}, nil
+	}
+	var items []feeSettingItem
+	if err := json.Unmarshal([]byte(feeSetting), &items); err != nil {
+		return nil, fmt.Errorf("invalid fee setting: %w", err)
+	}
+
+	typeByID := make(map[int32]model.TransactionType, len(transactionTypes))
+	for _, transactionType := range transactionTypes {
+		typeByID[transactionType.ID] = transactionType
+	}
+
+	result := make([]interest.FeeSettingItem, 0, len(items))
+	for _, item := range items {
+		transactionType, ok := typeByID[item.TransactionType]
+		if !ok {
+			return nil, fmt.Errorf("invalid fee setting: unknown transaction type %d", item.TransactionType)
+		}
+		result = append(result, interest.FeeSettingItem{
+			TransactionType: transactionType,
+			FeeFixed:        item.FeeFixed,
+			FeePercent:      item.FeePercent,
+			FeeIn:           item.FeeIn,
+		})
+	}
+	return result, nil
+}
+
+// FindFeeSetting returns the fee configured for a transaction type slug
+func FindFeeSetting(feeSettings []interest.FeeSettingItem, transactionType string) (interest.FeeSettingItem, bool) {
+	for _, feeSetting := range feeSettings {
+		if feeSetting.TransactionType.Slug == transactionType {
+			return feeSetting, true
+		}
+	}
+	return interest.FeeSettingItem{}, false
 }
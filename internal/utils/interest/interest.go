@@ -2,7 +2,7 @@ package interest
 
 import (
 	"ecom/internal/model"
-	"fmt"
+	"ecom/pkg/money"
 	"strconv"
 	"time"
 )
@@ -64,7 +64,9 @@ type InterestSetting struct {
 	Platform                   string           `json:"platform"`
 }
 
-func CalculateInterest(balanceBeforeUpdate *model.Wallet, settings *InterestSetting, nowTime int64) (lastTimeUpdate int64, amountInterestUpdate float64) {
+// CalculateInterest returns the close time and the interest earned on the wallet balance between
+// LastTimeUpdate and nowTime. The interest is exact, callers round it when it is paid out.
+func CalculateInterest(balanceBeforeUpdate *model.Wallet, settings *InterestSetting, nowTime int64) (lastTimeUpdate int64, amountInterestUpdate money.Amount) {
 	//
 	now := time.Now().Unix()
 	if nowTime > 0 {
@@ -73,22 +75,18 @@ func CalculateInterest(balanceBeforeUpdate *model.Wallet, settings *InterestSett
 
 	closeTime := now
 
-	fmt.Println("closeTime", closeTime)
 	percentDefault, lockTimeDefault, percentPrincipalDefault := settings.LockTimeDefault.PercentDefault, settings.LockTimeDefault.LockTimeDefault, settings.LockTimeDefault.PercentPrincipal
 	percents := settings.Percents
 	lastTimeUpdate, err := strconv.ParseInt(balanceBeforeUpdate.LastTimeUpdate, 10, 64)
 	if err != nil {
-		return 0, 0
+		return 0, money.Zero
 	}
 	timeDeposit, err := strconv.ParseInt(balanceBeforeUpdate.TimeDeposit, 10, 64)
 	if err != nil {
-		return 0, 0
+		return 0, money.Zero
 	}
-	balance, err := strconv.ParseFloat(balanceBeforeUpdate.Balance, 64)
-	if err != nil {
-		return 0, 0
-	}
-	amountInterest := 0.0
+	balance := balanceBeforeUpdate.Balance
+	amountInterest := money.Zero
 
 	// Calculate interest for each period
 	if balanceBeforeUpdate.IsNew {
@@ -99,12 +97,16 @@ func CalculateInterest(balanceBeforeUpdate *model.Wallet, settings *InterestSett
 				diffTime := timeCalculate - lastTimeUpdate
 				if diffTime > 0 {
 					for _, setting := range percent.Settings {
-						numberBlock := float64(diffTime) / float64(setting.LockTime)
-						amountClaimed := numberBlock *
-							(balance * (setting.PercentPrincipal / 100)) *
-							(setting.PercentInterest / 100)
-
-						amountInterest += amountClaimed
+						if setting.LockTime <= 0 {
+							continue
+						}
+						// diffTime / LockTime blocks of PercentInterest on PercentPrincipal of the balance
+						amountClaimed := balance.MulInt(diffTime).
+							Percent(money.NewFromFloat(setting.PercentPrincipal)).
+							Percent(money.NewFromFloat(setting.PercentInterest)).
+							Div(money.NewFromInt(setting.LockTime))
+
+						amountInterest = amountInterest.Add(amountClaimed)
 					}
 					lastTimeUpdate = timeCalculate
 				}
@@ -114,23 +116,20 @@ func CalculateInterest(balanceBeforeUpdate *model.Wallet, settings *InterestSett
 	}
 
 	// Apply the default interest after the periods
-	fmt.Println("lastTimeUpdate", lastTimeUpdate, closeTime)
-	if closeTime > lastTimeUpdate {
+	if closeTime > lastTimeUpdate && lockTimeDefault > 0 {
 		diffTime := closeTime - lastTimeUpdate
-		numberBlock := float64(diffTime) / float64(lockTimeDefault)
-		if numberBlock > 0.0 {
-			amountClaimed := numberBlock * balance * (percentPrincipalDefault / 100) * (percentDefault / 100)
-			amountInterest += amountClaimed
-			lastTimeUpdate = closeTime
-		}
+		amountClaimed := balance.MulInt(diffTime).
+			Percent(money.NewFromFloat(percentPrincipalDefault)).
+			Percent(money.NewFromFloat(percentDefault)).
+			Div(money.NewFromInt(lockTimeDefault))
+		amountInterest = amountInterest.Add(amountClaimed)
+		lastTimeUpdate = closeTime
 	}
 
 	return closeTime, amountInterest
 }
 
 func CalculateOutput(now int64, timteDeposit int64, stepTime int64) int64 {
-	fmt.Println("CalculateOutput", now, timteDeposit, stepTime)
-
 	elapsedTime := now - timteDeposit
 	remainingTime := elapsedTime % stepTime
 
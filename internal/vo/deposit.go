@@ -1,6 +1,9 @@
 package vo
 
-import consts "ecom/pkg/const"
+import (
+	consts "ecom/pkg/const"
+	"ecom/pkg/money"
+)
 
 type EncryptedRequest struct {
 	Data string `json:"data"`
@@ -16,7 +19,7 @@ type DepositRequest struct {
 	UserID          string               `json:"userID" binding:"required"`
 	Currency        string               `json:"currency" binding:"required"`
 	RateUsd         float64              `json:"rateUsd" binding:"required"`
-	Amount          float64              `json:"amount" binding:"required"`
+	Amount          money.Amount         `json:"amount" binding:"required" swaggertype:"string" example:"10.5"`
 	ProviderKey     string               `json:"providerKey" binding:"required"`
 	TransactionCode string               `json:"transactionCode" binding:"required"`
 	Platform        string               `json:"platform" binding:"required"`
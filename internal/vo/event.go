@@ -0,0 +1,19 @@
+package vo
+
+import "ecom/pkg/money"
+
+// WalletEvent is the payload of the wallet events published through the outbox
+type WalletEvent struct {
+	Type            string       `json:"type"`
+	UserID          string       `json:"userId"`
+	ProviderKey     string       `json:"providerKey"`
+	Currency        string       `json:"currency"`
+	WalletID        string       `json:"walletId"`
+	TransactionID   string       `json:"transactionId"`
+	TransactionCode string       `json:"transactionCode"`
+	Amount          money.Amount `json:"amount"`
+	BalanceBefore   money.Amount `json:"balanceBefore"`
+	BalanceAfter    money.Amount `json:"balanceAfter"`
+	AmountInterest  money.Amount `json:"amountInterest"`
+	OccurredAt      int64        `json:"occurredAt"`
+}
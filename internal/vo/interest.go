@@ -10,3 +10,7 @@ type InterestRequest struct {
 	Platform        string               `json:"platform" binding:"required"`
 	TransactionCode string               `json:"transactionCode" binding:"required"`
 }
+
+type TakeInterestMessage struct {
+	ProviderKey string `json:"providerKey" binding:"required"`
+}
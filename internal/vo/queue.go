@@ -0,0 +1,17 @@
+package vo
+
+// QueueInfo is the depth of a queue and of its dead letter queue
+type QueueInfo struct {
+	Name        string `json:"name"`
+	Messages    int    `json:"messages"`
+	Consumers   int    `json:"consumers"`
+	DeadLetters int    `json:"deadLetters"`
+	Error       string `json:"error,omitempty"`
+}
+
+// DeadLetterSelectionRequest selects dead letters by message id, or all of them with All. One of the two
+// is required.
+type DeadLetterSelectionRequest struct {
+	MessageIDs []string `json:"messageIds"`
+	All        bool     `json:"all"`
+}
@@ -1,11 +1,14 @@
 package vo
 
-import consts "ecom/pkg/const"
+import (
+	consts "ecom/pkg/const"
+	"ecom/pkg/money"
+)
 
 type WithdrawRequest struct {
 	UserID          string               `json:"userID" binding:"required"`
 	Currency        string               `json:"currency" binding:"required"`
-	Amount          float64              `json:"amount" binding:"required"`
+	Amount          money.Amount         `json:"amount" binding:"required" swaggertype:"string" example:"10.5"`
 	RateUsd         float64              `json:"rateUsd" binding:"required"`
 	ProviderKey     string               `json:"providerKey" binding:"required"`
 	Platform        string               `json:"platform" binding:"required"`
@@ -14,3 +17,16 @@ type WithdrawRequest struct {
 	RateCurrency    consts.CurrencyRates `json:"rateCurrency" binding:"required"`
 	ToCurrency      string               `json:"toCurrency" binding:"omitempty"`
 }
+
+// WithdrawReservation is the state of a withdrawal saga. The reserve step debits ReservedAmount and
+// records the pending transaction, the fee step debits ChargedFee, the regular fee when it is not
+// taken from the amount.
+type WithdrawReservation struct {
+	Request        WithdrawRequest `json:"request"`
+	TransactionID  string          `json:"transactionId"`
+	WalletID       string          `json:"walletId"`
+	Currency       string          `json:"currency"`
+	ReservedAmount money.Amount    `json:"reservedAmount" swaggertype:"string"`
+	ChargedFee     money.Amount    `json:"chargedFee" swaggertype:"string"`
+	BalanceBefore  money.Amount    `json:"balanceBefore" swaggertype:"string"`
+}
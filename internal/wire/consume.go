@@ -14,6 +14,19 @@ func InitializeConsumeHandler() (*messaging.ConsumeMessage, error) {
 	wire.Build(
 		service.NewTestService,
 		repo.NewTestRepository,
+		service.NewWalletService,
+		repo.NewWalletRepository,
+		repo.NewTransactionRepository,
+		repo.NewOutboxRepository,
+		repo.NewMessageRepository,
+		service.NewSettingService,
+		repo.NewSettingRepository,
+		repo.NewWalletIntegrationRepository,
+		repo.NewWalletIntegrationCurrencyRepository,
+		repo.NewPlatformInterestRateRepository,
+		repo.NewCycleRepository,
+		repo.NewTransactionTypeRepository,
+		repo.NewProjectRepository,
 		messaging.NewConsumeMessage,
 	)
 	return new(messaging.ConsumeMessage), nil
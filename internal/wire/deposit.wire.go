@@ -14,7 +14,19 @@ func InitializeDepositHandler() (*controller.DepositController, error) {
 	wire.Build(
 		service.NewDepositService,
 		controller.NewDepositController,
+		service.NewProjectService,
+		repo.NewProjectMemberRepository,
+		repo.NewWalletRepository,
+		repo.NewTransactionRepository,
+		repo.NewOutboxRepository,
+		service.NewSettingService,
+		repo.NewSettingRepository,
+		repo.NewWalletIntegrationRepository,
+		repo.NewWalletIntegrationCurrencyRepository,
+		repo.NewPlatformInterestRateRepository,
 		repo.NewCycleRepository,
+		repo.NewTransactionTypeRepository,
+		repo.NewProjectRepository,
 	)
 	return new(controller.DepositController), nil
 }
@@ -0,0 +1,18 @@
+//go:build wireinject
+
+package wire
+
+import (
+	"ecom/internal/messaging"
+	"ecom/internal/repo"
+
+	"github.com/google/wire"
+)
+
+func InitializeOutboxRelay() (*messaging.OutboxRelay, error) {
+	wire.Build(
+		repo.NewOutboxRepository,
+		messaging.NewOutboxRelay,
+	)
+	return new(messaging.OutboxRelay), nil
+}
@@ -0,0 +1,28 @@
+//go:build wireinject
+
+package wire
+
+import (
+	"ecom/internal/controller"
+	"ecom/internal/repo"
+	"ecom/internal/service"
+
+	"github.com/google/wire"
+)
+
+func InitializeQueueHandler() (*controller.QueueController, error) {
+	wire.Build(
+		controller.NewQueueController,
+		service.NewQueueService,
+		repo.NewAuditLogRepository,
+	)
+	return new(controller.QueueController), nil
+}
+
+func InitializeQueueService() (service.IQueueService, error) {
+	wire.Build(
+		service.NewQueueService,
+		repo.NewAuditLogRepository,
+	)
+	return nil, nil
+}
@@ -4,6 +4,7 @@ package wire
 
 import (
 	"ecom/internal/controller"
+	"ecom/internal/messaging"
 	"ecom/internal/repo"
 	"ecom/internal/service"
 
@@ -15,6 +16,8 @@ func InitializeTestControllerHandler() (*controller.TestController, error) {
 		controller.NewTestController,
 		service.NewTestService,
 		repo.NewTestRepository,
+		messaging.NewSequencer,
+		repo.NewMessageRepository,
 	)
 	return new(controller.TestController), nil
 }
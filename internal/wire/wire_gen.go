@@ -18,7 +18,20 @@ import (
 func InitializeConsumeHandler() (*messaging.ConsumeMessage, error) {
 	iTestRepository := repo.NewTestRepository()
 	iTestService := service.NewTestService(iTestRepository)
-	consumeMessage := messaging.NewConsumeMessage(iTestService)
+	iWalletRepository := repo.NewWalletRepository()
+	iTransactionRepository := repo.NewTransactionRepository()
+	iOutboxRepository := repo.NewOutboxRepository()
+	iSettingRepository := repo.NewSettingRepository()
+	iWalletIntegrationRepository := repo.NewWalletIntegrationRepository()
+	iWalletIntegrationCurrencyRepository := repo.NewWalletIntegrationCurrencyRepository()
+	iPlatformInterestRateRepository := repo.NewPlatformInterestRateRepository()
+	iCycleRepository := repo.NewCycleRepository()
+	iTransactionTypeRepository := repo.NewTransactionTypeRepository()
+	iProjectRepository := repo.NewProjectRepository()
+	iSettingService := service.NewSettingService(iSettingRepository, iWalletIntegrationRepository, iWalletIntegrationCurrencyRepository, iPlatformInterestRateRepository, iCycleRepository, iTransactionTypeRepository, iProjectRepository)
+	iWalletService := service.NewWalletService(iWalletRepository, iTransactionRepository, iOutboxRepository, iSettingService)
+	iMessageRepository := repo.NewMessageRepository()
+	consumeMessage := messaging.NewConsumeMessage(iTestService, iWalletService, iMessageRepository)
 	return consumeMessage, nil
 }
 
@@ -26,16 +39,96 @@ func InitializeConsumeHandler() (*messaging.ConsumeMessage, error) {
 
 func InitializeDepositHandler() (*controller.DepositController, error) {
 	iCycleRepository := repo.NewCycleRepository()
-	iDepositService := service.NewDepositService(iCycleRepository)
-	depositController := controller.NewDepositController(iDepositService)
+	iWalletRepository := repo.NewWalletRepository()
+	iTransactionRepository := repo.NewTransactionRepository()
+	iOutboxRepository := repo.NewOutboxRepository()
+	iSettingRepository := repo.NewSettingRepository()
+	iWalletIntegrationRepository := repo.NewWalletIntegrationRepository()
+	iWalletIntegrationCurrencyRepository := repo.NewWalletIntegrationCurrencyRepository()
+	iPlatformInterestRateRepository := repo.NewPlatformInterestRateRepository()
+	iTransactionTypeRepository := repo.NewTransactionTypeRepository()
+	iProjectRepository := repo.NewProjectRepository()
+	iSettingService := service.NewSettingService(iSettingRepository, iWalletIntegrationRepository, iWalletIntegrationCurrencyRepository, iPlatformInterestRateRepository, iCycleRepository, iTransactionTypeRepository, iProjectRepository)
+	iDepositService := service.NewDepositService(iCycleRepository, iWalletRepository, iTransactionRepository, iOutboxRepository, iSettingService)
+	iProjectMemberRepository := repo.NewProjectMemberRepository()
+	iProjectService := service.NewProjectService(iProjectRepository, iProjectMemberRepository)
+	depositController := controller.NewDepositController(iDepositService, iProjectService)
 	return depositController, nil
 }
 
+// Injectors from outbox.wire.go:
+
+func InitializeOutboxRelay() (*messaging.OutboxRelay, error) {
+	iOutboxRepository := repo.NewOutboxRepository()
+	outboxRelay := messaging.NewOutboxRelay(iOutboxRepository)
+	return outboxRelay, nil
+}
+
+// Injectors from queue.wire.go:
+
+func InitializeQueueHandler() (*controller.QueueController, error) {
+	iAuditLogRepository := repo.NewAuditLogRepository()
+	iQueueService := service.NewQueueService(iAuditLogRepository)
+	queueController := controller.NewQueueController(iQueueService)
+	return queueController, nil
+}
+
+func InitializeQueueService() (service.IQueueService, error) {
+	iAuditLogRepository := repo.NewAuditLogRepository()
+	iQueueService := service.NewQueueService(iAuditLogRepository)
+	return iQueueService, nil
+}
+
 // Injectors from test.wire.go:
 
 func InitializeTestControllerHandler() (*controller.TestController, error) {
 	iTestRepository := repo.NewTestRepository()
 	iTestService := service.NewTestService(iTestRepository)
-	testController := controller.NewTestController(iTestService)
+	iMessageRepository := repo.NewMessageRepository()
+	sequencer := messaging.NewSequencer(iMessageRepository)
+	testController := controller.NewTestController(iTestService, sequencer)
 	return testController, nil
 }
+
+// Injectors from withdraw.wire.go:
+
+func InitializeWithdrawHandler() (*controller.WithdrawController, error) {
+	iSagaRepository := repo.NewSagaRepository()
+	iOutboxRepository := repo.NewOutboxRepository()
+	sagaOrchestrator := messaging.NewSagaOrchestrator(iSagaRepository, iOutboxRepository)
+	iWalletRepository := repo.NewWalletRepository()
+	iTransactionRepository := repo.NewTransactionRepository()
+	iSettingRepository := repo.NewSettingRepository()
+	iWalletIntegrationRepository := repo.NewWalletIntegrationRepository()
+	iWalletIntegrationCurrencyRepository := repo.NewWalletIntegrationCurrencyRepository()
+	iPlatformInterestRateRepository := repo.NewPlatformInterestRateRepository()
+	iCycleRepository := repo.NewCycleRepository()
+	iTransactionTypeRepository := repo.NewTransactionTypeRepository()
+	iProjectRepository := repo.NewProjectRepository()
+	iSettingService := service.NewSettingService(iSettingRepository, iWalletIntegrationRepository, iWalletIntegrationCurrencyRepository, iPlatformInterestRateRepository, iCycleRepository, iTransactionTypeRepository, iProjectRepository)
+	iWithdrawService := service.NewWithdrawService(iWalletRepository, iTransactionRepository, iOutboxRepository, iSettingService)
+	withdrawSaga := messaging.NewWithdrawSaga(sagaOrchestrator, iWithdrawService)
+	iProjectMemberRepository := repo.NewProjectMemberRepository()
+	iProjectService := service.NewProjectService(iProjectRepository, iProjectMemberRepository)
+	withdrawController := controller.NewWithdrawController(withdrawSaga, iProjectService)
+	return withdrawController, nil
+}
+
+func InitializeWithdrawSaga() (*messaging.WithdrawSaga, error) {
+	iSagaRepository := repo.NewSagaRepository()
+	iOutboxRepository := repo.NewOutboxRepository()
+	sagaOrchestrator := messaging.NewSagaOrchestrator(iSagaRepository, iOutboxRepository)
+	iWalletRepository := repo.NewWalletRepository()
+	iTransactionRepository := repo.NewTransactionRepository()
+	iSettingRepository := repo.NewSettingRepository()
+	iWalletIntegrationRepository := repo.NewWalletIntegrationRepository()
+	iWalletIntegrationCurrencyRepository := repo.NewWalletIntegrationCurrencyRepository()
+	iPlatformInterestRateRepository := repo.NewPlatformInterestRateRepository()
+	iCycleRepository := repo.NewCycleRepository()
+	iTransactionTypeRepository := repo.NewTransactionTypeRepository()
+	iProjectRepository := repo.NewProjectRepository()
+	iSettingService := service.NewSettingService(iSettingRepository, iWalletIntegrationRepository, iWalletIntegrationCurrencyRepository, iPlatformInterestRateRepository, iCycleRepository, iTransactionTypeRepository, iProjectRepository)
+	iWithdrawService := service.NewWithdrawService(iWalletRepository, iTransactionRepository, iOutboxRepository, iSettingService)
+	withdrawSaga := messaging.NewWithdrawSaga(sagaOrchestrator, iWithdrawService)
+	return withdrawSaga, nil
+}
@@ -0,0 +1,57 @@
+//go:build wireinject
+
+package wire
+
+import (
+	"ecom/internal/controller"
+	"ecom/internal/messaging"
+	"ecom/internal/repo"
+	"ecom/internal/service"
+
+	"github.com/google/wire"
+)
+
+func InitializeWithdrawHandler() (*controller.WithdrawController, error) {
+	wire.Build(
+		service.NewWithdrawService,
+		messaging.NewSagaOrchestrator,
+		messaging.NewWithdrawSaga,
+		repo.NewSagaRepository,
+		controller.NewWithdrawController,
+		service.NewProjectService,
+		repo.NewProjectMemberRepository,
+		repo.NewWalletRepository,
+		repo.NewTransactionRepository,
+		repo.NewOutboxRepository,
+		service.NewSettingService,
+		repo.NewSettingRepository,
+		repo.NewWalletIntegrationRepository,
+		repo.NewWalletIntegrationCurrencyRepository,
+		repo.NewPlatformInterestRateRepository,
+		repo.NewCycleRepository,
+		repo.NewTransactionTypeRepository,
+		repo.NewProjectRepository,
+	)
+	return new(controller.WithdrawController), nil
+}
+
+func InitializeWithdrawSaga() (*messaging.WithdrawSaga, error) {
+	wire.Build(
+		service.NewWithdrawService,
+		messaging.NewSagaOrchestrator,
+		messaging.NewWithdrawSaga,
+		repo.NewSagaRepository,
+		repo.NewWalletRepository,
+		repo.NewTransactionRepository,
+		repo.NewOutboxRepository,
+		service.NewSettingService,
+		repo.NewSettingRepository,
+		repo.NewWalletIntegrationRepository,
+		repo.NewWalletIntegrationCurrencyRepository,
+		repo.NewPlatformInterestRateRepository,
+		repo.NewCycleRepository,
+		repo.NewTransactionTypeRepository,
+		repo.NewProjectRepository,
+	)
+	return new(messaging.WithdrawSaga), nil
+}
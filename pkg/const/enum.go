@@ -27,7 +27,10 @@ var (
 )
 
 var (
-	HashedExchangeName = "ecom.events.hashed"
+	HashedExchangeName       = "ecom.events.hashed"
+	WalletEventsExchangeName = "ecom.wallet.events"
+	InterestExchangeName     = "ecom.interest.hashed"
+	InterestQueueName        = "ecom.interest"
 )
 
 var (
@@ -35,3 +38,55 @@ var (
 	WalletIntegrationCurrencyTypeInputWithdrawn  = "currency_support_input_withdrawn"
 	WalletIntegrationCurrencyTypeOutputWithdrawn = "currency_support_output_withdrawn"
 )
+
+var (
+	SettingStatusPublished = "published"
+)
+
+var (
+	MessagingTransportRabbitMQ = "rabbitmq"
+	MessagingTransportRedis    = "redis"
+)
+
+var (
+	OutboxStatusPending = "pending"
+	OutboxStatusSent    = "sent"
+)
+
+// a saga runs its steps while running, undoes the completed ones while compensating and ends completed,
+// compensated or failed when a compensation could not be applied
+var (
+	SagaStatusRunning      = "running"
+	SagaStatusCompensating = "compensating"
+	SagaStatusCompleted    = "completed"
+	SagaStatusCompensated  = "compensated"
+	SagaStatusFailed       = "failed"
+)
+
+var (
+	SagaQueueName    = "ecom.sagas"
+	SagaTypeWithdraw = "withdraw"
+)
+
+// actions of the queue administration, recorded in the audit log
+var (
+	AuditActionListQueues       = "queues.list"
+	AuditActionPeekDeadLetters  = "queues.dlq.peek"
+	AuditActionReplayDeadLetter = "queues.dlq.replay"
+	AuditActionPurgeDeadLetter  = "queues.dlq.purge"
+)
+
+// roles and scopes of the bearer token the routes require, RoleAdmin passes every policy and project
+var (
+	RoleAdmin        = "admin"
+	ScopeDeposit     = "wallet:deposit"
+	ScopeWithdraw    = "wallet:withdraw"
+	ScopeQueuesRead  = "queues:read"
+	ScopeQueuesWrite = "queues:write"
+)
+
+var (
+	WalletEventDeposited     = "wallet.deposited"
+	WalletEventWithdrawn     = "wallet.withdrawn"
+	WalletEventInterestTaken = "wallet.interest_taken"
+)
@@ -0,0 +1,44 @@
+package logger
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+type loggerKey struct{}
+
+type correlationIDKey struct{}
+
+// NewContext returns a copy of ctx carrying l, see FromContext
+func NewContext(ctx context.Context, l *zap.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// FromContext returns the logger ctx carries, tagged with the request or message it serves, or the
+// global zap logger, which is global.Logger once initialized
+func FromContext(ctx context.Context) *zap.Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(loggerKey{}).(*zap.Logger); ok {
+			return l
+		}
+	}
+	return zap.L()
+}
+
+// WithCorrelationID returns a copy of ctx carrying id, the X-Request-ID of an HTTP request or the
+// correlation id of a message, and a logger tagging its entries with it. The messages published with
+// ctx carry the same correlation id.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	ctx = context.WithValue(ctx, correlationIDKey{}, id)
+	return NewContext(ctx, FromContext(ctx).With(zap.String("correlationId", id)))
+}
+
+// CorrelationID returns the id set by WithCorrelationID
+func CorrelationID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,284 @@
+package money
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/shopspring/decimal"
+)
+
+// DefaultScale is the number of decimal places kept for a currency without a registered scale
+const DefaultScale int32 = 8
+
+// divisionScale is the number of decimal places kept by Div before the caller rounds
+const divisionScale int32 = 18
+
+type RoundingMode int
+
+const (
+	// RoundHalfUp rounds half away from zero, 1.005 -> 1.01 and -1.005 -> -1.01
+	RoundHalfUp RoundingMode = iota
+	// RoundHalfEven rounds half to the nearest even digit (banker's rounding), 1.005 -> 1.00
+	RoundHalfEven
+	// RoundDown truncates towards zero
+	RoundDown
+	// RoundUp rounds away from zero
+	RoundUp
+	// RoundFloor rounds towards negative infinity
+	RoundFloor
+	// RoundCeil rounds towards positive infinity
+	RoundCeil
+)
+
+var (
+	scalesMu sync.RWMutex
+	scales   = map[string]int32{
+		"usd":  2,
+		"eur":  2,
+		"vnd":  0,
+		"jpy":  0,
+		"usdt": 6,
+		"usdc": 6,
+		"btc":  8,
+		"eth":  18,
+	}
+)
+
+// RegisterScale sets the number of decimal places of a currency
+func RegisterScale(currency string, scale int32) {
+	scalesMu.Lock()
+	defer scalesMu.Unlock()
+	scales[strings.ToLower(currency)] = scale
+}
+
+// Scale returns the number of decimal places of a currency
+func Scale(currency string) int32 {
+	scalesMu.RLock()
+	defer scalesMu.RUnlock()
+	if scale, ok := scales[strings.ToLower(currency)]; ok {
+		return scale
+	}
+	return DefaultScale
+}
+
+// Amount is an exact decimal amount of money. The zero value is 0.
+// It is stored in the database and encoded in JSON as a decimal string.
+type Amount struct {
+	value decimal.Decimal
+}
+
+var Zero = Amount{}
+
+func NewFromInt(value int64) Amount {
+	return Amount{value: decimal.NewFromInt(value)}
+}
+
+// NewFromFloat converts a float64 using its shortest decimal representation, 0.1 becomes exactly 0.1
+func NewFromFloat(value float64) Amount {
+	return Amount{value: decimal.NewFromFloat(value)}
+}
+
+// Parse parses a decimal string, an empty string is 0
+func Parse(value string) (Amount, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return Zero, nil
+	}
+	d, err := decimal.NewFromString(value)
+	if err != nil {
+		return Zero, fmt.Errorf("invalid amount %q: %w", value, err)
+	}
+	return Amount{value: d}, nil
+}
+
+// MustParse is like Parse but panics on an invalid value, it is meant for constants and tests
+func MustParse(value string) Amount {
+	a, err := Parse(value)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+func (a Amount) Add(b Amount) Amount {
+	return Amount{value: a.value.Add(b.value)}
+}
+
+func (a Amount) Sub(b Amount) Amount {
+	return Amount{value: a.value.Sub(b.value)}
+}
+
+func (a Amount) Mul(b Amount) Amount {
+	return Amount{value: a.value.Mul(b.value)}
+}
+
+// Div divides with divisionScale decimal places rounded half up, round the result to the currency afterwards
+func (a Amount) Div(b Amount) Amount {
+	return Amount{value: a.value.DivRound(b.value, divisionScale)}
+}
+
+// MulInt multiplies by an integer factor, for example a number of blocks
+func (a Amount) MulInt(n int64) Amount {
+	return Amount{value: a.value.Mul(decimal.NewFromInt(n))}
+}
+
+// Percent returns percent % of the amount
+func (a Amount) Percent(percent Amount) Amount {
+	return Amount{value: a.value.Mul(percent.value).Div(decimal.NewFromInt(100))}
+}
+
+func (a Amount) Neg() Amount {
+	return Amount{value: a.value.Neg()}
+}
+
+func (a Amount) Abs() Amount {
+	return Amount{value: a.value.Abs()}
+}
+
+// Round rounds to scale decimal places with the given mode
+func (a Amount) Round(scale int32, mode RoundingMode) Amount {
+	var d decimal.Decimal
+	switch mode {
+	case RoundHalfEven:
+		d = a.value.RoundBank(scale)
+	case RoundDown:
+		d = a.value.RoundDown(scale)
+	case RoundUp:
+		d = a.value.RoundUp(scale)
+	case RoundFloor:
+		d = a.value.RoundFloor(scale)
+	case RoundCeil:
+		d = a.value.RoundCeil(scale)
+	default:
+		d = a.value.Round(scale)
+	}
+	return Amount{value: d}
+}
+
+// RoundCurrency rounds to the scale of the currency
+func (a Amount) RoundCurrency(currency string, mode RoundingMode) Amount {
+	return a.Round(Scale(currency), mode)
+}
+
+func (a Amount) Cmp(b Amount) int {
+	return a.value.Cmp(b.value)
+}
+
+func (a Amount) Equal(b Amount) bool {
+	return a.value.Equal(b.value)
+}
+
+func (a Amount) LessThan(b Amount) bool {
+	return a.value.LessThan(b.value)
+}
+
+func (a Amount) GreaterThan(b Amount) bool {
+	return a.value.GreaterThan(b.value)
+}
+
+func (a Amount) Sign() int {
+	return a.value.Sign()
+}
+
+func (a Amount) IsZero() bool {
+	return a.value.IsZero()
+}
+
+func (a Amount) IsPositive() bool {
+	return a.value.IsPositive()
+}
+
+func (a Amount) IsNegative() bool {
+	return a.value.IsNegative()
+}
+
+func Min(a Amount, b Amount) Amount {
+	if a.LessThan(b) {
+		return a
+	}
+	return b
+}
+
+func Max(a Amount, b Amount) Amount {
+	if a.GreaterThan(b) {
+		return a
+	}
+	return b
+}
+
+// Float64 returns the nearest float64, only use it for display or for APIs that require a float
+func (a Amount) Float64() float64 {
+	f, _ := a.value.Float64()
+	return f
+}
+
+// String returns the amount without trailing zeros, 1.50 is "1.5"
+func (a Amount) String() string {
+	return a.value.String()
+}
+
+// StringFixed returns the amount rounded half up with exactly scale decimal places
+func (a Amount) StringFixed(scale int32) string {
+	return a.value.StringFixed(scale)
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+// UnmarshalJSON accepts a JSON string or number, null is 0
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	value := strings.Trim(string(data), `"`)
+	if value == "null" {
+		*a = Zero
+		return nil
+	}
+	parsed, err := Parse(value)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// Scan implements sql.Scanner for numeric, text and float columns, NULL is 0
+func (a *Amount) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*a = Zero
+		return nil
+	case []byte:
+		parsed, err := Parse(string(v))
+		if err != nil {
+			return err
+		}
+		*a = parsed
+		return nil
+	case string:
+		parsed, err := Parse(v)
+		if err != nil {
+			return err
+		}
+		*a = parsed
+		return nil
+	case float64:
+		*a = NewFromFloat(v)
+		return nil
+	case float32:
+		*a = NewFromFloat(float64(v))
+		return nil
+	case int64:
+		*a = NewFromInt(v)
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into money.Amount", src)
+	}
+}
+
+// Value implements driver.Valuer, the amount is written as a decimal string
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
@@ -0,0 +1,95 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestAddIsExact(t *testing.T) {
+	sum := Zero
+	for i := 0; i < 10; i++ {
+		sum = sum.Add(MustParse("0.1"))
+	}
+	if !sum.Equal(NewFromInt(1)) {
+		t.Fatalf("expected 1, got %s", sum)
+	}
+}
+
+func TestRound(t *testing.T) {
+	cases := []struct {
+		value    string
+		mode     RoundingMode
+		expected string
+	}{
+		{"1.005", RoundHalfUp, "1.01"},
+		{"-1.005", RoundHalfUp, "-1.01"},
+		{"1.005", RoundHalfEven, "1"},
+		{"1.015", RoundHalfEven, "1.02"},
+		{"1.009", RoundDown, "1"},
+		{"-1.009", RoundDown, "-1"},
+		{"1.001", RoundUp, "1.01"},
+		{"-1.001", RoundFloor, "-1.01"},
+		{"-1.009", RoundCeil, "-1"},
+	}
+	for _, c := range cases {
+		got := MustParse(c.value).Round(2, c.mode)
+		if got.String() != c.expected {
+			t.Errorf("Round(%s, %d) = %s, expected %s", c.value, c.mode, got, c.expected)
+		}
+	}
+}
+
+func TestRoundCurrency(t *testing.T) {
+	if got := MustParse("1.23456789").RoundCurrency("USD", RoundHalfUp).String(); got != "1.23" {
+		t.Errorf("usd: got %s", got)
+	}
+	if got := MustParse("1500.5").RoundCurrency("vnd", RoundDown).String(); got != "1500" {
+		t.Errorf("vnd: got %s", got)
+	}
+	if got := MustParse("0.123456789").RoundCurrency("unknown", RoundDown).String(); got != "0.12345678" {
+		t.Errorf("default scale: got %s", got)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var v struct {
+		A Amount `json:"a"`
+		B Amount `json:"b"`
+	}
+	if err := json.Unmarshal([]byte(`{"a":"12.345","b":0.1}`), &v); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if v.A.String() != "12.345" || v.B.String() != "0.1" {
+		t.Fatalf("unexpected values %s %s", v.A, v.B)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if string(data) != `{"a":"12.345","b":"0.1"}` {
+		t.Fatalf("unexpected json %s", data)
+	}
+}
+
+func TestScanValue(t *testing.T) {
+	var a Amount
+	for _, src := range []interface{}{[]byte("1.10"), "1.1", 1.1} {
+		if err := a.Scan(src); err != nil {
+			t.Fatalf("Scan(%v) failed: %v", src, err)
+		}
+		if !a.Equal(MustParse("1.1")) {
+			t.Fatalf("Scan(%v) = %s", src, a)
+		}
+	}
+	if err := a.Scan(nil); err != nil || !a.IsZero() {
+		t.Fatalf("Scan(nil) = %s, %v", a, err)
+	}
+	if err := a.Scan("abc"); err == nil {
+		t.Fatal("expected an error for an invalid value")
+	}
+
+	value, err := MustParse("42.50").Value()
+	if err != nil || value != "42.5" {
+		t.Fatalf("Value() = %v, %v", value, err)
+	}
+}
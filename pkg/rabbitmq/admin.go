@@ -0,0 +1,203 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// deadLetterScanLimit bounds the messages held unacked while selecting dead letters by id
+const deadLetterScanLimit = 10000
+
+// QueueAdmin lists the queues and drains their dead letter queues for operators
+type QueueAdmin interface {
+	// QueueNames returns the declared queues
+	QueueNames() []string
+	// PeekDeadLetters returns up to limit messages of the dead letter queue of queueName, they stay queued
+	PeekDeadLetters(ctx context.Context, queueName string, limit int) ([]DeadLetter, error)
+	// ReplayDeadLetters publishes the dead letters with messageIDs, all of them when empty, back to where
+	// they were first published and removes them. It returns the number of replayed messages.
+	ReplayDeadLetters(ctx context.Context, queueName string, messageIDs []string) (int, error)
+	// PurgeDeadLetters drops the dead letters with messageIDs, all of them when empty
+	PurgeDeadLetters(ctx context.Context, queueName string, messageIDs []string) (int, error)
+}
+
+// DeadLetter is a message waiting in a dead letter queue
+type DeadLetter struct {
+	MessageID string `json:"messageId"`
+	// Queue is the queue the message failed in, Exchange and RoutingKey where it is replayed to
+	Queue       string     `json:"queue"`
+	Exchange    string     `json:"exchange"`
+	RoutingKey  string     `json:"routingKey"`
+	Error       string     `json:"error"`
+	RetryCount  int        `json:"retryCount"`
+	EventType   string     `json:"eventType"`
+	ContentType string     `json:"contentType"`
+	Timestamp   time.Time  `json:"timestamp"`
+	Headers     amqp.Table `json:"headers"`
+	Body        []byte     `json:"body"`
+}
+
+// DeadLetterOf reads a dead-lettered delivery of queueName. A message first published through the default
+// exchange has no original exchange header and is replayed straight to its queue.
+func DeadLetterOf(queueName string, msg amqp.Delivery) DeadLetter {
+	letter := DeadLetter{
+		MessageID:   msg.MessageId,
+		Queue:       headerString(msg.Headers, HeaderOriginalQueue),
+		Error:       headerString(msg.Headers, HeaderError),
+		RetryCount:  RetryCount(msg),
+		EventType:   EnvelopeOf(msg).EventType,
+		ContentType: msg.ContentType,
+		Timestamp:   msg.Timestamp,
+		Headers:     msg.Headers,
+		Body:        msg.Body,
+	}
+	if letter.Queue == "" {
+		letter.Queue = queueName
+	}
+	if exchange, ok := msg.Headers[HeaderOriginalExchange].(string); ok {
+		letter.Exchange = exchange
+		letter.RoutingKey = headerString(msg.Headers, HeaderOriginalRoutingKey)
+	} else {
+		letter.RoutingKey = letter.Queue
+	}
+	return letter
+}
+
+// ReplayPublishing is a dead letter published again as a new message, without the headers of its
+// retries and dead-lettering so it gets every retry again. The message keeps its id and is marked with
+// HeaderReplayID so consumers deduplicating by message id run it again.
+func ReplayPublishing(msg amqp.Delivery) amqp.Publishing {
+	publishing := copyPublishing(msg, nil)
+	for _, name := range []string{"x-death", "x-first-death-exchange", "x-first-death-queue", "x-first-death-reason",
+		"x-last-death-exchange", "x-last-death-queue", "x-last-death-reason",
+		HeaderOriginalExchange, HeaderOriginalRoutingKey, HeaderOriginalQueue, HeaderRetryCount, HeaderError} {
+		delete(publishing.Headers, name)
+	}
+	publishing.Headers[HeaderReplayID] = uuid.NewString()
+	return publishing
+}
+
+// selected returns a lookup of messageIDs, nil selects every message
+func selected(messageIDs []string) func(id string) bool {
+	if len(messageIDs) == 0 {
+		return func(string) bool { return true }
+	}
+	ids := make(map[string]bool, len(messageIDs))
+	for _, id := range messageIDs {
+		ids[id] = true
+	}
+	return func(id string) bool { return ids[id] }
+}
+
+// QueueNames returns the queues declared through the manager, including the delay queues of the scheduler
+func (qm *QueueManager) QueueNames() []string {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+	names := make([]string, 0, len(qm.queueSpecs))
+	for name := range qm.queueSpecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (qm *QueueManager) PeekDeadLetters(ctx context.Context, queueName string, limit int) ([]DeadLetter, error) {
+	var letters []DeadLetter
+	_, err := qm.drainDeadLetters(ctx, queueName, limit, func(msg amqp.Delivery) (bool, error) {
+		letters = append(letters, DeadLetterOf(queueName, msg))
+		return false, nil
+	})
+	return letters, err
+}
+
+func (qm *QueueManager) ReplayDeadLetters(ctx context.Context, queueName string, messageIDs []string) (int, error) {
+	isSelected := selected(messageIDs)
+	return qm.drainDeadLetters(ctx, queueName, deadLetterScanLimit, func(msg amqp.Delivery) (bool, error) {
+		if !isSelected(msg.MessageId) {
+			return false, nil
+		}
+		exchange, routingKey := qm.replayRoute(DeadLetterOf(queueName, msg))
+		if err := qm.PublishWithConfirm(ctx, exchange, routingKey, ReplayPublishing(msg)); err != nil {
+			return false, fmt.Errorf("replay message %s: %w", msg.MessageId, err)
+		}
+		return true, nil
+	})
+}
+
+// replayRoute returns where a dead letter is published again. The routing key recorded for an exchange
+// sharded by the client is already the shard queue, hashing it again could pick another shard, so the
+// message goes straight to that queue through the default exchange.
+func (qm *QueueManager) replayRoute(letter DeadLetter) (string, string) {
+	qm.mu.Lock()
+	_, sharded := qm.shards[letter.Exchange]
+	qm.mu.Unlock()
+	if sharded {
+		return "", letter.RoutingKey
+	}
+	return letter.Exchange, letter.RoutingKey
+}
+
+func (qm *QueueManager) PurgeDeadLetters(ctx context.Context, queueName string, messageIDs []string) (int, error) {
+	if len(messageIDs) == 0 {
+		conn, err := qm.connection()
+		if err != nil {
+			return 0, err
+		}
+		ch, err := conn.Channel()
+		if err != nil {
+			return 0, err
+		}
+		defer ch.Close()
+		return ch.QueuePurge(DeadLetterQueueName(queueName), false)
+	}
+	isSelected := selected(messageIDs)
+	return qm.drainDeadLetters(ctx, queueName, deadLetterScanLimit, func(msg amqp.Delivery) (bool, error) {
+		return isSelected(msg.MessageId), nil
+	})
+}
+
+// drainDeadLetters gets up to limit messages of the dead letter queue of queueName on a short-lived
+// channel and hands them to fn, which reports whether the message is done with. Done messages are acked,
+// the others stay unacked until the channel closes and go back to the queue in their order. It returns
+// the number of acked messages.
+func (qm *QueueManager) drainDeadLetters(ctx context.Context, queueName string, limit int, fn func(msg amqp.Delivery) (bool, error)) (int, error) {
+	conn, err := qm.connection()
+	if err != nil {
+		return 0, err
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		return 0, err
+	}
+	defer ch.Close()
+
+	done := 0
+	for i := 0; i < limit; i++ {
+		if err := ctx.Err(); err != nil {
+			return done, err
+		}
+		msg, ok, err := ch.Get(DeadLetterQueueName(queueName), false)
+		if err != nil {
+			return done, err
+		}
+		if !ok {
+			break
+		}
+		ack, err := fn(msg)
+		if err != nil {
+			return done, err
+		}
+		if ack {
+			if err := msg.Ack(false); err != nil {
+				return done, err
+			}
+			done++
+		}
+	}
+	return done, nil
+}
@@ -0,0 +1,63 @@
+package rabbitmq
+
+import (
+	"context"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Publisher sends messages to exchanges
+type Publisher interface {
+	// Publish sends a message without waiting for the broker
+	Publish(exchange, routingKey string, msg amqp.Publishing) error
+	// PublishWithConfirm sends a mandatory message and waits until the broker took it
+	PublishWithConfirm(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) error
+	// PublishToExchange sends a persistent text message and waits until the broker took it
+	PublishToExchange(exchange, routingKey, body string) error
+}
+
+// Consumer is one running consumer of a queue
+type Consumer interface {
+	Queue() string
+	// InFlight returns the number of messages being handled
+	InFlight() int
+	// Stop cancels the consumer and waits until the messages already delivered to it are handled,
+	// it returns ctx.Err() when that takes longer than ctx
+	Stop(ctx context.Context) error
+}
+
+// Subscriber runs handlers on the messages of queues, see Handler for the ack, retry and dead-letter rules
+type Subscriber interface {
+	Consume(queueName string, handler Handler) error
+	StartConsumer(queueName string, handler Handler) (Consumer, error)
+	// QueueDepth returns the number of ready messages and consumers of a queue
+	QueueDepth(queueName string) (messages int, consumers int, err error)
+	// IsLastAttempt reports whether a failure of this delivery dead-letters it instead of retrying it
+	IsLastAttempt(msg amqp.Delivery) bool
+}
+
+// RPCClient publishes requests and waits for the reply a consumer sends to their ReplyTo
+type RPCClient interface {
+	PublishToExchangeAndWait(ctx context.Context, exchange, routingKey, body string) (*QueueResponse, error)
+}
+
+// Declarer declares the exchanges, queues and bindings messages are routed through
+type Declarer interface {
+	ApplyTopology(topology Topology) error
+	DeclareShardedExchange(spec ShardedExchange) error
+}
+
+// Broker is a message broker, QueueManager talks to RabbitMQ and MemoryBroker runs in process for tests
+type Broker interface {
+	Publisher
+	Subscriber
+	RPCClient
+	Declarer
+	Scheduler
+	QueueAdmin
+	State() ConnectionState
+	IsConnected() bool
+	Close() error
+}
+
+var _ Broker = (*QueueManager)(nil)
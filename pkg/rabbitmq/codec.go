@@ -0,0 +1,143 @@
+package rabbitmq
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+	// ContentTypeText is sent by the publishers that predate the envelope, their bodies are JSON
+	ContentTypeText = "text/plain"
+)
+
+// Codec encodes message bodies of one content type
+type Codec interface {
+	Name() string
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	JSONCodec  Codec = jsonCodec{}
+	ProtoCodec Codec = protoCodec{}
+
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{
+		ContentTypeJSON:     JSONCodec,
+		ContentTypeText:     JSONCodec,
+		ContentTypeProtobuf: ProtoCodec,
+	}
+)
+
+// RegisterCodec makes a codec available to CodecFor and CodecByName
+func RegisterCodec(codec Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[codec.ContentType()] = codec
+}
+
+// CodecFor returns the codec of a content type, a message without content type is JSON
+func CodecFor(contentType string) (Codec, error) {
+	if contentType == "" {
+		return JSONCodec, nil
+	}
+	// drop parameters such as "; charset=utf-8"
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = strings.TrimSpace(contentType[:i])
+	}
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	codec, ok := codecs[contentType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported content type %q", contentType)
+	}
+	return codec, nil
+}
+
+// CodecByName returns a codec by its name, "json" when name is empty
+func CodecByName(name string) (Codec, error) {
+	if name == "" {
+		return JSONCodec, nil
+	}
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	for _, codec := range codecs {
+		if codec.Name() == name {
+			return codec, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown codec %q", name)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func (jsonCodec) ContentType() string {
+	return ContentTypeJSON
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// protoCodec encodes proto messages as they are. Other values go through their JSON form into a
+// google.protobuf.Struct, so the existing payload types can be sent as protobuf without generated
+// code. Struct numbers are doubles, integers beyond 2^53 lose precision on that path.
+type protoCodec struct{}
+
+func (protoCodec) Name() string {
+	return "protobuf"
+}
+
+func (protoCodec) ContentType() string {
+	return ContentTypeProtobuf
+}
+
+func (protoCodec) Marshal(v interface{}) ([]byte, error) {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Marshal(m)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("protobuf codec needs an object: %w", err)
+	}
+	s, err := structpb.NewStruct(fields)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(s)
+}
+
+func (protoCodec) Unmarshal(data []byte, v interface{}) error {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(data, m)
+	}
+	var s structpb.Struct
+	if err := proto.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	fields, err := json.Marshal(s.AsMap())
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(fields, v)
+}
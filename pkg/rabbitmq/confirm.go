@@ -0,0 +1,124 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DefaultConfirmTimeout bounds how long PublishToExchange waits for the broker confirmation
+const DefaultConfirmTimeout = 5 * time.Second
+
+// returnedTTL bounds how long a returned message waits for its publisher. The return of a publisher
+// that gave up before the confirmation is never taken and is dropped after it.
+const returnedTTL = time.Minute
+
+var (
+	ErrPublishNacked = errors.New("publish was nacked by the broker")
+	ErrUnroutable    = errors.New("message is unroutable")
+)
+
+// openConfirmChannel opens the channel used by PublishWithConfirm. Unroutable mandatory messages
+// come back on returns, which is buffered so the connection reader never blocks on it.
+func (qm *QueueManager) openConfirmChannel(conn *amqp.Connection) error {
+	ch, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("open confirm channel: %w", err)
+	}
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return fmt.Errorf("enable publisher confirms: %w", err)
+	}
+	returns := ch.NotifyReturn(make(chan amqp.Return, 256))
+
+	qm.connMu.Lock()
+	qm.confirmCh = ch
+	qm.returns = returns
+	qm.connMu.Unlock()
+
+	qm.returnsMu.Lock()
+	qm.returned = make(map[string]returnedMessage)
+	qm.returnsMu.Unlock()
+	qm.watchChannel(conn, ch, "confirm", qm.openConfirmChannel)
+	return nil
+}
+
+func (qm *QueueManager) confirmChannel() (*amqp.Channel, chan amqp.Return, error) {
+	qm.connMu.RLock()
+	defer qm.connMu.RUnlock()
+	if qm.confirmCh == nil || qm.confirmCh.IsClosed() {
+		return nil, nil, ErrNotConnected
+	}
+	return qm.confirmCh, qm.returns, nil
+}
+
+// PublishWithConfirm publishes a mandatory message and waits until the broker confirms it.
+// It returns ErrPublishNacked when the broker could not take the message and ErrUnroutable when
+// no queue is bound for the routing key. A MessageId is generated when msg has none.
+func (qm *QueueManager) PublishWithConfirm(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) error {
+	ch, returns, err := qm.confirmChannel()
+	if err != nil {
+		return err
+	}
+	if msg.MessageId == "" {
+		msg.MessageId = uuid.NewString()
+	}
+
+	routingKey = qm.shardRoutingKey(exchange, routingKey)
+	confirmation, err := ch.PublishWithDeferredConfirmWithContext(ctx, exchange, routingKey, true, false, msg)
+	if err != nil {
+		return err
+	}
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	// the broker sends basic.return before the ack of the same message, so once acked
+	// the return of this message is already buffered in returns
+	if ret, ok := qm.takeReturn(returns, msg.MessageId); ok {
+		return fmt.Errorf("%w: %s %s", ErrUnroutable, exchange, ret.ReplyText)
+	}
+	if !acked {
+		return ErrPublishNacked
+	}
+	return nil
+}
+
+// returnedMessage is a buffered return waiting for its publisher
+type returnedMessage struct {
+	ret amqp.Return
+	at  time.Time
+}
+
+// takeReturn moves the buffered returns into the returned map, drops the ones older than returnedTTL
+// and removes the one of messageID
+func (qm *QueueManager) takeReturn(returns chan amqp.Return, messageID string) (amqp.Return, bool) {
+	qm.returnsMu.Lock()
+	defer qm.returnsMu.Unlock()
+	now := time.Now()
+drain:
+	for {
+		select {
+		case ret, ok := <-returns:
+			if !ok {
+				break drain
+			}
+			qm.returned[ret.MessageId] = returnedMessage{ret: ret, at: now}
+		default:
+			break drain
+		}
+	}
+	for id, returned := range qm.returned {
+		if now.Sub(returned.at) > returnedTTL {
+			delete(qm.returned, id)
+		}
+	}
+	returned, ok := qm.returned[messageID]
+	delete(qm.returned, messageID)
+	return returned.ret, ok
+}
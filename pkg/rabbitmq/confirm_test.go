@@ -0,0 +1,31 @@
+package rabbitmq
+
+import (
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestTakeReturnDropsReturnsNoPublisherTook(t *testing.T) {
+	qm := &QueueManager{returned: make(map[string]returnedMessage)}
+	returns := make(chan amqp.Return, 2)
+	returns <- amqp.Return{MessageId: "abandoned"}
+	returns <- amqp.Return{MessageId: "taken"}
+
+	if _, ok := qm.takeReturn(returns, "taken"); !ok {
+		t.Fatalf("the return of taken was not found")
+	}
+	if _, ok := qm.returned["abandoned"]; !ok {
+		t.Fatalf("the return of another publisher was not kept")
+	}
+
+	// the publisher of abandoned gave up before its return came in
+	qm.returned["abandoned"] = returnedMessage{ret: amqp.Return{MessageId: "abandoned"}, at: time.Now().Add(-2 * returnedTTL)}
+	if _, ok := qm.takeReturn(returns, "other"); ok {
+		t.Fatalf("a return was found for other")
+	}
+	if len(qm.returned) != 0 {
+		t.Fatalf("%d returns left after they expired", len(qm.returned))
+	}
+}
@@ -0,0 +1,274 @@
+package rabbitmq
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.uber.org/zap"
+)
+
+const (
+	reconnectBaseDelay = time.Second
+	reconnectMaxDelay  = 30 * time.Second
+)
+
+type ConnectionState int
+
+const (
+	StateDisconnected ConnectionState = iota
+	StateConnected
+	StateReconnecting
+	StateClosed
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case StateConnected:
+		return "connected"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateClosed:
+		return "closed"
+	default:
+		return "disconnected"
+	}
+}
+
+// connectionState holds the current state and the listeners waiting for its changes
+type connectionState struct {
+	mu        sync.RWMutex
+	value     ConnectionState
+	listeners []chan ConnectionState
+}
+
+func (s *connectionState) get() ConnectionState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.value
+}
+
+func (s *connectionState) set(value ConnectionState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.value == value {
+		return
+	}
+	s.value = value
+	for _, listener := range s.listeners {
+		// a slow listener only misses intermediate states
+		select {
+		case listener <- value:
+		default:
+		}
+	}
+}
+
+// NewQueueManager connects to url and keeps the connection alive. When the first dial fails the manager
+// is returned in StateReconnecting and keeps dialing in the background, declarations and consumers
+// registered in the meantime are applied once connected.
+func NewQueueManager(url string, options ConsumerOptions) *QueueManager {
+	qm := &QueueManager{
+		Queues:    make(map[string]amqp.Queue),
+		Exchanges: make(map[string]ExchangeSpec),
+		Options:   options,
+		url:       url,
+		done:      make(chan struct{}),
+	}
+	if err := qm.connect(); err != nil {
+		zap.L().Error("Failed to connect to RabbitMQ", zap.Error(err))
+		qm.state.set(StateReconnecting)
+		go qm.reconnect()
+	}
+	return qm
+}
+
+// State returns the connection state, health checks report the broker down unless it is StateConnected
+func (qm *QueueManager) State() ConnectionState {
+	return qm.state.get()
+}
+
+func (qm *QueueManager) IsConnected() bool {
+	return qm.State() == StateConnected
+}
+
+// NotifyState returns a channel receiving every connection state change
+func (qm *QueueManager) NotifyState() <-chan ConnectionState {
+	listener := make(chan ConnectionState, 1)
+	qm.state.mu.Lock()
+	qm.state.listeners = append(qm.state.listeners, listener)
+	qm.state.mu.Unlock()
+	return listener
+}
+
+// Close closes the connection and stops reconnecting
+func (qm *QueueManager) Close() error {
+	select {
+	case <-qm.done:
+		return nil
+	default:
+		close(qm.done)
+	}
+	qm.state.set(StateClosed)
+	conn, err := qm.connection()
+	if err != nil {
+		return nil
+	}
+	return conn.Close()
+}
+
+// connect dials the broker, declares the recorded topology and starts the registered consumers
+func (qm *QueueManager) connect() error {
+	conn, err := amqp.Dial(qm.url)
+	if err != nil {
+		return err
+	}
+	qm.connMu.Lock()
+	qm.Conn = conn
+	qm.connMu.Unlock()
+
+	if err := qm.openChannel(conn); err != nil {
+		conn.Close()
+		return err
+	}
+	if err := qm.openConfirmChannel(conn); err != nil {
+		conn.Close()
+		return err
+	}
+	if err := qm.openRPCChannel(conn); err != nil {
+		conn.Close()
+		return err
+	}
+	ch, err := qm.channel()
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if err := qm.redeclare(ch); err != nil {
+		conn.Close()
+		return err
+	}
+
+	qm.mu.Lock()
+	consumers := append([]*amqpConsumer(nil), qm.consumers...)
+	qm.mu.Unlock()
+	for _, consumer := range consumers {
+		if err := qm.startConsumer(conn, consumer); err != nil {
+			conn.Close()
+			return fmt.Errorf("consume %s: %w", consumer.queue, err)
+		}
+	}
+
+	qm.state.set(StateConnected)
+	go qm.watch(conn)
+	return nil
+}
+
+// openChannel opens the shared channel of Publish and the declarations
+func (qm *QueueManager) openChannel(conn *amqp.Connection) error {
+	ch, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("open channel: %w", err)
+	}
+	qm.connMu.Lock()
+	qm.Channel = ch
+	qm.connMu.Unlock()
+	qm.watchChannel(conn, ch, "shared", qm.openChannel)
+	return nil
+}
+
+// redeclare declares the exchanges, queues and bindings recorded by the Declare and Bind methods
+func (qm *QueueManager) redeclare(ch *amqp.Channel) error {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+	for name, spec := range qm.Exchanges {
+		if err := declareExchange(ch, spec); err != nil {
+			return fmt.Errorf("declare exchange %s: %w", name, err)
+		}
+	}
+	for name, spec := range qm.queueSpecs {
+		queue, err := declareQueue(ch, spec)
+		if err != nil {
+			return fmt.Errorf("declare queue %s: %w", name, err)
+		}
+		qm.Queues[name] = queue
+	}
+	for _, binding := range qm.Bindings {
+		if err := ch.QueueBind(binding.Queue, binding.RoutingKey, binding.Exchange, false, binding.Args); err != nil {
+			return fmt.Errorf("bind queue %s: %w", binding.Queue, err)
+		}
+	}
+	return nil
+}
+
+// watch waits for the connection to close and reconnects unless Close was called
+func (qm *QueueManager) watch(conn *amqp.Connection) {
+	reason, ok := <-conn.NotifyClose(make(chan *amqp.Error, 1))
+	select {
+	case <-qm.done:
+		return
+	default:
+	}
+	if ok && reason != nil {
+		zap.L().Warn("RabbitMQ connection closed", zap.Error(reason))
+	} else {
+		zap.L().Warn("RabbitMQ connection closed")
+	}
+	qm.state.set(StateReconnecting)
+	qm.reconnect()
+}
+
+// watchChannel opens a channel again with reopen when the broker closes it on a channel exception, e.g.
+// a failed declare, while the connection stays up. A channel closed by the client or with its connection
+// is left alone, watch reconnects the latter.
+func (qm *QueueManager) watchChannel(conn *amqp.Connection, ch *amqp.Channel, name string, reopen func(conn *amqp.Connection) error) {
+	closed := ch.NotifyClose(make(chan *amqp.Error, 1))
+	go func() {
+		reason, ok := <-closed
+		if !ok || reason == nil {
+			return
+		}
+		for attempt := 1; ; attempt++ {
+			select {
+			case <-qm.done:
+				return
+			default:
+			}
+			if conn.IsClosed() {
+				return
+			}
+			if attempt == 1 {
+				zap.L().Warn("RabbitMQ channel closed, reopening", zap.String("channel", name), zap.Error(reason))
+			}
+			err := reopen(conn)
+			if err == nil {
+				return
+			}
+			zap.L().Error("Failed to reopen RabbitMQ channel", zap.String("channel", name), zap.Int("attempt", attempt), zap.Error(err))
+			select {
+			case <-qm.done:
+				return
+			case <-time.After(RetryDelay(attempt, reconnectBaseDelay, reconnectMaxDelay)):
+			}
+		}
+	}()
+}
+
+// reconnect dials with exponential backoff until it succeeds or the manager is closed
+func (qm *QueueManager) reconnect() {
+	for attempt := 1; ; attempt++ {
+		delay := RetryDelay(attempt, reconnectBaseDelay, reconnectMaxDelay)
+		select {
+		case <-qm.done:
+			return
+		case <-time.After(delay):
+		}
+		if err := qm.connect(); err != nil {
+			zap.L().Error("Failed to reconnect to RabbitMQ", zap.Int("attempt", attempt), zap.Error(err))
+			continue
+		}
+		zap.L().Info("Reconnected to RabbitMQ", zap.Int("attempts", attempt))
+		return
+	}
+}
@@ -0,0 +1,441 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ecom/pkg/logger"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.uber.org/zap"
+)
+
+const (
+	// HeaderRetryCount is the number of times a message has been retried
+	HeaderRetryCount = "x-retry-count"
+	// HeaderError is the last handler error of a retried or dead-lettered message
+	HeaderError = "x-error"
+	// HeaderOriginalExchange and HeaderOriginalRoutingKey record where a dead-lettered message was published
+	HeaderOriginalExchange   = "x-original-exchange"
+	HeaderOriginalRoutingKey = "x-original-routing-key"
+	// HeaderOriginalQueue is the queue a dead-lettered message was consumed from
+	HeaderOriginalQueue = "x-original-queue"
+	// HeaderReplayID marks a dead letter published again by an operator, each replay gets a new id
+	HeaderReplayID = "x-replay-id"
+)
+
+// Handler processes one delivery. Returning nil acks the message, returning an error retries it
+// with backoff until MaxRetries, a Permanent error dead-letters it immediately.
+type Handler func(msg amqp.Delivery) error
+
+// ConsumerOptions configures the consumers started by QueueManager.Consume
+type ConsumerOptions struct {
+	// Prefetch is the number of unacked messages RabbitMQ delivers to one consumer
+	Prefetch int
+	// MaxRetries is the number of retries before a message is dead-lettered
+	MaxRetries int
+	// RetryBaseDelay is the delay of the first retry, each next retry waits twice as long
+	RetryBaseDelay time.Duration
+	// RetryMaxDelay caps the retry delay
+	RetryMaxDelay time.Duration
+	// DeadLetterExchange receives the messages that failed permanently, routed by queue name
+	DeadLetterExchange string
+}
+
+func DefaultConsumerOptions() ConsumerOptions {
+	return ConsumerOptions{
+		Prefetch:           10,
+		MaxRetries:         5,
+		RetryBaseDelay:     time.Second,
+		RetryMaxDelay:      5 * time.Minute,
+		DeadLetterExchange: "ecom.dlx",
+	}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks an error that retrying cannot fix, such as a malformed message
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+// RetryQueueName is the delay queue holding the messages of queueName waiting for their attempt-th retry
+func RetryQueueName(queueName string, attempt int) string {
+	return fmt.Sprintf("%s.retry.%d", queueName, attempt)
+}
+
+// DeadLetterQueueName is the queue collecting the dead-lettered messages of queueName
+func DeadLetterQueueName(queueName string) string {
+	return queueName + ".dlq"
+}
+
+// RetryDelay returns the exponential backoff of an attempt starting at 1
+func RetryDelay(attempt int, base, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= max {
+			return max
+		}
+	}
+	if delay > max {
+		return max
+	}
+	return delay
+}
+
+// RetryCount returns how many times a delivery has been retried
+func RetryCount(msg amqp.Delivery) int {
+	return headerInt(msg.Headers, HeaderRetryCount)
+}
+
+// headerInt reads an integer header, numbers of headers that went through JSON are float64
+func headerInt(headers amqp.Table, name string) int {
+	switch v := headers[name].(type) {
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case int:
+		return v
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+// declareRetryTopology declares the delay queues and the dead letter queue of a consumed queue.
+// A delay queue has no consumer, its messages expire after the retry delay and are dead-lettered
+// through the default exchange straight back to the consumed queue.
+func (qm *QueueManager) declareRetryTopology(ch *amqp.Channel, queueName string, opts ConsumerOptions) error {
+	for attempt := 1; attempt <= opts.MaxRetries; attempt++ {
+		delay := RetryDelay(attempt, opts.RetryBaseDelay, opts.RetryMaxDelay)
+		_, err := ch.QueueDeclare(
+			RetryQueueName(queueName, attempt),
+			true,  // durable
+			false, // auto-delete
+			false, // exclusive
+			false, // no-wait
+			amqp.Table{
+				"x-message-ttl":             delay.Milliseconds(),
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": queueName,
+			},
+		)
+		if err != nil {
+			return fmt.Errorf("declare retry queue: %w", err)
+		}
+	}
+
+	if opts.DeadLetterExchange == "" {
+		return nil
+	}
+	if err := ch.ExchangeDeclare(opts.DeadLetterExchange, amqp.ExchangeDirect, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("declare dead letter exchange: %w", err)
+	}
+	dlq := DeadLetterQueueName(queueName)
+	if _, err := ch.QueueDeclare(dlq, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("declare dead letter queue: %w", err)
+	}
+	if err := ch.QueueBind(dlq, queueName, opts.DeadLetterExchange, false, nil); err != nil {
+		return fmt.Errorf("bind dead letter queue: %w", err)
+	}
+	return nil
+}
+
+// Consume listens to a queue on its own channel with manual acks and processes messages with a handler.
+// Messages are handled one at a time in delivery order, up to Options.Prefetch are buffered.
+// A failed message is acked only once its retry or dead-letter copy has been published,
+// so a crash at any point redelivers it instead of losing it.
+// The consumer is recorded and started again after a reconnect.
+func (qm *QueueManager) Consume(queueName string, handler Handler) error {
+	_, err := qm.StartConsumer(queueName, handler)
+	return err
+}
+
+// amqpConsumer is one consumer of a queue started by StartConsumer, it can be stopped on its own
+type amqpConsumer struct {
+	qm       *QueueManager
+	queue    string
+	handler  Handler
+	tag      string
+	inFlight int32
+
+	mu      sync.Mutex
+	ch      *amqp.Channel
+	done    chan struct{} // closed once the deliveries of the current channel are handled
+	stopped bool
+}
+
+// StartConsumer is Consume returning the consumer so it can be stopped later.
+// While disconnected the consumer is only recorded and starts with the connection.
+func (qm *QueueManager) StartConsumer(queueName string, handler Handler) (Consumer, error) {
+	consumer := &amqpConsumer{
+		qm:      qm,
+		queue:   queueName,
+		handler: handler,
+		tag:     fmt.Sprintf("%s.%s", queueName, uuid.NewString()),
+	}
+	qm.mu.Lock()
+	qm.consumers = append(qm.consumers, consumer)
+	qm.mu.Unlock()
+
+	conn, err := qm.connection()
+	if err != nil {
+		// started by connect once the broker is reachable
+		return consumer, nil
+	}
+	if err := qm.startConsumer(conn, consumer); err != nil {
+		return consumer, err
+	}
+	return consumer, nil
+}
+
+func (c *amqpConsumer) Queue() string {
+	return c.queue
+}
+
+func (c *amqpConsumer) InFlight() int {
+	return int(atomic.LoadInt32(&c.inFlight))
+}
+
+// Stop cancels the consumer, RabbitMQ delivers the rest of the queue to the other consumers.
+// The consumer is not restarted after a reconnect.
+func (c *amqpConsumer) Stop(ctx context.Context) error {
+	c.qm.mu.Lock()
+	for i, consumer := range c.qm.consumers {
+		if consumer == c {
+			c.qm.consumers = append(c.qm.consumers[:i], c.qm.consumers[i+1:]...)
+			break
+		}
+	}
+	c.qm.mu.Unlock()
+
+	c.mu.Lock()
+	c.stopped = true
+	ch, done := c.ch, c.done
+	c.mu.Unlock()
+	if ch == nil || ch.IsClosed() {
+		return nil
+	}
+
+	// waits for cancel-ok, the prefetched deliveries are still handed to the loop before it ends
+	if err := ch.Cancel(c.tag, false); err != nil {
+		return err
+	}
+	select {
+	case <-done:
+		return ch.Close()
+	case <-ctx.Done():
+		go func() {
+			<-done
+			ch.Close()
+		}()
+		return ctx.Err()
+	}
+}
+
+func (qm *QueueManager) startConsumer(conn *amqp.Connection, consumer *amqpConsumer) error {
+	opts := qm.consumerOptions()
+	queueName := consumer.queue
+
+	consumer.mu.Lock()
+	defer consumer.mu.Unlock()
+	if consumer.stopped {
+		return nil
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("open consumer channel: %w", err)
+	}
+	if err := ch.Qos(opts.Prefetch, 0, false); err != nil {
+		ch.Close()
+		return fmt.Errorf("set qos: %w", err)
+	}
+	if err := qm.declareRetryTopology(ch, queueName, opts); err != nil {
+		ch.Close()
+		return err
+	}
+
+	msgs, err := ch.Consume(
+		queueName,
+		consumer.tag,
+		false, // auto-ack
+		false, // exclusive
+		false,
+		false,
+		nil,
+	)
+	if err != nil {
+		ch.Close()
+		return err
+	}
+
+	done := make(chan struct{})
+	consumer.ch = ch
+	consumer.done = done
+	qm.watchChannel(conn, ch, "consumer "+queueName, func(conn *amqp.Connection) error {
+		return qm.startConsumer(conn, consumer)
+	})
+
+	// the delivery channel is closed by Stop, with the connection or on a channel exception, the consumer is
+	// started again by connect or watchChannel
+	go func() {
+		defer close(done)
+		for msg := range msgs {
+			atomic.AddInt32(&consumer.inFlight, 1)
+			qm.handleDelivery(queueName, opts, msg, consumer.handler)
+			atomic.AddInt32(&consumer.inFlight, -1)
+		}
+	}()
+
+	return nil
+}
+
+// QueueDepth returns the number of ready messages and consumers of a queue. It uses a passive declare
+// on a short-lived channel since a missing queue closes the channel.
+func (qm *QueueManager) QueueDepth(queueName string) (messages int, consumers int, err error) {
+	conn, err := qm.connection()
+	if err != nil {
+		return 0, 0, err
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer ch.Close()
+	queue, err := ch.QueueDeclarePassive(queueName, true, false, false, false, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	return queue.Messages, queue.Consumers, nil
+}
+
+// IsLastAttempt reports whether a failure of this delivery dead-letters it instead of retrying it
+func (qm *QueueManager) IsLastAttempt(msg amqp.Delivery) bool {
+	return RetryCount(msg) >= qm.consumerOptions().MaxRetries
+}
+
+// handleDelivery acks a handled message. A failed one is copied to its retry queue or dead-lettered and
+// only acked once the broker confirmed the copy, a copy that could not be published leaves the original
+// to be redelivered.
+func (qm *QueueManager) handleDelivery(queueName string, opts ConsumerOptions, msg amqp.Delivery, handler Handler) {
+	l := logger.FromContext(MessageContext(context.Background(), msg)).With(zap.String("queue", queueName))
+	err := SafeHandle(handler, msg)
+	if err == nil {
+		if err := msg.Ack(false); err != nil {
+			l.Error("Failed to ack message", zap.Error(err))
+		}
+		return
+	}
+
+	attempt := RetryCount(msg) + 1
+	if IsPermanent(err) || attempt > opts.MaxRetries {
+		l.Error("Dead-lettering message", zap.Int("attempt", attempt), zap.Error(err))
+		err = qm.deadLetter(l, queueName, opts, msg, err)
+	} else {
+		l.Warn("Retrying message", zap.Int("attempt", attempt), zap.Error(err))
+		err = qm.republish("", RetryQueueName(queueName, attempt), msg, amqp.Table{
+			HeaderRetryCount: int32(attempt),
+			HeaderError:      err.Error(),
+		})
+	}
+	if err != nil {
+		// the copy could not be published, let RabbitMQ redeliver the original
+		l.Error("Failed to reschedule message", zap.Error(err))
+		if err := msg.Nack(false, true); err != nil {
+			l.Error("Failed to nack message", zap.Error(err))
+		}
+		return
+	}
+	if err := msg.Ack(false); err != nil {
+		l.Error("Failed to ack message", zap.Error(err))
+	}
+}
+
+func (qm *QueueManager) deadLetter(l *zap.Logger, queueName string, opts ConsumerOptions, msg amqp.Delivery, cause error) error {
+	if opts.DeadLetterExchange == "" {
+		l.Warn("No dead letter exchange, dropping message", zap.String("messageId", msg.MessageId), zap.Error(cause))
+		return nil
+	}
+	return qm.republish(opts.DeadLetterExchange, queueName, msg, amqp.Table{
+		HeaderError:         cause.Error(),
+		HeaderOriginalQueue: queueName,
+	})
+}
+
+// republish publishes a copy of a delivery with extra headers on the confirm channel and waits until
+// the broker confirms it
+func (qm *QueueManager) republish(exchange, routingKey string, msg amqp.Delivery, extra amqp.Table) error {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultConfirmTimeout)
+	defer cancel()
+	return qm.PublishWithConfirm(ctx, exchange, routingKey, copyPublishing(msg, extra))
+}
+
+// copyPublishing copies a delivery with extra headers. The exchange and routing key the message
+// was first published to are recorded once, a message coming back from a retry queue keeps them.
+func copyPublishing(msg amqp.Delivery, extra amqp.Table) amqp.Publishing {
+	headers := amqp.Table{}
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	if msg.Exchange != "" {
+		if _, ok := headers[HeaderOriginalExchange]; !ok {
+			headers[HeaderOriginalExchange] = msg.Exchange
+			headers[HeaderOriginalRoutingKey] = msg.RoutingKey
+		}
+	}
+	for k, v := range extra {
+		headers[k] = v
+	}
+	return amqp.Publishing{
+		Headers:         headers,
+		ContentType:     msg.ContentType,
+		ContentEncoding: msg.ContentEncoding,
+		DeliveryMode:    amqp.Persistent,
+		Priority:        msg.Priority,
+		CorrelationId:   msg.CorrelationId,
+		ReplyTo:         msg.ReplyTo,
+		MessageId:       msg.MessageId,
+		Timestamp:       msg.Timestamp,
+		Type:            msg.Type,
+		AppId:           msg.AppId,
+		Body:            msg.Body,
+	}
+}
+
+// SafeHandle runs the handler and turns a panic into an error so the message is retried
+func SafeHandle(handler Handler, msg amqp.Delivery) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.FromContext(MessageContext(context.Background(), msg)).Error("Recovered from panic in consumer", zap.Any("panic", r), zap.ByteString("stack", debug.Stack()))
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return handler(msg)
+}
@@ -0,0 +1,150 @@
+package rabbitmq
+
+import (
+	"context"
+	"time"
+
+	"ecom/pkg/logger"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.uber.org/zap"
+)
+
+const (
+	// HeaderSchemaVersion is the version of the payload schema of the event type
+	HeaderSchemaVersion = "x-schema-version"
+	HeaderEventType     = "x-event-type"
+	HeaderMessageID     = "x-message-id"
+	// HeaderCorrelationID groups the messages of one business operation, the CorrelationId property
+	// is left to request/reply
+	HeaderCorrelationID = "x-correlation-id"
+	HeaderTraceID       = "x-trace-id"
+	HeaderProducer      = "x-producer"
+	// HeaderTimestamp is the publish time in unix milliseconds
+	HeaderTimestamp = "x-timestamp"
+)
+
+// DefaultSchemaVersion is the version of messages published without one, including the bare bodies
+// sent before the envelope existed
+const DefaultSchemaVersion = 1
+
+// Envelope is the metadata of a message, carried in its AMQP headers next to the encoded body
+type Envelope struct {
+	SchemaVersion int
+	EventType     string
+	MessageID     string
+	CorrelationID string
+	TraceID       string
+	Producer      string
+	Timestamp     time.Time
+}
+
+// Apply sets the envelope headers and the matching properties of msg. A missing message id,
+// timestamp or schema version is filled in and returned with the envelope.
+func (e Envelope) Apply(msg *amqp.Publishing) Envelope {
+	if e.SchemaVersion <= 0 {
+		e.SchemaVersion = DefaultSchemaVersion
+	}
+	if e.MessageID == "" {
+		e.MessageID = msg.MessageId
+	}
+	if e.MessageID == "" {
+		e.MessageID = uuid.NewString()
+	}
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+
+	headers := amqp.Table{}
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers[HeaderSchemaVersion] = int32(e.SchemaVersion)
+	headers[HeaderMessageID] = e.MessageID
+	headers[HeaderTimestamp] = e.Timestamp.UnixMilli()
+	setHeader(headers, HeaderEventType, e.EventType)
+	setHeader(headers, HeaderCorrelationID, e.CorrelationID)
+	setHeader(headers, HeaderTraceID, e.TraceID)
+	setHeader(headers, HeaderProducer, e.Producer)
+
+	msg.Headers = headers
+	msg.MessageId = e.MessageID
+	msg.Timestamp = e.Timestamp
+	if e.EventType != "" {
+		msg.Type = e.EventType
+	}
+	return e
+}
+
+func setHeader(headers amqp.Table, name, value string) {
+	if value != "" {
+		headers[name] = value
+	}
+}
+
+// EnvelopeOf reads the envelope of a delivery. Messages without envelope headers fall back to their
+// properties and DefaultSchemaVersion.
+func EnvelopeOf(msg amqp.Delivery) Envelope {
+	e := Envelope{
+		SchemaVersion: headerInt(msg.Headers, HeaderSchemaVersion),
+		EventType:     headerString(msg.Headers, HeaderEventType),
+		MessageID:     headerString(msg.Headers, HeaderMessageID),
+		CorrelationID: headerString(msg.Headers, HeaderCorrelationID),
+		TraceID:       headerString(msg.Headers, HeaderTraceID),
+		Producer:      headerString(msg.Headers, HeaderProducer),
+	}
+	if e.SchemaVersion <= 0 {
+		e.SchemaVersion = DefaultSchemaVersion
+	}
+	if e.EventType == "" {
+		e.EventType = msg.Type
+	}
+	if e.MessageID == "" {
+		e.MessageID = msg.MessageId
+	}
+	if ms := headerInt(msg.Headers, HeaderTimestamp); ms > 0 {
+		e.Timestamp = time.UnixMilli(int64(ms))
+	} else {
+		e.Timestamp = msg.Timestamp
+	}
+	return e
+}
+
+// MessageContext returns a copy of ctx with the correlation id of msg, its message id when it has none,
+// and a logger tagged with the message, see logger.FromContext
+func MessageContext(ctx context.Context, msg amqp.Delivery) context.Context {
+	e := EnvelopeOf(msg)
+	correlationID := e.CorrelationID
+	if correlationID == "" {
+		correlationID = e.MessageID
+	}
+	if correlationID != "" {
+		ctx = logger.WithCorrelationID(ctx, correlationID)
+	}
+	return logger.NewContext(ctx, logger.FromContext(ctx).With(zap.String("messageId", e.MessageID), zap.String("eventType", e.EventType)))
+}
+
+func headerString(headers amqp.Table, name string) string {
+	value, _ := headers[name].(string)
+	return value
+}
+
+// PublishEnvelope encodes v with codec and publishes it with the envelope, see PublishWithConfirm.
+// The correlation id defaults to the one of ctx, the request or message the publish comes from.
+func PublishEnvelope(ctx context.Context, publisher Publisher, exchange, routingKey string, envelope Envelope, codec Codec, v interface{}) error {
+	if envelope.CorrelationID == "" {
+		envelope.CorrelationID = logger.CorrelationID(ctx)
+	}
+	body, err := codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	msg := amqp.Publishing{
+		ContentType:  codec.ContentType(),
+		DeliveryMode: amqp.Persistent,
+		Body:         body,
+	}
+	envelope.Apply(&msg)
+	return publisher.PublishWithConfirm(ctx, exchange, routingKey, msg)
+}
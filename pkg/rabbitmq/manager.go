@@ -1,210 +1,251 @@
 package rabbitmq
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
-	"strings"
 	"sync"
-	"time"
 
-	"github.com/google/uuid"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
+var ErrNotConnected = errors.New("rabbitmq is not connected")
+
 type QueueManager struct {
 	Conn      *amqp.Connection
 	Channel   *amqp.Channel
 	Queues    map[string]amqp.Queue
-	Exchanges map[string]string // name -> type
+	Exchanges map[string]ExchangeSpec
+	Bindings  []Binding
+	Options   ConsumerOptions
 	mu        sync.Mutex
+
+	url        string
+	queueSpecs map[string]QueueSpec
+	shards     map[string][]string // exchange sharded by the client -> shard queues
+	connMu     sync.RWMutex
+	confirmCh  *amqp.Channel
+	returns    chan amqp.Return
+	returnsMu  sync.Mutex
+	returned   map[string]returnedMessage
+	rpc        *rpcClient
+	consumers  []*amqpConsumer
+	schedules  ScheduleStore
+	state      connectionState
+	done       chan struct{}
 }
 
+// Binding is a queue bound to an exchange, recorded so it can be declared again after a reconnect
+type Binding struct {
+	Queue      string
+	Exchange   string
+	RoutingKey string
+	Args       amqp.Table
+}
+
+// QueueResponse is the reply a consumer sends to the ReplyTo of a request
 type QueueResponse struct {
 	CodeResult int
 	Data       *[]byte
 	Error      string
 }
 
-// DeclareExchange safely declares an exchange
+// Decode unmarshals the JSON data of a successful response into v
+func (r *QueueResponse) Decode(v interface{}) error {
+	if r.Data == nil {
+		return fmt.Errorf("empty response: %s", r.Error)
+	}
+	return json.Unmarshal(*r.Data, v)
+}
+
+// channel returns the shared publishing channel
+func (qm *QueueManager) channel() (*amqp.Channel, error) {
+	qm.connMu.RLock()
+	defer qm.connMu.RUnlock()
+	if qm.Channel == nil || qm.Channel.IsClosed() {
+		return nil, ErrNotConnected
+	}
+	return qm.Channel, nil
+}
+
+// connection returns the current connection
+func (qm *QueueManager) connection() (*amqp.Connection, error) {
+	qm.connMu.RLock()
+	defer qm.connMu.RUnlock()
+	if qm.Conn == nil || qm.Conn.IsClosed() {
+		return nil, ErrNotConnected
+	}
+	return qm.Conn, nil
+}
+
+// DeclareExchange safely declares a durable exchange, see DeclareExchangeSpec
 func (qm *QueueManager) DeclareExchange(name, kind string) error {
+	return qm.DeclareExchangeSpec(ExchangeSpec{Name: name, Kind: kind, Durable: true})
+}
+
+// DeclareExchangeSpec declares an exchange. The exchange is recorded once declared and declared again after
+// a reconnect, while disconnected it is only recorded. A failed declare is not recorded.
+func (qm *QueueManager) DeclareExchangeSpec(spec ExchangeSpec) error {
 	qm.mu.Lock()
 	defer qm.mu.Unlock()
 
-	if err := qm.Channel.ExchangeDeclare(
-		name,
-		kind,  // direct, fanout, topic, etc.
-		true,  // durable
-		false, // auto-deleted
-		false, // internal
-		false, // no-wait
-		nil,
-	); err != nil {
-		return err
+	if ch, err := qm.channel(); err == nil {
+		if err := declareExchange(ch, spec); err != nil {
+			return err
+		}
 	}
-
 	if qm.Exchanges == nil {
-		qm.Exchanges = make(map[string]string)
+		qm.Exchanges = make(map[string]ExchangeSpec)
 	}
-	qm.Exchanges[name] = kind
+	qm.Exchanges[spec.Name] = spec
 	return nil
 }
 
-// DeclareQueue declares a queue and stores it in the manager
-func (qm *QueueManager) DeclareQueue(name string) error {
-	// name = test:7 => for and declare queue
+func declareExchange(ch *amqp.Channel, spec ExchangeSpec) error {
+	return ch.ExchangeDeclare(
+		spec.Name,
+		spec.Kind,
+		spec.Durable,
+		spec.AutoDelete,
+		spec.Internal,
+		false, // no-wait
+		spec.Args,
+	)
+}
 
-	qm.mu.Lock()
-	defer qm.mu.Unlock()
-	nameNew := strings.Split(name, ":")[0]
-	number := strings.Split(name, ":")[1]
-	numberInt, err := strconv.Atoi(number)
+// DeclareQueue declares the durable queues of a "name:N" setting, see ShardNames
+func (qm *QueueManager) DeclareQueue(name string) error {
+	names, err := ShardNames(name)
 	if err != nil {
 		return err
 	}
-	for i := 0; i < numberInt; i++ {
-		queue, err := qm.Channel.QueueDeclare(
-			fmt.Sprintf("%s:%d", nameNew, i),
-			true,  // durable
-			false, // auto-delete
-			false, // exclusive
-			false, // no-wait
-			nil,
-		)
-		if err != nil {
+	for _, queueName := range names {
+		if err := qm.DeclareQueueSpec(QueueSpec{Name: queueName, Durable: true}); err != nil {
 			return err
 		}
+	}
+	return nil
+}
 
-		if qm.Queues == nil {
-			qm.Queues = make(map[string]amqp.Queue)
+// DeclareQueueSpec declares one queue and stores it in the manager, Shards is ignored.
+// The queue is recorded once declared and declared again after a reconnect, a failed declare is not recorded.
+func (qm *QueueManager) DeclareQueueSpec(spec QueueSpec) error {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	queue := amqp.Queue{Name: spec.Name}
+	if ch, err := qm.channel(); err == nil {
+		if queue, err = declareQueue(ch, spec); err != nil {
+			return err
 		}
-		qm.Queues[name] = queue
 	}
+	if qm.Queues == nil {
+		qm.Queues = make(map[string]amqp.Queue)
+	}
+	if qm.queueSpecs == nil {
+		qm.queueSpecs = make(map[string]QueueSpec)
+	}
+	qm.queueSpecs[spec.Name] = spec
+	qm.Queues[spec.Name] = queue
 	return nil
 }
 
-// BindQueue binds a queue to an exchange with a routing key
+func declareQueue(ch *amqp.Channel, spec QueueSpec) (amqp.Queue, error) {
+	return ch.QueueDeclare(
+		spec.Name,
+		spec.Durable,
+		spec.AutoDelete,
+		false, // exclusive
+		false, // no-wait
+		spec.arguments(),
+	)
+}
+
+// BindQueue binds the queues of a "name:N" setting to an exchange with weight 1
 func (qm *QueueManager) BindQueue(queueName, exchangeName string) error {
-	number := strings.Split(queueName, ":")[1]
-	name := strings.Split(queueName, ":")[0]
-	numberInt, err := strconv.Atoi(number)
+	names, err := ShardNames(queueName)
 	if err != nil {
 		return err
 	}
-	for i := 0; i < numberInt; i++ {
-		queue := fmt.Sprintf("%s:%d", name, i)
-		fmt.Println("queue", queue)
-		err := qm.Channel.QueueBind(
-			queue,
-			"1",
-			exchangeName,
-			false,
-			nil,
-		)
-		if err != nil {
+	for _, name := range names {
+		if err := qm.Bind(BindingSpec{Queue: name, Exchange: exchangeName, Weight: 1}); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-// PublishToExchange sends a message to an exchange with a routing key
-func (qm *QueueManager) PublishToExchange(exchange, routingKey, body string) error {
-	fmt.Println("PublishToExchange", exchange, routingKey, body)
-	return qm.Channel.Publish(
-		exchange,
-		routingKey,
-		false,
-		false,
-		amqp.Publishing{
-			ContentType: "text/plain",
-			Body:        []byte(body),
-		},
-	)
-}
-
-// PublishToExchangeAndWait publishes a message to an exchange and waits for the response
-func (qm *QueueManager) PublishToExchangeAndWait(exchange, routingKey, body string, timeout time.Duration) (string, error) {
-	// Step 1: Create temporary reply queue
-	replyQueue, err := qm.Channel.QueueDeclare(
-		"",    // name (let RabbitMQ generate one)
-		false, // durable
-		true,  // auto-delete
-		true,  // exclusive
-		false, // no-wait
-		nil,
-	)
-	if err != nil {
-		return "", fmt.Errorf("declare reply queue: %w", err)
+// Bind binds one queue to an exchange. The binding is recorded once bound and declared again after a
+// reconnect, a failed bind is not recorded.
+func (qm *QueueManager) Bind(spec BindingSpec) error {
+	routingKey := spec.RoutingKey
+	if routingKey == "" && spec.Weight > 0 {
+		routingKey = strconv.Itoa(spec.Weight)
 	}
+	binding := Binding{Queue: spec.Queue, Exchange: spec.Exchange, RoutingKey: routingKey, Args: spec.Args}
 
-	// Step 2: Start consuming messages from that reply queue
-	msgs, err := qm.Channel.Consume(
-		replyQueue.Name,
-		"",    // consumer tag
-		true,  // auto-ack
-		true,  // exclusive
-		false, // no-local
-		false, // no-wait
-		nil,
-	)
-	if err != nil {
-		return "", fmt.Errorf("consume reply queue: %w", err)
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+	if ch, err := qm.channel(); err == nil {
+		if err := ch.QueueBind(binding.Queue, binding.RoutingKey, binding.Exchange, false, binding.Args); err != nil {
+			return err
+		}
 	}
+	for _, b := range qm.Bindings {
+		if b.Queue == binding.Queue && b.Exchange == binding.Exchange && b.RoutingKey == binding.RoutingKey {
+			return nil
+		}
+	}
+	qm.Bindings = append(qm.Bindings, binding)
+	return nil
+}
 
-	// Step 3: Generate unique correlation ID
-	corrID := uuid.NewString()
-
-	// Step 4: Publish message to the exchange with replyTo & correlation ID
-	err = qm.Channel.Publish(
+// PublishToExchange sends a persistent message to an exchange with a routing key and waits for
+// the broker to confirm it, see PublishWithConfirm
+func (qm *QueueManager) PublishToExchange(exchange, routingKey, body string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultConfirmTimeout)
+	defer cancel()
+	return qm.PublishWithConfirm(
+		ctx,
 		exchange,
 		routingKey,
-		false,
-		false,
 		amqp.Publishing{
-			ContentType:   "text/plain",
-			CorrelationId: corrID,
-			ReplyTo:       replyQueue.Name,
-			Body:          []byte(body),
+			ContentType:  "text/plain",
+			DeliveryMode: amqp.Persistent,
+			Body:         []byte(body),
 		},
 	)
-	if err != nil {
-		return "", fmt.Errorf("publish failed: %w", err)
-	}
-
-	// Step 5: Wait for the matching response
-	timeoutChan := time.After(timeout)
-	for {
-		select {
-		case msg := <-msgs:
-			if msg.CorrelationId == corrID {
-				return string(msg.Body), nil
-			}
-		case <-timeoutChan:
-			return "", fmt.Errorf("timeout waiting for response")
-		}
-	}
 }
 
-// Consume listens to a queue and processes messages with a handler
-func (qm *QueueManager) Consume(queueName string, handler func(msg amqp.Delivery)) error {
-	msgs, err := qm.Channel.Consume(
-		queueName,
-		"",
-		true,  // auto-ack
-		false, // exclusive
-		false,
-		false,
-		nil,
-	)
+// Publish sends a message on the shared channel, it fails with ErrNotConnected while reconnecting
+func (qm *QueueManager) Publish(exchange, routingKey string, msg amqp.Publishing) error {
+	ch, err := qm.channel()
 	if err != nil {
 		return err
 	}
+	return ch.Publish(exchange, qm.shardRoutingKey(exchange, routingKey), false, false, msg)
+}
 
-	go func() {
-		for msg := range msgs {
-			handler(msg)
-		}
-	}()
+// consumerOptions returns Options with the zero fields set to their default
+func (qm *QueueManager) consumerOptions() ConsumerOptions {
+	return withDefaults(qm.Options)
+}
 
-	return nil
+func withDefaults(opts ConsumerOptions) ConsumerOptions {
+	defaults := DefaultConsumerOptions()
+	if opts.Prefetch <= 0 {
+		opts.Prefetch = defaults.Prefetch
+	}
+	if opts.MaxRetries < 0 {
+		opts.MaxRetries = 0
+	}
+	if opts.RetryBaseDelay <= 0 {
+		opts.RetryBaseDelay = defaults.RetryBaseDelay
+	}
+	if opts.RetryMaxDelay <= 0 {
+		opts.RetryMaxDelay = defaults.RetryMaxDelay
+	}
+	return opts
 }
@@ -0,0 +1,495 @@
+package rabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ecom/pkg/logger"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.uber.org/zap"
+)
+
+// MemoryBroker is an in-process Broker for tests. It routes like RabbitMQ through direct, fanout, topic
+// and x-consistent-hash exchanges, sends replies to direct reply-to, and retries and dead-letters failed
+// messages with the ConsumerOptions of QueueManager. Retried messages wait for their retry delay,
+// tests set short delays in the options.
+type MemoryBroker struct {
+	*RoutingTable
+	options ConsumerOptions
+
+	mu      sync.Mutex
+	queues  map[string]*memoryQueue
+	replies map[string]chan amqp.Delivery
+	timers  map[string]*time.Timer // pending scheduled messages
+	tag     uint64
+	closed  bool
+}
+
+type memoryQueue struct {
+	messages  []amqp.Delivery
+	consumers int
+	ready     *sync.Cond
+}
+
+type memoryConsumer struct {
+	broker   *MemoryBroker
+	queue    string
+	inFlight int32
+	stopped  bool
+	done     chan struct{}
+}
+
+var _ Broker = (*MemoryBroker)(nil)
+
+func NewMemoryBroker(options ConsumerOptions) *MemoryBroker {
+	return &MemoryBroker{
+		RoutingTable: NewRoutingTable(),
+		options:      withDefaults(options),
+		queues:       make(map[string]*memoryQueue),
+		replies:      make(map[string]chan amqp.Delivery),
+		timers:       make(map[string]*time.Timer),
+	}
+}
+
+func (b *MemoryBroker) State() ConnectionState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return StateClosed
+	}
+	return StateConnected
+}
+
+func (b *MemoryBroker) IsConnected() bool {
+	return b.State() == StateConnected
+}
+
+// Close stops the consumers, the messages left in the queues and the scheduled ones are dropped
+func (b *MemoryBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for id, timer := range b.timers {
+		timer.Stop()
+		delete(b.timers, id)
+	}
+	for _, queue := range b.queues {
+		queue.ready.Broadcast()
+	}
+	return nil
+}
+
+// queue returns the messages of a queue. b.mu must be held.
+func (b *MemoryBroker) queue(name string) *memoryQueue {
+	queue, ok := b.queues[name]
+	if !ok {
+		queue = &memoryQueue{ready: sync.NewCond(&b.mu)}
+		b.queues[name] = queue
+	}
+	return queue
+}
+
+// publish routes a message and returns the number of queues it was delivered to
+func (b *MemoryBroker) publish(exchange, routingKey string, msg amqp.Publishing) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return 0, ErrNotConnected
+	}
+	if exchange == "" && strings.HasPrefix(routingKey, directReplyTo) {
+		if waiter, ok := b.replies[msg.CorrelationId]; ok {
+			delete(b.replies, msg.CorrelationId)
+			waiter <- b.delivery(exchange, routingKey, msg)
+			return 1, nil
+		}
+		return 0, nil
+	}
+	queues, err := b.Route(exchange, routingKey)
+	if err != nil {
+		return 0, err
+	}
+	for _, name := range queues {
+		b.enqueue(name, b.delivery(exchange, routingKey, msg))
+	}
+	return len(queues), nil
+}
+
+// enqueue adds a delivery to a queue and wakes a consumer. b.mu must be held.
+func (b *MemoryBroker) enqueue(name string, delivery amqp.Delivery) {
+	queue := b.queue(name)
+	queue.messages = append(queue.messages, delivery)
+	queue.ready.Signal()
+}
+
+// delivery builds the delivery of a published message. b.mu must be held.
+func (b *MemoryBroker) delivery(exchange, routingKey string, msg amqp.Publishing) amqp.Delivery {
+	b.tag++
+	return amqp.Delivery{
+		Headers:         msg.Headers,
+		ContentType:     msg.ContentType,
+		ContentEncoding: msg.ContentEncoding,
+		DeliveryMode:    msg.DeliveryMode,
+		Priority:        msg.Priority,
+		CorrelationId:   msg.CorrelationId,
+		ReplyTo:         msg.ReplyTo,
+		Expiration:      msg.Expiration,
+		MessageId:       msg.MessageId,
+		Timestamp:       msg.Timestamp,
+		Type:            msg.Type,
+		UserId:          msg.UserId,
+		AppId:           msg.AppId,
+		DeliveryTag:     b.tag,
+		Exchange:        exchange,
+		RoutingKey:      routingKey,
+		Body:            msg.Body,
+	}
+}
+
+func (b *MemoryBroker) Publish(exchange, routingKey string, msg amqp.Publishing) error {
+	_, err := b.publish(exchange, routingKey, msg)
+	return err
+}
+
+func (b *MemoryBroker) PublishWithConfirm(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if msg.MessageId == "" {
+		msg.MessageId = uuid.NewString()
+	}
+	routed, err := b.publish(exchange, routingKey, msg)
+	if err != nil {
+		return err
+	}
+	if routed == 0 {
+		return fmt.Errorf("%w: %s", ErrUnroutable, exchange)
+	}
+	return nil
+}
+
+func (b *MemoryBroker) PublishToExchange(exchange, routingKey, body string) error {
+	return b.PublishWithConfirm(context.Background(), exchange, routingKey, amqp.Publishing{
+		ContentType:  "text/plain",
+		DeliveryMode: amqp.Persistent,
+		Body:         []byte(body),
+	})
+}
+
+// Schedule publishes msg with a timer, scheduled messages do not outlive the broker
+func (b *MemoryBroker) Schedule(ctx context.Context, exchange, routingKey string, msg amqp.Publishing, at time.Time) (string, error) {
+	if msg.MessageId == "" {
+		msg.MessageId = uuid.NewString()
+	}
+	id := msg.MessageId
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return "", ErrNotConnected
+	}
+	b.timers[id] = time.AfterFunc(time.Until(at), func() {
+		b.mu.Lock()
+		_, pending := b.timers[id]
+		delete(b.timers, id)
+		b.mu.Unlock()
+		if !pending {
+			return
+		}
+		if err := b.PublishWithConfirm(context.Background(), exchange, routingKey, msg); err != nil {
+			zap.L().Error("Failed to publish scheduled message", zap.String("scheduleId", id), zap.Error(err))
+		}
+	})
+	return id, nil
+}
+
+func (b *MemoryBroker) PublishDelayed(exchange, routingKey, body string, delay time.Duration) (string, error) {
+	return b.PublishAt(exchange, routingKey, body, time.Now().Add(delay))
+}
+
+func (b *MemoryBroker) PublishAt(exchange, routingKey, body string, at time.Time) (string, error) {
+	return b.Schedule(context.Background(), exchange, routingKey, amqp.Publishing{
+		ContentType:  "text/plain",
+		DeliveryMode: amqp.Persistent,
+		Body:         []byte(body),
+	}, at)
+}
+
+func (b *MemoryBroker) CancelScheduled(ctx context.Context, id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	timer, ok := b.timers[id]
+	if !ok {
+		return ErrScheduleNotFound
+	}
+	timer.Stop()
+	delete(b.timers, id)
+	return nil
+}
+
+func (b *MemoryBroker) PublishToExchangeAndWait(ctx context.Context, exchange, routingKey, body string) (*QueueResponse, error) {
+	corrID := uuid.NewString()
+	waiter := make(chan amqp.Delivery, 1)
+	b.mu.Lock()
+	b.replies[corrID] = waiter
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.replies, corrID)
+		b.mu.Unlock()
+	}()
+
+	err := b.PublishWithConfirm(ctx, exchange, routingKey, amqp.Publishing{
+		ContentType:   "text/plain",
+		CorrelationId: corrID,
+		ReplyTo:       directReplyTo,
+		Body:          []byte(body),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case reply := <-waiter:
+		var response QueueResponse
+		if err := json.Unmarshal(reply.Body, &response); err != nil {
+			return nil, fmt.Errorf("decode response: %w", err)
+		}
+		return &response, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (b *MemoryBroker) Consume(queueName string, handler Handler) error {
+	_, err := b.StartConsumer(queueName, handler)
+	return err
+}
+
+// StartConsumer runs handler on the messages of a queue one at a time, a queue with several consumers
+// hands each message to one of them
+func (b *MemoryBroker) StartConsumer(queueName string, handler Handler) (Consumer, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, ErrNotConnected
+	}
+	if !b.HasQueue(queueName) {
+		return nil, fmt.Errorf("queue %s not found", queueName)
+	}
+	queue := b.queue(queueName)
+	queue.consumers++
+	consumer := &memoryConsumer{broker: b, queue: queueName, done: make(chan struct{})}
+	go consumer.run(queue, handler)
+	return consumer, nil
+}
+
+func (c *memoryConsumer) run(queue *memoryQueue, handler Handler) {
+	b := c.broker
+	defer close(c.done)
+	for {
+		b.mu.Lock()
+		for len(queue.messages) == 0 && !c.stopped && !b.closed {
+			queue.ready.Wait()
+		}
+		if c.stopped || b.closed {
+			queue.consumers--
+			b.mu.Unlock()
+			return
+		}
+		msg := queue.messages[0]
+		queue.messages = queue.messages[1:]
+		atomic.AddInt32(&c.inFlight, 1)
+		b.mu.Unlock()
+
+		b.handleDelivery(c.queue, msg, handler)
+		atomic.AddInt32(&c.inFlight, -1)
+	}
+}
+
+func (c *memoryConsumer) Queue() string {
+	return c.queue
+}
+
+func (c *memoryConsumer) InFlight() int {
+	return int(atomic.LoadInt32(&c.inFlight))
+}
+
+func (c *memoryConsumer) Stop(ctx context.Context) error {
+	b := c.broker
+	b.mu.Lock()
+	c.stopped = true
+	b.queues[c.queue].ready.Broadcast()
+	b.mu.Unlock()
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// handleDelivery acks, retries or dead-letters a message like QueueManager
+func (b *MemoryBroker) handleDelivery(queueName string, msg amqp.Delivery, handler Handler) {
+	err := SafeHandle(handler, msg)
+	if err == nil {
+		return
+	}
+
+	attempt := RetryCount(msg) + 1
+	l := logger.FromContext(MessageContext(context.Background(), msg)).With(zap.String("queue", queueName), zap.Int("attempt", attempt))
+	if IsPermanent(err) || attempt > b.options.MaxRetries {
+		l.Error("Dead-lettering message", zap.Error(err))
+		if b.options.DeadLetterExchange == "" {
+			return
+		}
+		retry := copyPublishing(msg, amqp.Table{
+			HeaderError:         err.Error(),
+			HeaderOriginalQueue: queueName,
+		})
+		b.mu.Lock()
+		b.enqueue(DeadLetterQueueName(queueName), b.delivery(b.options.DeadLetterExchange, queueName, retry))
+		b.mu.Unlock()
+		return
+	}
+
+	l.Warn("Retrying message", zap.Error(err))
+	retry := copyPublishing(msg, amqp.Table{
+		HeaderRetryCount: int32(attempt),
+		HeaderError:      err.Error(),
+	})
+	delay := RetryDelay(attempt, b.options.RetryBaseDelay, b.options.RetryMaxDelay)
+	time.AfterFunc(delay, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		// dead-lettered from the delay queue through the default exchange
+		b.enqueue(queueName, b.delivery("", queueName, retry))
+	})
+}
+
+func (b *MemoryBroker) QueueDepth(queueName string) (int, int, error) {
+	if !b.HasQueue(queueName) {
+		return 0, 0, fmt.Errorf("queue %s not found", queueName)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	queue := b.queue(queueName)
+	return len(queue.messages), queue.consumers, nil
+}
+
+func (b *MemoryBroker) IsLastAttempt(msg amqp.Delivery) bool {
+	return RetryCount(msg) >= b.options.MaxRetries
+}
+
+// Messages returns the messages waiting in a queue, such as a dead letter queue, without consuming them
+func (b *MemoryBroker) Messages(queueName string) []amqp.Delivery {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	queue, ok := b.queues[queueName]
+	if !ok {
+		return nil
+	}
+	return append([]amqp.Delivery(nil), queue.messages...)
+}
+
+func (b *MemoryBroker) PeekDeadLetters(ctx context.Context, queueName string, limit int) ([]DeadLetter, error) {
+	messages := b.Messages(DeadLetterQueueName(queueName))
+	if len(messages) > limit {
+		messages = messages[:limit]
+	}
+	letters := make([]DeadLetter, 0, len(messages))
+	for _, msg := range messages {
+		letters = append(letters, DeadLetterOf(queueName, msg))
+	}
+	return letters, nil
+}
+
+// ReplayDeadLetters removes each message once it is published again, the messages left after a
+// failed publish stay in the dead letter queue
+func (b *MemoryBroker) ReplayDeadLetters(ctx context.Context, queueName string, messageIDs []string) (int, error) {
+	isSelected := selected(messageIDs)
+	replayed := 0
+	for _, msg := range b.Messages(DeadLetterQueueName(queueName)) {
+		if !isSelected(msg.MessageId) {
+			continue
+		}
+		letter := DeadLetterOf(queueName, msg)
+		if err := b.PublishWithConfirm(ctx, letter.Exchange, letter.RoutingKey, ReplayPublishing(msg)); err != nil {
+			return replayed, fmt.Errorf("replay message %s: %w", msg.MessageId, err)
+		}
+		b.removeDeadLetter(queueName, msg.DeliveryTag)
+		replayed++
+	}
+	return replayed, nil
+}
+
+func (b *MemoryBroker) PurgeDeadLetters(ctx context.Context, queueName string, messageIDs []string) (int, error) {
+	return len(b.takeDeadLetters(queueName, messageIDs)), nil
+}
+
+// takeDeadLetters removes the selected messages from the dead letter queue of queueName
+func (b *MemoryBroker) takeDeadLetters(queueName string, messageIDs []string) []amqp.Delivery {
+	isSelected := selected(messageIDs)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	queue, ok := b.queues[DeadLetterQueueName(queueName)]
+	if !ok {
+		return nil
+	}
+	var taken, kept []amqp.Delivery
+	for _, msg := range queue.messages {
+		if isSelected(msg.MessageId) {
+			taken = append(taken, msg)
+		} else {
+			kept = append(kept, msg)
+		}
+	}
+	queue.messages = kept
+	return taken
+}
+
+// removeDeadLetter removes the message with deliveryTag from the dead letter queue of queueName
+func (b *MemoryBroker) removeDeadLetter(queueName string, deliveryTag uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	queue, ok := b.queues[DeadLetterQueueName(queueName)]
+	if !ok {
+		return
+	}
+	for i, msg := range queue.messages {
+		if msg.DeliveryTag == deliveryTag {
+			queue.messages = append(queue.messages[:i], queue.messages[i+1:]...)
+			return
+		}
+	}
+}
+
+// MatchTopic reports whether a routing key matches a topic binding pattern, "*" matches
+// one dot separated word and "#" zero or more words
+func MatchTopic(pattern, routingKey string) bool {
+	return matchWords(strings.Split(pattern, "."), strings.Split(routingKey, "."))
+}
+
+func matchWords(pattern, words []string) bool {
+	if len(pattern) == 0 {
+		return len(words) == 0
+	}
+	switch pattern[0] {
+	case "#":
+		for i := 0; i <= len(words); i++ {
+			if matchWords(pattern[1:], words[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(words) > 0 && matchWords(pattern[1:], words[1:])
+	default:
+		return len(words) > 0 && pattern[0] == words[0] && matchWords(pattern[1:], words[1:])
+	}
+}
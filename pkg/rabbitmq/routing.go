@@ -0,0 +1,175 @@
+package rabbitmq
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// RoutingTable routes messages the way the RabbitMQ exchanges do, for the brokers that route in process.
+// It supports direct, fanout, topic and x-consistent-hash exchanges and the default exchange.
+type RoutingTable struct {
+	mu        sync.RWMutex
+	exchanges map[string]ExchangeSpec
+	queues    map[string]QueueSpec
+	bindings  []Binding
+	shards    map[string][]string
+}
+
+func NewRoutingTable() *RoutingTable {
+	return &RoutingTable{
+		exchanges: make(map[string]ExchangeSpec),
+		queues:    make(map[string]QueueSpec),
+		shards:    make(map[string][]string),
+	}
+}
+
+func (t *RoutingTable) ApplyTopology(topology Topology) error {
+	return applyTopology(t, topology)
+}
+
+func (t *RoutingTable) DeclareShardedExchange(spec ShardedExchange) error {
+	topology, queues, err := shardedTopology(spec)
+	if err != nil {
+		return err
+	}
+	if err := t.ApplyTopology(topology); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if spec.Mode == ShardByClient {
+		t.shards[spec.Exchange] = queues
+	} else {
+		delete(t.shards, spec.Exchange)
+	}
+	return nil
+}
+
+func (t *RoutingTable) DeclareExchange(name, kind string) error {
+	return t.DeclareExchangeSpec(ExchangeSpec{Name: name, Kind: kind, Durable: true})
+}
+
+func (t *RoutingTable) DeclareExchangeSpec(spec ExchangeSpec) error {
+	switch spec.Kind {
+	case amqp.ExchangeDirect, amqp.ExchangeFanout, amqp.ExchangeTopic, ExchangeConsistentHash:
+	default:
+		return fmt.Errorf("exchange type %q is not supported", spec.Kind)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if declared, ok := t.exchanges[spec.Name]; ok && declared.Kind != spec.Kind {
+		return fmt.Errorf("exchange %s already declared as %s", spec.Name, declared.Kind)
+	}
+	t.exchanges[spec.Name] = spec
+	return nil
+}
+
+// DeclareQueue declares the queues of a "name:N" setting, see ShardNames
+func (t *RoutingTable) DeclareQueue(name string) error {
+	names, err := ShardNames(name)
+	if err != nil {
+		return err
+	}
+	for _, queueName := range names {
+		if err := t.DeclareQueueSpec(QueueSpec{Name: queueName, Durable: true}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *RoutingTable) DeclareQueueSpec(spec QueueSpec) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.queues[spec.Name] = spec
+	return nil
+}
+
+func (t *RoutingTable) Bind(spec BindingSpec) error {
+	routingKey := spec.RoutingKey
+	if routingKey == "" && spec.Weight > 0 {
+		routingKey = fmt.Sprint(spec.Weight)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.exchanges[spec.Exchange]; !ok {
+		return fmt.Errorf("exchange %s not found", spec.Exchange)
+	}
+	if _, ok := t.queues[spec.Queue]; !ok {
+		return fmt.Errorf("queue %s not found", spec.Queue)
+	}
+	for _, binding := range t.bindings {
+		if binding.Queue == spec.Queue && binding.Exchange == spec.Exchange && binding.RoutingKey == routingKey {
+			return nil
+		}
+	}
+	t.bindings = append(t.bindings, Binding{Queue: spec.Queue, Exchange: spec.Exchange, RoutingKey: routingKey, Args: spec.Args})
+	return nil
+}
+
+func (t *RoutingTable) HasQueue(name string) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	_, ok := t.queues[name]
+	return ok
+}
+
+// QueueNames returns the declared queues
+func (t *RoutingTable) QueueNames() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	names := make([]string, 0, len(t.queues))
+	for name := range t.queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Route returns the queues a message published to exchange with routingKey is delivered to
+func (t *RoutingTable) Route(exchange, routingKey string) ([]string, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if exchange == "" {
+		if _, ok := t.queues[routingKey]; ok {
+			return []string{routingKey}, nil
+		}
+		return nil, nil
+	}
+	spec, ok := t.exchanges[exchange]
+	if !ok {
+		return nil, fmt.Errorf("exchange %s not found", exchange)
+	}
+	if queues, ok := t.shards[exchange]; ok {
+		routingKey = queues[ShardIndex(routingKey, len(queues))]
+	}
+
+	var queues []string
+	seen := make(map[string]bool)
+	for _, binding := range t.bindings {
+		if binding.Exchange != exchange || seen[binding.Queue] {
+			continue
+		}
+		match := false
+		switch spec.Kind {
+		case amqp.ExchangeDirect:
+			match = binding.RoutingKey == routingKey
+		case amqp.ExchangeFanout, ExchangeConsistentHash:
+			match = true
+		case amqp.ExchangeTopic:
+			match = MatchTopic(binding.RoutingKey, routingKey)
+		}
+		if match {
+			seen[binding.Queue] = true
+			queues = append(queues, binding.Queue)
+		}
+	}
+	// the plugin hashes the routing key onto one bound queue, the binding weights are ignored here
+	if spec.Kind == ExchangeConsistentHash && len(queues) > 0 {
+		queues = []string{queues[ShardIndex(routingKey, len(queues))]}
+	}
+	return queues, nil
+}
@@ -0,0 +1,180 @@
+package rabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// directReplyTo is the pseudo queue of RabbitMQ direct reply-to, replies are pushed straight
+// to the consumer of the channel that published the request without declaring a queue
+const directReplyTo = "amq.rabbitmq.reply-to"
+
+type rpcResult struct {
+	msg amqp.Delivery
+	err error
+}
+
+// rpcClient publishes requests on one channel per connection and routes the replies to the waiting
+// calls by CorrelationId. Direct reply-to requires the publish and the consumer to share the channel.
+type rpcClient struct {
+	ch      *amqp.Channel
+	mu      sync.Mutex
+	pending map[string]chan rpcResult
+	closed  bool
+}
+
+// openRPCChannel opens the channel used by PublishToExchangeAndWait and starts the reply consumer
+func (qm *QueueManager) openRPCChannel(conn *amqp.Connection) error {
+	ch, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("open rpc channel: %w", err)
+	}
+	replies, err := ch.Consume(
+		directReplyTo,
+		"",
+		true,  // auto-ack, required by direct reply-to
+		true,  // exclusive
+		false, // no-local
+		false, // no-wait
+		nil,
+	)
+	if err != nil {
+		ch.Close()
+		return fmt.Errorf("consume replies: %w", err)
+	}
+	returns := ch.NotifyReturn(make(chan amqp.Return, 16))
+
+	client := &rpcClient{
+		ch:      ch,
+		pending: make(map[string]chan rpcResult),
+	}
+	go client.dispatch(replies, returns)
+
+	qm.connMu.Lock()
+	qm.rpc = client
+	qm.connMu.Unlock()
+	qm.watchChannel(conn, ch, "rpc", qm.openRPCChannel)
+	return nil
+}
+
+func (qm *QueueManager) rpcClient() (*rpcClient, error) {
+	qm.connMu.RLock()
+	defer qm.connMu.RUnlock()
+	if qm.rpc == nil || qm.rpc.ch.IsClosed() {
+		return nil, ErrNotConnected
+	}
+	return qm.rpc, nil
+}
+
+// dispatch delivers replies and returned requests to their callers until the channel closes,
+// then fails the calls still waiting
+func (c *rpcClient) dispatch(replies <-chan amqp.Delivery, returns <-chan amqp.Return) {
+	for replies != nil || returns != nil {
+		select {
+		case msg, ok := <-replies:
+			if !ok {
+				replies = nil
+				continue
+			}
+			c.resolve(msg.CorrelationId, rpcResult{msg: msg})
+		case ret, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			c.resolve(ret.CorrelationId, rpcResult{err: fmt.Errorf("%w: %s %s", ErrUnroutable, ret.Exchange, ret.ReplyText)})
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	for corrID, waiter := range c.pending {
+		waiter <- rpcResult{err: ErrNotConnected}
+		delete(c.pending, corrID)
+	}
+}
+
+func (c *rpcClient) register(corrID string) (chan rpcResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, ErrNotConnected
+	}
+	// buffered so dispatch never blocks on a caller that already gave up
+	waiter := make(chan rpcResult, 1)
+	c.pending[corrID] = waiter
+	return waiter, nil
+}
+
+func (c *rpcClient) unregister(corrID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, corrID)
+}
+
+// resolve hands a result to its caller, replies of calls that timed out are dropped
+func (c *rpcClient) resolve(corrID string, result rpcResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	waiter, ok := c.pending[corrID]
+	if !ok {
+		return
+	}
+	delete(c.pending, corrID)
+	waiter <- result
+}
+
+// PublishToExchangeAndWait publishes a request to an exchange and waits for the consumer to reply
+// with a QueueResponse. The wait ends with ctx, a reply arriving later is dropped.
+// It returns ErrUnroutable when no queue is bound for the routing key and ErrNotConnected
+// when the connection is lost before the reply.
+func (qm *QueueManager) PublishToExchangeAndWait(ctx context.Context, exchange, routingKey, body string) (*QueueResponse, error) {
+	client, err := qm.rpcClient()
+	if err != nil {
+		return nil, err
+	}
+
+	corrID := uuid.NewString()
+	waiter, err := client.register(corrID)
+	if err != nil {
+		return nil, err
+	}
+	defer client.unregister(corrID)
+
+	err = client.ch.PublishWithContext(
+		ctx,
+		exchange,
+		qm.shardRoutingKey(exchange, routingKey),
+		true,  // mandatory, an unroutable request fails right away
+		false, // immediate
+		amqp.Publishing{
+			ContentType:   "text/plain",
+			CorrelationId: corrID,
+			ReplyTo:       directReplyTo,
+			Body:          []byte(body),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("publish failed: %w", err)
+	}
+
+	select {
+	case result := <-waiter:
+		if result.err != nil {
+			return nil, result.err
+		}
+		var response QueueResponse
+		if err := json.Unmarshal(result.msg.Body, &response); err != nil {
+			return nil, fmt.Errorf("decode response: %w", err)
+		}
+		return &response, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
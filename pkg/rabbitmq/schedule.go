@@ -0,0 +1,287 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"ecom/pkg/logger"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.uber.org/zap"
+)
+
+const (
+	// SchedulerQueueName receives the scheduled messages whose delay expired, see StartScheduler
+	SchedulerQueueName = "ecom.scheduled"
+	// HeaderScheduleID identifies a scheduled message for CancelScheduled
+	HeaderScheduleID = "x-schedule-id"
+	// HeaderDeliverAt is the delivery time of a scheduled message in unix milliseconds
+	HeaderDeliverAt = "x-deliver-at"
+	// HeaderScheduledExchange and HeaderScheduledRoutingKey are where a scheduled message is published once due
+	HeaderScheduledExchange   = "x-scheduled-exchange"
+	HeaderScheduledRoutingKey = "x-scheduled-routing-key"
+
+	// delay queue i holds messages for delayLevelBase << i, a message due in less than
+	// delayLevelBase is delivered at once. The TTL of the longest queue has to fit in the
+	// x-message-ttl maximum of 2^32-1 ms, 100ms << 25 is about 39 days.
+	delayLevelBase = 100 * time.Millisecond
+	delayLevels    = 26
+
+	// MaxScheduleDelay is the longest delay of a scheduled message, about 77 days, it passes every delay
+	// queue once
+	MaxScheduleDelay = delayLevelBase<<delayLevels - delayLevelBase
+)
+
+var (
+	ErrSchedulerNotStarted = errors.New("scheduler is not started")
+	ErrScheduleNotFound    = errors.New("scheduled message not found")
+	ErrDelayTooLong        = fmt.Errorf("delay is longer than the maximum of %s", MaxScheduleDelay)
+)
+
+// Scheduler publishes messages later. A scheduled message can be cancelled by its id until it is due.
+type Scheduler interface {
+	// Schedule publishes msg to an exchange at a time and returns its id, the message id of msg when set
+	Schedule(ctx context.Context, exchange, routingKey string, msg amqp.Publishing, at time.Time) (string, error)
+	// PublishDelayed and PublishAt schedule a persistent text message like PublishToExchange
+	PublishDelayed(exchange, routingKey, body string, delay time.Duration) (string, error)
+	PublishAt(exchange, routingKey, body string, at time.Time) (string, error)
+	// CancelScheduled drops a pending scheduled message, ErrScheduleNotFound when it was already
+	// published or cancelled
+	CancelScheduled(ctx context.Context, id string) error
+}
+
+// ScheduleStore records the scheduled messages still pending. QueueManager keeps the messages themselves
+// in RabbitMQ and only publishes the ones still in the store, so the store decides about cancellations
+// and has to survive a restart like the queues do.
+type ScheduleStore interface {
+	AddSchedule(ctx context.Context, id string, at time.Time) error
+	IsSchedulePending(ctx context.Context, id string) (bool, error)
+	// RemoveSchedule returns false when the id was not pending
+	RemoveSchedule(ctx context.Context, id string) (bool, error)
+}
+
+// NewMemoryScheduleStore returns a ScheduleStore for a single process, its cancellations are lost on restart
+func NewMemoryScheduleStore() ScheduleStore {
+	return &memoryScheduleStore{pending: make(map[string]time.Time)}
+}
+
+type memoryScheduleStore struct {
+	mu      sync.Mutex
+	pending map[string]time.Time
+}
+
+func (s *memoryScheduleStore) AddSchedule(ctx context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending[id] = at
+	return nil
+}
+
+func (s *memoryScheduleStore) IsSchedulePending(ctx context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.pending[id]
+	return ok, nil
+}
+
+func (s *memoryScheduleStore) RemoveSchedule(ctx context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.pending[id]
+	delete(s.pending, id)
+	return ok, nil
+}
+
+// DelayQueueName returns the name of delay queue level, its messages expire after delayLevelBase << level
+func DelayQueueName(level int) string {
+	return fmt.Sprintf("%s.delay.%d", SchedulerQueueName, (delayLevelBase << level).Milliseconds())
+}
+
+// delayLevel returns the longest delay queue not longer than remaining, -1 when the message is due
+func delayLevel(remaining time.Duration) int {
+	if remaining < delayLevelBase {
+		return -1
+	}
+	level := 0
+	for level+1 < delayLevels && delayLevelBase<<(level+1) <= remaining {
+		level++
+	}
+	return level
+}
+
+// StartScheduler consumes the scheduler queue with store deciding which scheduled messages are still pending.
+// A scheduled message waits in durable delay queues with a fixed TTL, each dead-letters to the scheduler
+// queue, which moves the message on to the next shorter delay queue until it is due and then publishes it.
+// Delays are split in powers of two of delayLevelBase so a message takes at most one hop per bit of its
+// delay and a queue never holds messages with different expiry times. Everything is in RabbitMQ and the
+// store, a restart only delays the messages that expired meanwhile.
+func (qm *QueueManager) StartScheduler(store ScheduleStore) error {
+	qm.mu.Lock()
+	qm.schedules = store
+	qm.mu.Unlock()
+	if err := qm.DeclareQueueSpec(QueueSpec{Name: SchedulerQueueName, Durable: true}); err != nil {
+		return err
+	}
+	return qm.Consume(SchedulerQueueName, qm.handleScheduled)
+}
+
+func (qm *QueueManager) scheduleStore() ScheduleStore {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+	return qm.schedules
+}
+
+// PublishDelayed publishes a persistent text message to an exchange after delay
+func (qm *QueueManager) PublishDelayed(exchange, routingKey, body string, delay time.Duration) (string, error) {
+	return qm.PublishAt(exchange, routingKey, body, time.Now().Add(delay))
+}
+
+// PublishAt publishes a persistent text message to an exchange at a time
+func (qm *QueueManager) PublishAt(exchange, routingKey, body string, at time.Time) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultConfirmTimeout)
+	defer cancel()
+	return qm.Schedule(ctx, exchange, routingKey, amqp.Publishing{
+		ContentType:  "text/plain",
+		DeliveryMode: amqp.Persistent,
+		Body:         []byte(body),
+	}, at)
+}
+
+// Schedule sends msg to the delay queues and returns the id to cancel it with. A message already due is
+// published at once, one due after MaxScheduleDelay is rejected with ErrDelayTooLong. The destination is
+// checked only when the message is due, an unroutable scheduled message is dead-lettered from the
+// scheduler queue.
+func (qm *QueueManager) Schedule(ctx context.Context, exchange, routingKey string, msg amqp.Publishing, at time.Time) (string, error) {
+	store := qm.scheduleStore()
+	if store == nil {
+		return "", ErrSchedulerNotStarted
+	}
+	if time.Until(at) > MaxScheduleDelay {
+		return "", ErrDelayTooLong
+	}
+	if msg.MessageId == "" {
+		msg.MessageId = uuid.NewString()
+	}
+	id := msg.MessageId
+	if delayLevel(time.Until(at)) < 0 {
+		return id, qm.PublishWithConfirm(ctx, exchange, routingKey, msg)
+	}
+
+	headers := amqp.Table{}
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers[HeaderScheduleID] = id
+	headers[HeaderDeliverAt] = at.UnixMilli()
+	headers[HeaderScheduledExchange] = exchange
+	headers[HeaderScheduledRoutingKey] = routingKey
+	msg.Headers = headers
+
+	if err := store.AddSchedule(ctx, id, at); err != nil {
+		return "", err
+	}
+	if err := qm.delay(ctx, msg, at); err != nil {
+		if _, removeErr := store.RemoveSchedule(context.Background(), id); removeErr != nil {
+			logger.FromContext(ctx).Error("Failed to remove schedule", zap.String("scheduleId", id), zap.Error(removeErr))
+		}
+		return "", err
+	}
+	return id, nil
+}
+
+// CancelScheduled removes a scheduled message from the store, the scheduler drops it once it expires
+func (qm *QueueManager) CancelScheduled(ctx context.Context, id string) error {
+	store := qm.scheduleStore()
+	if store == nil {
+		return ErrSchedulerNotStarted
+	}
+	removed, err := store.RemoveSchedule(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return ErrScheduleNotFound
+	}
+	return nil
+}
+
+// delay publishes a scheduled message to the delay queue of its remaining delay
+func (qm *QueueManager) delay(ctx context.Context, msg amqp.Publishing, at time.Time) error {
+	level := delayLevel(time.Until(at))
+	if level < 0 {
+		level = 0
+	}
+	name := DelayQueueName(level)
+	qm.mu.Lock()
+	_, declared := qm.queueSpecs[name]
+	qm.mu.Unlock()
+	if !declared {
+		err := qm.DeclareQueueSpec(QueueSpec{
+			Name:                 name,
+			Durable:              true,
+			MessageTTL:           delayLevelBase << level,
+			DeadLetterRoutingKey: SchedulerQueueName,
+			// dead-letter through the default exchange
+			Args: amqp.Table{"x-dead-letter-exchange": ""},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return qm.PublishWithConfirm(ctx, "", name, msg)
+}
+
+// handleScheduled moves an expired scheduled message to its next delay queue or, once due, publishes it
+// to its destination. A cancelled message is dropped. The message is removed from the store after it was
+// published, a cancel racing with the delivery can report success for a message already sent.
+func (qm *QueueManager) handleScheduled(msg amqp.Delivery) error {
+	store := qm.scheduleStore()
+	id, _ := msg.Headers[HeaderScheduleID].(string)
+	if id == "" {
+		return Permanent(errors.New("scheduled message without id"))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultConfirmTimeout)
+	defer cancel()
+
+	pending, err := store.IsSchedulePending(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !pending {
+		logger.FromContext(ctx).Info("Dropping cancelled scheduled message", zap.String("scheduleId", id))
+		return nil
+	}
+
+	at := time.UnixMilli(int64(headerInt(msg.Headers, HeaderDeliverAt)))
+	exchange, _ := msg.Headers[HeaderScheduledExchange].(string)
+	routingKey, _ := msg.Headers[HeaderScheduledRoutingKey].(string)
+	publishing := copyPublishing(msg, nil)
+	// headers of the trip through the delay queues
+	for _, name := range []string{"x-death", "x-first-death-exchange", "x-first-death-queue", "x-first-death-reason",
+		"x-last-death-exchange", "x-last-death-queue", "x-last-death-reason",
+		HeaderOriginalExchange, HeaderOriginalRoutingKey, HeaderRetryCount, HeaderError} {
+		delete(publishing.Headers, name)
+	}
+
+	if delayLevel(time.Until(at)) >= 0 {
+		return qm.delay(ctx, publishing, at)
+	}
+
+	for _, name := range []string{HeaderDeliverAt, HeaderScheduledExchange, HeaderScheduledRoutingKey} {
+		delete(publishing.Headers, name)
+	}
+	if err := qm.PublishWithConfirm(ctx, exchange, routingKey, publishing); err != nil {
+		if errors.Is(err, ErrUnroutable) {
+			return Permanent(err)
+		}
+		return err
+	}
+	if _, err := store.RemoveSchedule(ctx, id); err != nil {
+		logger.FromContext(ctx).Error("Failed to remove schedule", zap.String("scheduleId", id), zap.Error(err))
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestDelayLevelsAddUpToTheDelay(t *testing.T) {
+	for _, delay := range []time.Duration{
+		150 * time.Millisecond,
+		time.Second,
+		90 * time.Second,
+		47*time.Hour + 13*time.Minute + 7*time.Second,
+		MaxScheduleDelay,
+	} {
+		remaining := delay
+		hops := 0
+		for {
+			level := delayLevel(remaining)
+			if level < 0 {
+				break
+			}
+			if next := delayLevel(remaining - delayLevelBase<<level); next >= level {
+				t.Fatalf("delay %s: level %d is followed by level %d", delay, level, next)
+			}
+			remaining -= delayLevelBase << level
+			hops++
+		}
+		if remaining < 0 || remaining >= delayLevelBase {
+			t.Fatalf("delay %s: %s left after %d hops", delay, remaining, hops)
+		}
+		if hops > delayLevels {
+			t.Fatalf("delay %s took %d hops", delay, hops)
+		}
+	}
+	if level := delayLevel(50 * time.Millisecond); level != -1 {
+		t.Fatalf("a message due in 50ms went to delay level %d", level)
+	}
+}
+
+func TestScheduleRejectsDelaysPastTheMaximum(t *testing.T) {
+	if ttl := (delayLevelBase << (delayLevels - 1)).Milliseconds(); ttl > math.MaxUint32 {
+		t.Fatalf("the longest delay queue expires after %dms, more than the x-message-ttl maximum", ttl)
+	}
+	if level := delayLevel(MaxScheduleDelay); level != delayLevels-1 {
+		t.Fatalf("the maximum delay starts at level %d", level)
+	}
+
+	qm := &QueueManager{schedules: NewMemoryScheduleStore()}
+	_, err := qm.Schedule(context.Background(), "ex", "key", amqp.Publishing{}, time.Now().Add(MaxScheduleDelay+time.Minute))
+	if !errors.Is(err, ErrDelayTooLong) {
+		t.Fatalf("a delay past the maximum returned %v", err)
+	}
+	if _, err := qm.PublishDelayed("ex", "key", "body", 80*24*time.Hour); !errors.Is(err, ErrDelayTooLong) {
+		t.Fatalf("an 80 day delay returned %v", err)
+	}
+}
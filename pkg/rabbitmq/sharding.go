@@ -0,0 +1,117 @@
+package rabbitmq
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ExchangeConsistentHash is the exchange type of the rabbitmq_consistent_hash_exchange plugin
+const ExchangeConsistentHash = "x-consistent-hash"
+
+// ShardMode selects where the messages of a sharded exchange are spread over the queue shards.
+// Both modes send every message of a routing key to the same shard, so per-key order holds.
+type ShardMode string
+
+const (
+	// ShardByExchange lets an x-consistent-hash exchange hash the routing key, it needs the
+	// rabbitmq_consistent_hash_exchange plugin
+	ShardByExchange ShardMode = "exchange"
+	// ShardByClient hashes the routing key in the publisher and routes to the shard through a
+	// direct exchange, it runs on a stock broker
+	ShardByClient ShardMode = "client"
+)
+
+// ShardedExchange is an exchange spreading messages over the shards of a "name:N" queue by routing key
+type ShardedExchange struct {
+	Exchange string
+	Queue    string
+	Mode     ShardMode
+}
+
+// DeclareShardedExchange declares the exchange, the queue shards and their bindings. In ShardByClient
+// mode the publish methods replace the routing key of messages to the exchange by the key of its shard.
+func (qm *QueueManager) DeclareShardedExchange(spec ShardedExchange) error {
+	topology, queues, err := shardedTopology(spec)
+	if err != nil {
+		return err
+	}
+	if err := qm.ApplyTopology(topology); err != nil {
+		return err
+	}
+
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+	if qm.shards == nil {
+		qm.shards = make(map[string][]string)
+	}
+	if spec.Mode == ShardByClient {
+		qm.shards[spec.Exchange] = queues
+	} else {
+		delete(qm.shards, spec.Exchange)
+	}
+	return nil
+}
+
+// shardedTopology returns the topology of a sharded exchange and its shard queues
+func shardedTopology(spec ShardedExchange) (Topology, []string, error) {
+	queues, err := ShardNames(spec.Queue)
+	if err != nil {
+		return Topology{}, nil, err
+	}
+
+	var topology Topology
+	switch spec.Mode {
+	case ShardByExchange, "":
+		topology.Exchanges = []ExchangeSpec{{Name: spec.Exchange, Kind: ExchangeConsistentHash, Durable: true}}
+		for _, queue := range queues {
+			topology.Bindings = append(topology.Bindings, BindingSpec{Queue: queue, Exchange: spec.Exchange, Weight: 1})
+		}
+	case ShardByClient:
+		topology.Exchanges = []ExchangeSpec{{Name: spec.Exchange, Kind: amqp.ExchangeDirect, Durable: true}}
+		for _, queue := range queues {
+			topology.Bindings = append(topology.Bindings, BindingSpec{Queue: queue, Exchange: spec.Exchange, RoutingKey: queue})
+		}
+	default:
+		return Topology{}, nil, fmt.Errorf("unknown shard mode %q", spec.Mode)
+	}
+	for _, queue := range queues {
+		topology.Queues = append(topology.Queues, QueueSpec{Name: queue, Durable: true})
+	}
+	return topology, queues, nil
+}
+
+// shardRoutingKey returns the routing key a message with key is published with,
+// the key of its shard for the exchanges sharded by the client and key otherwise
+func (qm *QueueManager) shardRoutingKey(exchange, key string) string {
+	qm.mu.Lock()
+	queues, ok := qm.shards[exchange]
+	qm.mu.Unlock()
+	if !ok {
+		return key
+	}
+	return queues[ShardIndex(key, len(queues))]
+}
+
+// ShardIndex returns the shard of a key among shards. It is stable across processes and restarts,
+// and when shards grows only about 1/shards of the keys move.
+func ShardIndex(key string, shards int) int {
+	if shards <= 1 {
+		return 0
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return JumpHash(h.Sum64(), shards)
+}
+
+// JumpHash is the jump consistent hash of Lamping and Veach, it maps key to a bucket in [0, buckets)
+func JumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
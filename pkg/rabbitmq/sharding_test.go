@@ -0,0 +1,63 @@
+package rabbitmq
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestShardIndexIsStable(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		first := ShardIndex(key, 7)
+		if first < 0 || first >= 7 {
+			t.Fatalf("ShardIndex(%s, 7) = %d out of range", key, first)
+		}
+		if again := ShardIndex(key, 7); again != first {
+			t.Fatalf("ShardIndex(%s, 7) changed from %d to %d", key, first, again)
+		}
+	}
+}
+
+func TestShardIndexMovesFewKeys(t *testing.T) {
+	const keys = 10000
+	moved := 0
+	counts := make([]int, 10)
+	for i := 0; i < keys; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		before, after := ShardIndex(key, 9), ShardIndex(key, 10)
+		counts[after]++
+		if before != after {
+			if after != 9 {
+				t.Fatalf("key %s moved from shard %d to the old shard %d", key, before, after)
+			}
+			moved++
+		}
+	}
+	// about 1/10 of the keys move to the new shard
+	if moved < keys/20 || moved > keys/5 {
+		t.Fatalf("%d of %d keys moved", moved, keys)
+	}
+	for shard, count := range counts {
+		if count < keys/20 {
+			t.Fatalf("shard %d only got %d keys", shard, count)
+		}
+	}
+}
+
+func TestReplayKeepsTheShardOfClientShardedMessages(t *testing.T) {
+	qm := &QueueManager{shards: map[string][]string{"test.sharded": {"test:0", "test:1", "test:2", "test:3"}}}
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		shard := qm.shardRoutingKey("test.sharded", key)
+		// a dead letter records the routing key it was delivered with, the shard queue
+		exchange, routingKey := qm.replayRoute(DeadLetter{Exchange: "test.sharded", RoutingKey: shard})
+		if exchange != "" || routingKey != shard {
+			t.Fatalf("replay of %s goes to %q %q instead of shard %s", key, exchange, routingKey, shard)
+		}
+	}
+
+	exchange, routingKey := qm.replayRoute(DeadLetter{Exchange: "orders.events", RoutingKey: "created"})
+	if exchange != "orders.events" || routingKey != "created" {
+		t.Fatalf("replay goes to %q %q instead of where it was published", exchange, routingKey)
+	}
+}
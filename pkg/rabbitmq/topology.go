@@ -0,0 +1,153 @@
+package rabbitmq
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Topology is the exchanges, queues and bindings an application needs, see ApplyTopology
+type Topology struct {
+	Exchanges []ExchangeSpec
+	Queues    []QueueSpec
+	Bindings  []BindingSpec
+}
+
+type ExchangeSpec struct {
+	Name       string
+	Kind       string // direct, fanout, topic, headers, x-consistent-hash
+	Durable    bool
+	AutoDelete bool
+	Internal   bool
+	Args       amqp.Table
+}
+
+// QueueSpec describes a queue. A queue with Shards > 1 is declared as "name:0" to "name:<Shards-1>",
+// the naming the "name:N" queue settings use.
+type QueueSpec struct {
+	Name                 string
+	Shards               int
+	Durable              bool
+	AutoDelete           bool
+	MessageTTL           time.Duration
+	MaxLength            int
+	DeadLetterExchange   string
+	DeadLetterRoutingKey string
+	Args                 amqp.Table
+}
+
+// BindingSpec binds a queue, every shard of a sharded queue, to an exchange. Exchanges of type
+// x-consistent-hash take the Weight of the queue as routing key.
+type BindingSpec struct {
+	Queue      string
+	Exchange   string
+	RoutingKey string
+	Weight     int
+	Args       amqp.Table
+}
+
+// ShardNames expands a "name:N" setting into its shard queue names, a name without a count is one queue
+func ShardNames(name string) ([]string, error) {
+	base, count, found := strings.Cut(name, ":")
+	if !found {
+		return []string{name}, nil
+	}
+	shards, err := strconv.Atoi(count)
+	if err != nil || shards <= 0 {
+		return nil, fmt.Errorf("invalid shard count in queue %q", name)
+	}
+	return shardNames(base, shards), nil
+}
+
+func shardNames(base string, shards int) []string {
+	if shards <= 1 {
+		return []string{base}
+	}
+	names := make([]string, shards)
+	for i := range names {
+		names[i] = fmt.Sprintf("%s:%d", base, i)
+	}
+	return names
+}
+
+// arguments returns the declare arguments of a queue
+func (spec QueueSpec) arguments() amqp.Table {
+	args := amqp.Table{}
+	for k, v := range spec.Args {
+		args[k] = v
+	}
+	if spec.MessageTTL > 0 {
+		args["x-message-ttl"] = spec.MessageTTL.Milliseconds()
+	}
+	if spec.MaxLength > 0 {
+		args["x-max-length"] = int64(spec.MaxLength)
+	}
+	if spec.DeadLetterExchange != "" {
+		args["x-dead-letter-exchange"] = spec.DeadLetterExchange
+	}
+	if spec.DeadLetterRoutingKey != "" {
+		args["x-dead-letter-routing-key"] = spec.DeadLetterRoutingKey
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	return args
+}
+
+// ApplyTopology declares a topology. Declaring is idempotent, applying the same topology again or after
+// a reconnect changes nothing, but a queue or exchange redeclared with other arguments is refused by the broker.
+// Everything is recorded and declared again after a reconnect, while disconnected it is only recorded.
+func (qm *QueueManager) ApplyTopology(topology Topology) error {
+	return applyTopology(qm, topology)
+}
+
+// declarer declares single exchanges, queues and bindings
+type declarer interface {
+	DeclareExchangeSpec(spec ExchangeSpec) error
+	DeclareQueueSpec(spec QueueSpec) error
+	Bind(spec BindingSpec) error
+}
+
+func applyTopology(qm declarer, topology Topology) error {
+	shards := make(map[string][]string)
+	for _, exchange := range topology.Exchanges {
+		if exchange.Name == "" || exchange.Kind == "" {
+			return fmt.Errorf("exchange %q needs a name and a type", exchange.Name)
+		}
+		if err := qm.DeclareExchangeSpec(exchange); err != nil {
+			return fmt.Errorf("declare exchange %s: %w", exchange.Name, err)
+		}
+	}
+	for _, queue := range topology.Queues {
+		if queue.Name == "" {
+			return fmt.Errorf("queue needs a name")
+		}
+		names := shardNames(queue.Name, queue.Shards)
+		shards[queue.Name] = names
+		for _, name := range names {
+			spec := queue
+			spec.Name = name
+			spec.Shards = 0
+			if err := qm.DeclareQueueSpec(spec); err != nil {
+				return fmt.Errorf("declare queue %s: %w", name, err)
+			}
+		}
+	}
+	for _, binding := range topology.Bindings {
+		names, ok := shards[binding.Queue]
+		if !ok {
+			names = []string{binding.Queue}
+		}
+		for _, name := range names {
+			spec := binding
+			spec.Queue = name
+			if err := qm.Bind(spec); err != nil {
+				return fmt.Errorf("bind queue %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package ratelimit
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// FallbackLimiter asks primary and turns to fallback for the requests primary fails on, typically Redis
+// and a MemoryLimiter: each instance then limits on its own instead of letting every request through.
+// After a failure primary is left alone for cooldown, so the requests do not each wait out its timeout,
+// then a single request tries it again while the others keep to fallback.
+// onError is called with the first error after primary worked, not for every failed request.
+type FallbackLimiter struct {
+	primary  Limiter
+	fallback Limiter
+	cooldown time.Duration
+	onError  func(err error)
+	// retryAt is when primary is tried again in unix nanoseconds, zero while primary works
+	retryAt atomic.Int64
+}
+
+func NewFallbackLimiter(primary, fallback Limiter, cooldown time.Duration, onError func(err error)) *FallbackLimiter {
+	return &FallbackLimiter{
+		primary:  primary,
+		fallback: fallback,
+		cooldown: cooldown,
+		onError:  onError,
+	}
+}
+
+func (fl *FallbackLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	if retryAt := fl.retryAt.Load(); retryAt != 0 {
+		now := time.Now().UnixNano()
+		// the request winning the swap tries primary, the retry of the others moves a cooldown further
+		if now < retryAt || !fl.retryAt.CompareAndSwap(retryAt, now+int64(fl.cooldown)) {
+			return fl.fallback.Allow(ctx, key, limit)
+		}
+	}
+	res, err := fl.primary.Allow(ctx, key, limit)
+	if err == nil {
+		fl.retryAt.Store(0)
+		return res, nil
+	}
+	if fl.retryAt.Swap(time.Now().Add(fl.cooldown).UnixNano()) == 0 && fl.onError != nil {
+		fl.onError(err)
+	}
+	return fl.fallback.Allow(ctx, key, limit)
+}
@@ -0,0 +1,54 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Limit allows Rate requests per Period, in bursts of up to Rate requests
+type Limit struct {
+	Rate   int
+	Period time.Duration
+}
+
+// interval is the time one request takes from the quota
+func (l Limit) interval() time.Duration {
+	return l.Period / time.Duration(l.Rate)
+}
+
+// Result is the outcome of a request against a limit
+type Result struct {
+	Limit   int
+	Allowed bool
+	// Remaining is the number of requests allowed right after this one
+	Remaining int
+	// RetryAfter is the time until a request is allowed again, zero for an allowed request
+	RetryAfter time.Duration
+	// ResetAfter is the time until the whole quota is available again
+	ResetAfter time.Duration
+}
+
+// Limiter counts the requests of each key against a limit with the generic cell rate algorithm, a token
+// bucket keeping only the theoretical arrival time of the next request
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// result computes the Result of limit from the theoretical arrival time of the next request, tat, seen
+// from now
+func result(limit Limit, allowed bool, now, tat time.Time) Result {
+	res := Result{
+		Limit:      limit.Rate,
+		Allowed:    allowed,
+		ResetAfter: tat.Sub(now),
+	}
+	if res.ResetAfter < 0 {
+		res.ResetAfter = 0
+	}
+	if allowed {
+		res.Remaining = int((limit.Period - res.ResetAfter) / limit.interval())
+	} else {
+		res.RetryAfter = tat.Add(limit.interval()).Add(-limit.Period).Sub(now)
+	}
+	return res
+}
@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memorySweepEvery is the number of requests between two removals of the full buckets
+const memorySweepEvery = 1024
+
+// MemoryLimiter limits the requests of this process only
+type MemoryLimiter struct {
+	mu       sync.Mutex
+	tats     map[string]time.Time
+	requests int
+	now      func() time.Time
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		tats: make(map[string]time.Time),
+		now:  time.Now,
+	}
+}
+
+func (ml *MemoryLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	now := ml.now()
+	ml.requests++
+	if ml.requests%memorySweepEvery == 0 {
+		ml.sweep(now)
+	}
+
+	tat, ok := ml.tats[key]
+	if !ok || tat.Before(now) {
+		tat = now
+	}
+	next := tat.Add(limit.interval())
+	if now.Before(next.Add(-limit.Period)) {
+		return result(limit, false, now, tat), nil
+	}
+	ml.tats[key] = next
+	return result(limit, true, now, next), nil
+}
+
+// sweep drops the keys whose bucket is full again, they are the same as unknown keys
+func (ml *MemoryLimiter) sweep(now time.Time) {
+	for key, tat := range ml.tats {
+		if !tat.After(now) {
+			delete(ml.tats, key)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// gcraScript keeps the theoretical arrival time of the next request of KEYS[1] in microseconds of the
+// Redis clock, so every instance shares one clock. ARGV are the interval and period in microseconds. It
+// returns whether the request is allowed, the current time and the theoretical arrival time after it.
+var gcraScript = redis.NewScript(`
+local interval = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local clock = redis.call("TIME")
+local now = tonumber(clock[1]) * 1000000 + tonumber(clock[2])
+local tat = tonumber(redis.call("GET", KEYS[1]))
+if tat == nil or tat < now then
+	tat = now
+end
+local new_tat = tat + interval
+if now < new_tat - period then
+	return {0, now, tat}
+end
+redis.call("SET", KEYS[1], new_tat, "PX", math.ceil((new_tat - now) / 1000))
+return {1, now, new_tat}
+`)
+
+// RedisLimiter limits the requests of all the instances sharing the Redis server
+type RedisLimiter struct {
+	rdb *redis.Client
+}
+
+func NewRedisLimiter(rdb *redis.Client) *RedisLimiter {
+	return &RedisLimiter{rdb: rdb}
+}
+
+func (rl *RedisLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	values, err := gcraScript.Run(ctx, rl.rdb, []string{key},
+		limit.interval().Microseconds(), limit.Period.Microseconds()).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	now, tat := time.UnixMicro(values[1]), time.UnixMicro(values[2])
+	return result(limit, values[0] == 1, now, tat), nil
+}
@@ -0,0 +1,75 @@
+package redisstream
+
+import (
+	"context"
+	"fmt"
+
+	"ecom/pkg/rabbitmq"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// deadLetterScanLimit bounds the entries read while selecting dead letters by id
+const deadLetterScanLimit = 10000
+
+func (b *Broker) PeekDeadLetters(ctx context.Context, queueName string, limit int) ([]rabbitmq.DeadLetter, error) {
+	messages, err := b.rdb.XRangeN(ctx, streamName(rabbitmq.DeadLetterQueueName(queueName)), "-", "+", int64(limit)).Result()
+	if err != nil {
+		return nil, err
+	}
+	letters := make([]rabbitmq.DeadLetter, 0, len(messages))
+	for _, message := range messages {
+		letters = append(letters, rabbitmq.DeadLetterOf(queueName, decode(message)))
+	}
+	return letters, nil
+}
+
+func (b *Broker) ReplayDeadLetters(ctx context.Context, queueName string, messageIDs []string) (int, error) {
+	return b.drainDeadLetters(ctx, queueName, messageIDs, func(message redis.XMessage) error {
+		msg := decode(message)
+		letter := rabbitmq.DeadLetterOf(queueName, msg)
+		if err := b.PublishWithConfirm(ctx, letter.Exchange, letter.RoutingKey, rabbitmq.ReplayPublishing(msg)); err != nil {
+			return fmt.Errorf("replay message %s: %w", msg.MessageId, err)
+		}
+		return nil
+	})
+}
+
+func (b *Broker) PurgeDeadLetters(ctx context.Context, queueName string, messageIDs []string) (int, error) {
+	if len(messageIDs) == 0 {
+		removed, err := b.rdb.XTrimMaxLen(ctx, streamName(rabbitmq.DeadLetterQueueName(queueName)), 0).Result()
+		return int(removed), err
+	}
+	return b.drainDeadLetters(ctx, queueName, messageIDs, func(redis.XMessage) error {
+		return nil
+	})
+}
+
+// drainDeadLetters runs fn on the selected entries of the dead letter stream of queueName, all of them
+// when messageIDs is empty, and deletes the entries fn succeeded on
+func (b *Broker) drainDeadLetters(ctx context.Context, queueName string, messageIDs []string, fn func(message redis.XMessage) error) (int, error) {
+	ids := make(map[string]bool, len(messageIDs))
+	for _, id := range messageIDs {
+		ids[id] = true
+	}
+	stream := streamName(rabbitmq.DeadLetterQueueName(queueName))
+	messages, err := b.rdb.XRangeN(ctx, stream, "-", "+", deadLetterScanLimit).Result()
+	if err != nil {
+		return 0, err
+	}
+	done := 0
+	for _, message := range messages {
+		messageID, _ := message.Values["message_id"].(string)
+		if len(ids) > 0 && !ids[messageID] {
+			continue
+		}
+		if err := fn(message); err != nil {
+			return done, err
+		}
+		if err := b.rdb.XDel(ctx, stream, message.ID).Err(); err != nil {
+			return done, err
+		}
+		done++
+	}
+	return done, nil
+}
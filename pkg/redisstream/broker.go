@@ -0,0 +1,572 @@
+package redisstream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ecom/pkg/logger"
+	"ecom/pkg/rabbitmq"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	streamPrefix = "stream:"
+	replyPrefix  = "rpc:reply:"
+	// DefaultGroup is the consumer group reading every queue stream
+	DefaultGroup = "ecom"
+
+	readBlock    = time.Second
+	reclaimBatch = 10
+	replyTTL     = time.Minute
+	pingTimeout  = time.Second
+)
+
+// Broker is a rabbitmq.Broker on Redis Streams for deployments without RabbitMQ. Exchanges are routed
+// in process by a rabbitmq.RoutingTable and every queue is a stream read by one consumer group.
+// A failed message stays pending and is claimed again once it has been idle for the backoff of its
+// retry, rabbitmq.RetryDelay like on RabbitMQ. After MaxRetries retries or on a permanent error it is
+// moved to the "<queue>.dlq" stream.
+// Replies to PublishToExchangeAndWait go through a short-lived list per request and scheduled messages
+// wait in a sorted set polled by every broker.
+type Broker struct {
+	*rabbitmq.RoutingTable
+	rdb     *redis.Client
+	options rabbitmq.ConsumerOptions
+	group   string
+	maxLen  int64
+
+	mu        sync.Mutex
+	groups    map[string]bool
+	consumers map[*consumer]bool
+	closed    bool
+	done      chan struct{}
+}
+
+var _ rabbitmq.Broker = (*Broker)(nil)
+
+// NewBroker returns a broker on rdb. group defaults to DefaultGroup, maxLen approximately caps
+// every stream and is unbounded when 0.
+func NewBroker(rdb *redis.Client, options rabbitmq.ConsumerOptions, group string, maxLen int64) *Broker {
+	defaults := rabbitmq.DefaultConsumerOptions()
+	if options.RetryBaseDelay <= 0 {
+		options.RetryBaseDelay = defaults.RetryBaseDelay
+	}
+	if options.RetryMaxDelay < options.RetryBaseDelay {
+		options.RetryMaxDelay = defaults.RetryMaxDelay
+	}
+	if options.MaxRetries < 0 {
+		options.MaxRetries = 0
+	}
+	if group == "" {
+		group = DefaultGroup
+	}
+	b := &Broker{
+		RoutingTable: rabbitmq.NewRoutingTable(),
+		rdb:          rdb,
+		options:      options,
+		group:        group,
+		maxLen:       maxLen,
+		groups:       make(map[string]bool),
+		consumers:    make(map[*consumer]bool),
+		done:         make(chan struct{}),
+	}
+	go b.runScheduler()
+	return b
+}
+
+func streamName(queue string) string {
+	return streamPrefix + queue
+}
+
+func (b *Broker) State() rabbitmq.ConnectionState {
+	b.mu.Lock()
+	closed := b.closed
+	b.mu.Unlock()
+	if closed {
+		return rabbitmq.StateClosed
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	if err := b.rdb.Ping(ctx).Err(); err != nil {
+		return rabbitmq.StateReconnecting
+	}
+	return rabbitmq.StateConnected
+}
+
+func (b *Broker) IsConnected() bool {
+	return b.State() == rabbitmq.StateConnected
+}
+
+// Close stops the consumers and the scheduler, the Redis client is owned by the caller
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	if !b.closed {
+		close(b.done)
+	}
+	b.closed = true
+	consumers := make([]*consumer, 0, len(b.consumers))
+	for c := range b.consumers {
+		consumers = append(consumers, c)
+	}
+	b.mu.Unlock()
+	for _, c := range consumers {
+		c.Stop(context.Background())
+	}
+	return nil
+}
+
+// ensureGroup creates the consumer group of a queue stream, reading it from the first entry
+func (b *Broker) ensureGroup(ctx context.Context, queue string) error {
+	b.mu.Lock()
+	created := b.groups[queue]
+	b.mu.Unlock()
+	if created {
+		return nil
+	}
+	err := b.rdb.XGroupCreateMkStream(ctx, streamName(queue), b.group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	b.mu.Lock()
+	b.groups[queue] = true
+	b.mu.Unlock()
+	return nil
+}
+
+// publish routes a message and returns the number of streams it was added to
+func (b *Broker) publish(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) (int, error) {
+	if exchange == "" && strings.HasPrefix(routingKey, replyPrefix) {
+		pipe := b.rdb.TxPipeline()
+		pipe.RPush(ctx, routingKey, msg.Body)
+		pipe.Expire(ctx, routingKey, replyTTL)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return 0, err
+		}
+		return 1, nil
+	}
+
+	queues, err := b.Route(exchange, routingKey)
+	if err != nil {
+		return 0, err
+	}
+	values, err := encode(exchange, routingKey, msg)
+	if err != nil {
+		return 0, err
+	}
+	for _, queue := range queues {
+		if err := b.add(ctx, queue, values); err != nil {
+			return 0, err
+		}
+	}
+	return len(queues), nil
+}
+
+func (b *Broker) add(ctx context.Context, queue string, values map[string]interface{}) error {
+	return b.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: streamName(queue),
+		MaxLen: b.maxLen,
+		Approx: b.maxLen > 0,
+		Values: values,
+	}).Err()
+}
+
+func (b *Broker) Publish(exchange, routingKey string, msg amqp.Publishing) error {
+	_, err := b.publish(context.Background(), exchange, routingKey, msg)
+	return err
+}
+
+// PublishWithConfirm adds the message to the streams of its queues, XADD returns once Redis has it
+func (b *Broker) PublishWithConfirm(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) error {
+	if msg.MessageId == "" {
+		msg.MessageId = uuid.NewString()
+	}
+	routed, err := b.publish(ctx, exchange, routingKey, msg)
+	if err != nil {
+		return err
+	}
+	if routed == 0 {
+		return fmt.Errorf("%w: %s", rabbitmq.ErrUnroutable, exchange)
+	}
+	return nil
+}
+
+func (b *Broker) PublishToExchange(exchange, routingKey, body string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), rabbitmq.DefaultConfirmTimeout)
+	defer cancel()
+	return b.PublishWithConfirm(ctx, exchange, routingKey, amqp.Publishing{
+		ContentType:  "text/plain",
+		DeliveryMode: amqp.Persistent,
+		Body:         []byte(body),
+	})
+}
+
+func (b *Broker) PublishToExchangeAndWait(ctx context.Context, exchange, routingKey, body string) (*rabbitmq.QueueResponse, error) {
+	corrID := uuid.NewString()
+	replyTo := replyPrefix + corrID
+	err := b.PublishWithConfirm(ctx, exchange, routingKey, amqp.Publishing{
+		ContentType:   "text/plain",
+		CorrelationId: corrID,
+		ReplyTo:       replyTo,
+		Body:          []byte(body),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		// short blocks so a cancelled ctx is noticed without waiting on the connection
+		result, err := b.rdb.BLPop(ctx, readBlock, replyTo).Result()
+		if errors.Is(err, redis.Nil) {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+		var response rabbitmq.QueueResponse
+		if err := json.Unmarshal([]byte(result[1]), &response); err != nil {
+			return nil, fmt.Errorf("decode response: %w", err)
+		}
+		return &response, nil
+	}
+}
+
+func (b *Broker) Consume(queueName string, handler rabbitmq.Handler) error {
+	_, err := b.StartConsumer(queueName, handler)
+	return err
+}
+
+// StartConsumer reads a queue stream as a new consumer of the group, messages are handled one at a time
+func (b *Broker) StartConsumer(queueName string, handler rabbitmq.Handler) (rabbitmq.Consumer, error) {
+	if !b.HasQueue(queueName) {
+		return nil, fmt.Errorf("queue %s not found", queueName)
+	}
+	if err := b.ensureGroup(context.Background(), queueName); err != nil {
+		return nil, err
+	}
+	c := &consumer{
+		broker:  b,
+		queue:   queueName,
+		name:    fmt.Sprintf("%s.%s", queueName, uuid.NewString()),
+		handler: handler,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil, rabbitmq.ErrNotConnected
+	}
+	b.consumers[c] = true
+	b.mu.Unlock()
+	go c.run()
+	return c, nil
+}
+
+// QueueDepth returns the entries of a queue stream not delivered yet and the consumers of its group.
+// Handled entries are deleted, so the stream length minus the pending entries is the backlog.
+func (b *Broker) QueueDepth(queueName string) (int, int, error) {
+	ctx := context.Background()
+	if err := b.ensureGroup(ctx, queueName); err != nil {
+		return 0, 0, err
+	}
+	length, err := b.rdb.XLen(ctx, streamName(queueName)).Result()
+	if err != nil {
+		return 0, 0, err
+	}
+	groups, err := b.rdb.XInfoGroups(ctx, streamName(queueName)).Result()
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, group := range groups {
+		if group.Name == b.group {
+			return int(length - group.Pending), int(group.Consumers), nil
+		}
+	}
+	return int(length), 0, nil
+}
+
+func (b *Broker) IsLastAttempt(msg amqp.Delivery) bool {
+	return rabbitmq.RetryCount(msg) >= b.options.MaxRetries
+}
+
+type consumer struct {
+	broker   *Broker
+	queue    string
+	name     string
+	handler  rabbitmq.Handler
+	inFlight int32
+	once     sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func (c *consumer) Queue() string {
+	return c.queue
+}
+
+func (c *consumer) InFlight() int {
+	return int(atomic.LoadInt32(&c.inFlight))
+}
+
+// Stop waits for the message being handled, the entries this consumer left pending are reclaimed by the others
+func (c *consumer) Stop(ctx context.Context) error {
+	c.once.Do(func() { close(c.stop) })
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	c.broker.mu.Lock()
+	delete(c.broker.consumers, c)
+	c.broker.mu.Unlock()
+	return nil
+}
+
+func (c *consumer) stopped() bool {
+	select {
+	case <-c.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *consumer) run() {
+	defer close(c.done)
+	b := c.broker
+	stream := streamName(c.queue)
+	ctx := context.Background()
+	nextReclaim := time.Now()
+	for !c.stopped() {
+		if time.Now().After(nextReclaim) {
+			c.reclaim(ctx)
+			nextReclaim = time.Now().Add(b.options.RetryBaseDelay)
+		}
+
+		streams, err := b.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    b.group,
+			Consumer: c.name,
+			Streams:  []string{stream, ">"},
+			Count:    1,
+			Block:    readBlock,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			zap.L().Error("Failed to read stream", zap.String("stream", stream), zap.Error(err))
+			select {
+			case <-c.stop:
+			case <-time.After(readBlock):
+			}
+			continue
+		}
+		for _, s := range streams {
+			for _, message := range s.Messages {
+				c.handle(ctx, message, 1)
+			}
+		}
+	}
+}
+
+// reclaim takes over the entries left pending, by a failed attempt or by a consumer that stopped or
+// crashed, once they have been idle for the backoff of their retry. An entry delivered n times waits
+// rabbitmq.RetryDelay(n), the delay queue of the n-th retry on RabbitMQ. The delivery count is read
+// before the entry is claimed, an entry whose count cannot be read stays pending.
+func (c *consumer) reclaim(ctx context.Context) {
+	b := c.broker
+	stream := streamName(c.queue)
+	start := "-"
+	for !c.stopped() {
+		pending, err := b.rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream: stream,
+			Group:  b.group,
+			Idle:   b.options.RetryBaseDelay,
+			Start:  start,
+			End:    "+",
+			Count:  reclaimBatch,
+		}).Result()
+		if err != nil {
+			zap.L().Error("Failed to reclaim stream", zap.String("stream", stream), zap.Error(err))
+			return
+		}
+		for _, entry := range pending {
+			delay := rabbitmq.RetryDelay(int(entry.RetryCount), b.options.RetryBaseDelay, b.options.RetryMaxDelay)
+			if entry.Idle < delay {
+				continue
+			}
+			// claimed only while still idle for delay, another consumer may have taken it meanwhile
+			messages, err := b.rdb.XClaim(ctx, &redis.XClaimArgs{
+				Stream:   stream,
+				Group:    b.group,
+				Consumer: c.name,
+				MinIdle:  delay,
+				Messages: []string{entry.ID},
+			}).Result()
+			if err != nil {
+				zap.L().Error("Failed to claim message", zap.String("stream", stream), zap.String("entryId", entry.ID), zap.Error(err))
+				continue
+			}
+			for _, message := range messages {
+				c.handle(ctx, message, entry.RetryCount+1)
+			}
+		}
+		if len(pending) < reclaimBatch {
+			return
+		}
+		start = "(" + pending[len(pending)-1].ID
+	}
+}
+
+// handle runs the handler on an entry delivered deliveries times. It is acked on success, dead-lettered
+// on a permanent error or once it was retried MaxRetries times, and left pending for a retry otherwise.
+func (c *consumer) handle(ctx context.Context, message redis.XMessage, deliveries int64) {
+	b := c.broker
+	msg := decode(message)
+	retries := int(deliveries - 1)
+	msg.Headers[rabbitmq.HeaderRetryCount] = int32(retries)
+	msg.Redelivered = retries > 0
+	l := logger.FromContext(rabbitmq.MessageContext(ctx, msg)).With(zap.String("queue", c.queue), zap.Int("attempt", retries+1))
+
+	var err error
+	if retries > b.options.MaxRetries {
+		// delivered again after its last attempt, the consumer stopped before dead-lettering it
+		err = fmt.Errorf("delivered %d times", deliveries)
+	} else {
+		atomic.AddInt32(&c.inFlight, 1)
+		err = rabbitmq.SafeHandle(c.handler, msg)
+		atomic.AddInt32(&c.inFlight, -1)
+	}
+	if err == nil {
+		c.ack(ctx, message.ID)
+		return
+	}
+	if !rabbitmq.IsPermanent(err) && retries < b.options.MaxRetries {
+		l.Warn("Retrying message", zap.Error(err))
+		return
+	}
+
+	l.Error("Dead-lettering message", zap.Error(err))
+	if b.options.DeadLetterExchange != "" {
+		values := copyValues(message.Values)
+		extra := amqp.Table{
+			rabbitmq.HeaderError:         err.Error(),
+			rabbitmq.HeaderOriginalQueue: c.queue,
+		}
+		// where the message was published, for replaying it like a RabbitMQ dead letter
+		if exchange, _ := message.Values["exchange"].(string); exchange != "" {
+			extra[rabbitmq.HeaderOriginalExchange] = exchange
+			extra[rabbitmq.HeaderOriginalRoutingKey] = message.Values["routing_key"]
+		}
+		values["headers"] = mergeHeaders(message.Values, extra)
+		if err := b.add(ctx, rabbitmq.DeadLetterQueueName(c.queue), values); err != nil {
+			// left pending, reclaimed and dead-lettered again later
+			l.Error("Failed to dead-letter message", zap.Error(err))
+			return
+		}
+	}
+	c.ack(ctx, message.ID)
+}
+
+// ack acknowledges and deletes a handled entry
+func (c *consumer) ack(ctx context.Context, id string) {
+	b := c.broker
+	stream := streamName(c.queue)
+	pipe := b.rdb.TxPipeline()
+	pipe.XAck(ctx, stream, b.group, id)
+	pipe.XDel(ctx, stream, id)
+	if _, err := pipe.Exec(ctx); err != nil {
+		zap.L().Error("Failed to ack message", zap.String("queue", c.queue), zap.String("entryId", id), zap.Error(err))
+	}
+}
+
+// encode flattens a message into stream entry fields
+func encode(exchange, routingKey string, msg amqp.Publishing) (map[string]interface{}, error) {
+	headers, err := json.Marshal(msg.Headers)
+	if err != nil {
+		return nil, err
+	}
+	timestamp := msg.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	return map[string]interface{}{
+		"exchange":       exchange,
+		"routing_key":    routingKey,
+		"headers":        string(headers),
+		"content_type":   msg.ContentType,
+		"message_id":     msg.MessageId,
+		"correlation_id": msg.CorrelationId,
+		"reply_to":       msg.ReplyTo,
+		"type":           msg.Type,
+		"timestamp":      strconv.FormatInt(timestamp.UnixMilli(), 10),
+		"body":           string(msg.Body),
+	}, nil
+}
+
+func decode(message redis.XMessage) amqp.Delivery {
+	field := func(name string) string {
+		value, _ := message.Values[name].(string)
+		return value
+	}
+	headers := amqp.Table{}
+	if raw := field("headers"); raw != "" {
+		json.Unmarshal([]byte(raw), &headers)
+	}
+	if headers == nil {
+		headers = amqp.Table{}
+	}
+	timestamp, _ := strconv.ParseInt(field("timestamp"), 10, 64)
+	return amqp.Delivery{
+		Headers:       headers,
+		ContentType:   field("content_type"),
+		MessageId:     field("message_id"),
+		CorrelationId: field("correlation_id"),
+		ReplyTo:       field("reply_to"),
+		Type:          field("type"),
+		Timestamp:     time.UnixMilli(timestamp),
+		Exchange:      field("exchange"),
+		RoutingKey:    field("routing_key"),
+		Body:          []byte(field("body")),
+	}
+}
+
+func copyValues(values map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		copied[k] = v
+	}
+	return copied
+}
+
+func mergeHeaders(values map[string]interface{}, extra amqp.Table) string {
+	headers := amqp.Table{}
+	if raw, ok := values["headers"].(string); ok && raw != "" {
+		json.Unmarshal([]byte(raw), &headers)
+	}
+	if headers == nil {
+		headers = amqp.Table{}
+	}
+	for k, v := range extra {
+		headers[k] = v
+	}
+	data, _ := json.Marshal(headers)
+	return string(data)
+}
@@ -0,0 +1,151 @@
+package redisstream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"ecom/pkg/rabbitmq"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	// scheduleKey is a sorted set of the scheduled message ids by delivery time in unix milliseconds,
+	// schedulePayloadKey a hash of their stream entry fields
+	scheduleKey        = "stream:scheduled"
+	schedulePayloadKey = "stream:scheduled:msg"
+
+	schedulePoll  = 100 * time.Millisecond
+	scheduleBatch = 100
+	// scheduleLease postpones a claimed message, it is claimed again when the instance publishing it died
+	scheduleLease = 30 * time.Second
+)
+
+// claimScript takes the due ids and moves them past the lease so other instances skip them
+var claimScript = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[3])
+for _, id in ipairs(due) do
+	redis.call('ZADD', KEYS[1], ARGV[2], id)
+end
+return due
+`)
+
+// Schedule stores msg in Redis until it is due, runScheduler publishes it from any instance
+func (b *Broker) Schedule(ctx context.Context, exchange, routingKey string, msg amqp.Publishing, at time.Time) (string, error) {
+	if msg.MessageId == "" {
+		msg.MessageId = uuid.NewString()
+	}
+	values, err := encode(exchange, routingKey, msg)
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	pipe := b.rdb.TxPipeline()
+	pipe.HSet(ctx, schedulePayloadKey, msg.MessageId, payload)
+	pipe.ZAdd(ctx, scheduleKey, redis.Z{Score: float64(at.UnixMilli()), Member: msg.MessageId})
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", err
+	}
+	return msg.MessageId, nil
+}
+
+func (b *Broker) PublishDelayed(exchange, routingKey, body string, delay time.Duration) (string, error) {
+	return b.PublishAt(exchange, routingKey, body, time.Now().Add(delay))
+}
+
+func (b *Broker) PublishAt(exchange, routingKey, body string, at time.Time) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), rabbitmq.DefaultConfirmTimeout)
+	defer cancel()
+	return b.Schedule(ctx, exchange, routingKey, amqp.Publishing{
+		ContentType:  "text/plain",
+		DeliveryMode: amqp.Persistent,
+		Body:         []byte(body),
+	}, at)
+}
+
+func (b *Broker) CancelScheduled(ctx context.Context, id string) error {
+	removed, err := b.rdb.ZRem(ctx, scheduleKey, id).Result()
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return rabbitmq.ErrScheduleNotFound
+	}
+	return b.rdb.HDel(ctx, schedulePayloadKey, id).Err()
+}
+
+// runScheduler publishes the due scheduled messages until the broker is closed
+func (b *Broker) runScheduler() {
+	ticker := time.NewTicker(schedulePoll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+		}
+		if err := b.publishDue(context.Background()); err != nil && !errors.Is(err, redis.Nil) {
+			zap.L().Error("Failed to publish scheduled messages", zap.Error(err))
+		}
+	}
+}
+
+func (b *Broker) publishDue(ctx context.Context) error {
+	now := time.Now()
+	ids, err := claimScript.Run(ctx, b.rdb, []string{scheduleKey},
+		now.UnixMilli(), now.Add(scheduleLease).UnixMilli(), scheduleBatch).StringSlice()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		payload, err := b.rdb.HGet(ctx, schedulePayloadKey, id).Result()
+		if errors.Is(err, redis.Nil) {
+			// cancelled after it was claimed
+			b.rdb.ZRem(ctx, scheduleKey, id)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		var values map[string]interface{}
+		if err := json.Unmarshal([]byte(payload), &values); err != nil {
+			zap.L().Warn("Dropping malformed scheduled message", zap.String("scheduleId", id), zap.Error(err))
+			b.remove(ctx, id)
+			continue
+		}
+		exchange, _ := values["exchange"].(string)
+		routingKey, _ := values["routing_key"].(string)
+		values["timestamp"] = strconv.FormatInt(time.Now().UnixMilli(), 10)
+		queues, err := b.Route(exchange, routingKey)
+		if err != nil {
+			// retried once the lease ran out, the exchange may not be declared yet
+			zap.L().Error("Failed to route scheduled message", zap.String("scheduleId", id), zap.Error(err))
+			continue
+		}
+		for _, queue := range queues {
+			if err := b.add(ctx, queue, values); err != nil {
+				return err
+			}
+		}
+		b.remove(ctx, id)
+	}
+	return nil
+}
+
+func (b *Broker) remove(ctx context.Context, id string) {
+	pipe := b.rdb.TxPipeline()
+	pipe.ZRem(ctx, scheduleKey, id)
+	pipe.HDel(ctx, schedulePayloadKey, id)
+	if _, err := pipe.Exec(ctx); err != nil {
+		zap.L().Error("Failed to remove scheduled message", zap.String("scheduleId", id), zap.Error(err))
+	}
+}
@@ -0,0 +1,115 @@
+package response
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// stable codes of the AppErrors, clients match on them rather than on the message
+const (
+	ErrorCodeBadRequest      = "bad_request"
+	ErrorCodeUnauthorized    = "unauthorized"
+	ErrorCodeForbidden       = "forbidden"
+	ErrorCodeNotFound        = "not_found"
+	ErrorCodeConflict        = "conflict"
+	ErrorCodeTooManyRequests = "too_many_requests"
+	ErrorCodeInternal        = "internal_error"
+)
+
+// AppError is an error a handler reports with c.Error, rendered by the error handler middleware with
+// Status and the envelope. Message is shown to the client, Err is the cause, only logged.
+type AppError struct {
+	// Code is the stable code of the error, sent as errorCode
+	Code    string
+	Status  int
+	Message string
+	// Details are sent as the data of the envelope, e.g. the fields failing validation
+	Details any
+	Err     error
+}
+
+func NewAppError(code string, status int, message string) *AppError {
+	return &AppError{Code: code, Status: status, Message: message}
+}
+
+var (
+	ErrBadRequest      = NewAppError(ErrorCodeBadRequest, http.StatusBadRequest, msg[BadRequest])
+	ErrUnauthorized    = NewAppError(ErrorCodeUnauthorized, http.StatusUnauthorized, msg[Unauthorized])
+	ErrForbidden       = NewAppError(ErrorCodeForbidden, http.StatusForbidden, msg[Forbidden])
+	ErrNotFound        = NewAppError(ErrorCodeNotFound, http.StatusNotFound, msg[NotFound])
+	ErrConflict        = NewAppError(ErrorCodeConflict, http.StatusConflict, "Conflict")
+	ErrTooManyRequests = NewAppError(ErrorCodeTooManyRequests, http.StatusTooManyRequests, msg[TooManyRequests])
+	ErrInternal        = NewAppError(ErrorCodeInternal, http.StatusInternalServerError, msg[InternalServerError])
+)
+
+func (e *AppError) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *AppError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the AppErrors of the same code, so errors.Is(err, ErrNotFound) holds for a copy of it
+func (e *AppError) Is(target error) bool {
+	t, ok := target.(*AppError)
+	return ok && t.Code == e.Code
+}
+
+// WithMessage returns a copy of e with message
+func (e *AppError) WithMessage(message string) *AppError {
+	c := *e
+	c.Message = message
+	return &c
+}
+
+// WithDetails returns a copy of e with details
+func (e *AppError) WithDetails(details any) *AppError {
+	c := *e
+	c.Details = details
+	return &c
+}
+
+// Wrap returns a copy of e caused by err
+func (e *AppError) Wrap(err error) *AppError {
+	c := *e
+	c.Err = err
+	return &c
+}
+
+// AppErrorOf returns the AppError of a response code
+func AppErrorOf(code int) *AppError {
+	switch code {
+	case BadRequest, InvalidRequest:
+		return ErrBadRequest
+	case Unauthorized:
+		return ErrUnauthorized
+	case Forbidden:
+		return ErrForbidden
+	case NotFound:
+		return ErrNotFound
+	case TooManyRequests:
+		return ErrTooManyRequests
+	}
+	return ErrInternal
+}
+
+// AsAppError returns the AppError in the chain of err, or ErrInternal caused by err. The message of
+// an unexpected error is not safe to show.
+func AsAppError(err error) *AppError {
+	var appErr *AppError
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+	return ErrInternal.Wrap(err)
+}
+
+// AbortWithAppError aborts the request with the envelope of err and its status
+func AbortWithAppError(c *gin.Context, err *AppError) {
+	c.AbortWithStatusJSON(err.Status, errorData(err))
+}
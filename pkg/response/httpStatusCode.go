@@ -5,7 +5,9 @@ const (
 	BadRequest          = 400
 	Unauthorized        = 401
 	InvalidRequest      = 402
+	Forbidden           = 403
 	NotFound            = 404
+	TooManyRequests     = 429
 	InternalServerError = 500
 )
 
@@ -14,6 +16,8 @@ var msg = map[int]string{
 	Success:             "Success",
 	BadRequest:          "Bad Request",
 	Unauthorized:        "Unauthorized",
+	Forbidden:           "Forbidden",
 	NotFound:            "Not Found",
+	TooManyRequests:     "Too Many Requests",
 	InternalServerError: "Internal Server Error",
 }
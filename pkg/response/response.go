@@ -9,8 +9,10 @@ import (
 type ResponseData struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
-	Data    any    `json:"data"`
-	Success bool   `json:"success"`
+	// ErrorCode is the stable code of a failed response, see AppError
+	ErrorCode string `json:"errorCode,omitempty"`
+	Data      any    `json:"data"`
+	Success   bool   `json:"success"`
 }
 
 // success response
@@ -25,14 +27,22 @@ func SuccessResponse(c *gin.Context, code int, data interface{}) {
 
 // error response
 // default message is ""
+// it is sent as the AppError of code, see AppErrorOf, handlers report errors with c.Error instead
 func ErrorResponse(c *gin.Context, code int, message string) {
-	if message == "" {
-		message = msg[code]
+	err := AppErrorOf(code)
+	if message != "" {
+		err = err.WithMessage(message)
+	}
+	c.JSON(err.Status, errorData(err))
+}
+
+// errorData is the envelope of err, its code is the HTTP status like for a success
+func errorData(err *AppError) ResponseData {
+	return ResponseData{
+		Code:      err.Status,
+		Message:   err.Message,
+		ErrorCode: err.Code,
+		Data:      err.Details,
+		Success:   false,
 	}
-	c.JSON(http.StatusOK, ResponseData{
-		Code:    code,
-		Message: message,
-		Data:    nil,
-		Success: false,
-	})
 }
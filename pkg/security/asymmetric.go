@@ -173,12 +173,10 @@ func (a *SecurityService) VerifySignatureECDSA(msg []byte, rBase64, sBase64 stri
 	// Decode base64 r, s
 	rBytes, err := base64.StdEncoding.DecodeString(rBase64)
 	if err != nil {
-		fmt.Println("Invalid r value")
 		return false
 	}
 	sBytes, err := base64.StdEncoding.DecodeString(sBase64)
 	if err != nil {
-		fmt.Println("Invalid s value")
 		return false
 	}
 
@@ -319,7 +317,6 @@ func (a *SecurityService) SignMessageEd25519(msg []byte, privKey ed25519.Private
 func (a *SecurityService) VerifySignatureEd25519(msg []byte, signatureBase64 string, pubKey ed25519.PublicKey) bool {
 	signature, err := base64.StdEncoding.DecodeString(signatureBase64)
 	if err != nil {
-		fmt.Println("Invalid signature format")
 		return false
 	}
 	return ed25519.Verify(pubKey, msg, signature)
@@ -12,6 +12,11 @@ type Config struct {
 	Redis           RedisSetting          `mapstructure:"redis"`
 	Exchange        ExchangeSetting       `mapstructure:"exchange"`
 	Queue           QueueSetting          `mapstructure:"queue"`
+	Worker          WorkerSetting         `mapstructure:"worker"`
+	Topology        TopologySetting       `mapstructure:"topology"`
+	Messaging       MessagingSetting      `mapstructure:"messaging"`
+	Saga            SagaSetting           `mapstructure:"saga"`
+	RateLimit       RateLimitSetting      `mapstructure:"rate_limit"`
 }
 
 type RedisSetting struct {
@@ -77,22 +82,139 @@ type RabbitMQConfig struct {
 	User     string `mapstructure:"user" json:"user" yaml:"user"`
 	Password string `mapstructure:"password" json:"password" yaml:"password"`
 	VHost    string `mapstructure:"vhost" json:"vhost" yaml:"vhost"`
+	// consumer settings, see rabbitmq.ConsumerOptions. An unset max_retries keeps the default,
+	// 0 dead-letters a message on its first failure.
+	Prefetch           int    `mapstructure:"prefetch" json:"prefetch" yaml:"prefetch"`
+	MaxRetries         *int   `mapstructure:"max_retries" json:"max_retries" yaml:"max_retries"`
+	RetryBaseDelayMs   int    `mapstructure:"retry_base_delay_ms" json:"retry_base_delay_ms" yaml:"retry_base_delay_ms"`
+	RetryMaxDelayMs    int    `mapstructure:"retry_max_delay_ms" json:"retry_max_delay_ms" yaml:"retry_max_delay_ms"`
+	DeadLetterExchange string `mapstructure:"dead_letter_exchange" json:"dead_letter_exchange" yaml:"dead_letter_exchange"`
+	// Sharding is "exchange" for the x-consistent-hash plugin or "client" for stock brokers, see rabbitmq.ShardMode
+	Sharding string `mapstructure:"sharding" json:"sharding" yaml:"sharding"`
 }
 
 type CronjobSetting struct {
 	CronExecuteInterest string `mapstructure:"cron_execute_interest"`
 }
 
+// TokenValidationConfig selects how bearer tokens are checked, see token.Authenticator
 type TokenValidationConfig struct {
+	// Mode is "jwt" (default) to verify tokens locally or "introspection" to ask URL
+	Mode string `mapstructure:"mode"`
+	// JwksURL is the http(s) URL or file path of the JSON Web Key Set signing the tokens
+	JwksURL        string `mapstructure:"jwks_url"`
+	JwksRefreshSec int    `mapstructure:"jwks_refresh_sec"`
+	Issuer         string `mapstructure:"issuer"`
+	// Audience must be one of the aud of a token when set
+	Audience     string `mapstructure:"audience"`
+	ClockSkewSec int    `mapstructure:"clock_skew_sec"`
+
 	ClientID string `mapstructure:"client_id"`
 	URL      string `mapstructure:"url"`
 	XApiKey  string `mapstructure:"x_api_key"`
+	// IntrospectionCacheSec is how long an introspected token is trusted from Redis
+	IntrospectionCacheSec int `mapstructure:"introspection_cache_sec"`
 }
 
 type ExchangeSetting struct {
-	Test string `mapstructure:"test"`
+	Test   string `mapstructure:"test"`
+	Wallet string `mapstructure:"wallet"`
+	// Interest receives the take-interest messages of the cron job, hashed by user onto the interest queue
+	Interest string `mapstructure:"interest"`
 }
 
 type QueueSetting struct {
 	Test string `mapstructure:"test"`
+	// Interest is the "name:N" queue of the take-interest messages
+	Interest string `mapstructure:"interest"`
+}
+
+// MessagingSetting selects the message transport, the rabbitmq consumer settings apply to both
+type MessagingSetting struct {
+	// Transport is "rabbitmq" (default) or "redis" for Redis Streams
+	Transport string `mapstructure:"transport"`
+	// StreamGroup is the consumer group reading the streams, defaults to redisstream.DefaultGroup
+	StreamGroup  string `mapstructure:"stream_group"`
+	StreamMaxLen int64  `mapstructure:"stream_max_len"`
+	// Codec encodes the published message bodies, "json" (default) or "protobuf"
+	Codec string `mapstructure:"codec"`
+	// Producer names this service in the message envelopes
+	Producer string `mapstructure:"producer"`
+}
+
+// SagaSetting bounds the running sagas, see messaging.SagaOrchestrator
+type SagaSetting struct {
+	// TimeoutSec is the default time a saga may run before its completed steps are compensated
+	TimeoutSec       int `mapstructure:"timeout_sec"`
+	SweepIntervalSec int `mapstructure:"sweep_interval_sec"`
+}
+
+// RateLimitSetting are the request quotas of RateLimitMiddleware, counted in Redis so they hold across
+// the instances. A request is checked against every rule matching its route.
+type RateLimitSetting struct {
+	Rules []RateLimitRule `mapstructure:"rules"`
+	// FallbackCooldownSec is how long the in-process limiter takes over after Redis failed before Redis
+	// is tried again, 5 seconds when unset
+	FallbackCooldownSec int `mapstructure:"fallback_cooldown_sec"`
+}
+
+// RateLimitRule allows Limit requests per PeriodSec to each key built from By, e.g. a tighter rule on
+// the deposit and withdraw routes keyed by user and project next to a global one keyed by ip
+type RateLimitRule struct {
+	Name string `mapstructure:"name"`
+	// Routes are the gin route paths the rule applies to, like "/v1/api/deposit", every route when empty
+	Routes []string `mapstructure:"routes"`
+	// By are the parts of the key among "ip", "user", "project" and "route", "ip" when empty. "project" is
+	// the project claim of the token, a rule keyed by project is skipped for a token without one.
+	By        []string `mapstructure:"by"`
+	Limit     int      `mapstructure:"limit"`
+	PeriodSec int      `mapstructure:"period_sec"`
+}
+
+// WorkerSetting bounds the consumers the worker runs per queue shard
+type WorkerSetting struct {
+	MinConsumers int `mapstructure:"min_consumers"`
+	MaxConsumers int `mapstructure:"max_consumers"`
+	// MessagesPerConsumer is the backlog one consumer is expected to keep up with
+	MessagesPerConsumer int `mapstructure:"messages_per_consumer"`
+	ScaleIntervalSec    int `mapstructure:"scale_interval_sec"`
+	DrainTimeoutSec     int `mapstructure:"drain_timeout_sec"`
+}
+
+// TopologySetting is the RabbitMQ topology declared at startup, see rabbitmq.Topology
+type TopologySetting struct {
+	Exchanges []ExchangeTopology `mapstructure:"exchanges"`
+	Queues    []QueueTopology    `mapstructure:"queues"`
+	Bindings  []BindingTopology  `mapstructure:"bindings"`
+}
+
+type ExchangeTopology struct {
+	Name string `mapstructure:"name"`
+	Type string `mapstructure:"type"`
+	// Durable defaults to true
+	Durable    *bool                  `mapstructure:"durable"`
+	AutoDelete bool                   `mapstructure:"auto_delete"`
+	Internal   bool                   `mapstructure:"internal"`
+	Arguments  map[string]interface{} `mapstructure:"arguments"`
+}
+
+type QueueTopology struct {
+	Name   string `mapstructure:"name"`
+	Shards int    `mapstructure:"shards"`
+	// Durable defaults to true
+	Durable              *bool                  `mapstructure:"durable"`
+	AutoDelete           bool                   `mapstructure:"auto_delete"`
+	MessageTTLMs         int                    `mapstructure:"message_ttl_ms"`
+	MaxLength            int                    `mapstructure:"max_length"`
+	DeadLetterExchange   string                 `mapstructure:"dead_letter_exchange"`
+	DeadLetterRoutingKey string                 `mapstructure:"dead_letter_routing_key"`
+	Arguments            map[string]interface{} `mapstructure:"arguments"`
+}
+
+type BindingTopology struct {
+	Queue      string                 `mapstructure:"queue"`
+	Exchange   string                 `mapstructure:"exchange"`
+	RoutingKey string                 `mapstructure:"routing_key"`
+	Weight     int                    `mapstructure:"weight"`
+	Arguments  map[string]interface{} `mapstructure:"arguments"`
 }
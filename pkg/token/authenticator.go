@@ -0,0 +1,90 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"ecom/pkg/setting"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	ModeJWT           = "jwt"
+	ModeIntrospection = "introspection"
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// Authenticator checks a bearer token and returns its claims, errors wrap ErrInvalidToken when the
+// token itself is rejected
+type Authenticator interface {
+	Authenticate(ctx context.Context, raw string) (*Claims, error)
+}
+
+// NewAuthenticator returns the authenticator of the token_validation mode, cache keeps the results of
+// the introspection mode
+func NewAuthenticator(cfg setting.TokenValidationConfig, cache IntrospectionCache) (Authenticator, error) {
+	switch cfg.Mode {
+	case "", ModeJWT:
+		if cfg.JwksURL == "" {
+			return nil, errors.New("token_validation.jwks_url is not set")
+		}
+		keys := NewKeySet(cfg.JwksURL, time.Duration(cfg.JwksRefreshSec)*time.Second)
+		return NewVerifier(keys, cfg.Issuer, cfg.Audience, time.Duration(cfg.ClockSkewSec)*time.Second), nil
+	case ModeIntrospection:
+		if cfg.URL == "" {
+			return nil, errors.New("token_validation.url is not set")
+		}
+		return NewIntrospector(cfg.URL, cfg.ClientID, cfg.XApiKey, cache, time.Duration(cfg.IntrospectionCacheSec)*time.Second), nil
+	}
+	return nil, fmt.Errorf("unknown token validation mode %q", cfg.Mode)
+}
+
+// signingMethods are the asymmetric algorithms accepted, symmetric ones would let anyone holding a
+// public key sign tokens
+var signingMethods = []string{
+	"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA",
+}
+
+// Verifier checks JWTs locally against a KeySet
+type Verifier struct {
+	keys   *KeySet
+	parser *jwt.Parser
+}
+
+// NewVerifier checks the signature, expiry, not-before and issued-at of a token with skew allowed for
+// clock differences, and the issuer and audience when they are set
+func NewVerifier(keys *KeySet, issuer, audience string, skew time.Duration) *Verifier {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(skew),
+	}
+	if issuer != "" {
+		options = append(options, jwt.WithIssuer(issuer))
+	}
+	if audience != "" {
+		options = append(options, jwt.WithAudience(audience))
+	}
+	return &Verifier{keys: keys, parser: jwt.NewParser(options...)}
+}
+
+func (v *Verifier) Authenticate(ctx context.Context, raw string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := v.parser.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.keys.Key(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing sub", ErrInvalidToken)
+	}
+	claims.normalize()
+	return claims, nil
+}
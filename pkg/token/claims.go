@@ -0,0 +1,53 @@
+package token
+
+import (
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Claims are the claims of an authenticated bearer token
+type Claims struct {
+	jwt.RegisteredClaims
+	Name              string   `json:"name,omitempty"`
+	PreferredUsername string   `json:"preferred_username,omitempty"`
+	Email             string   `json:"email,omitempty"`
+	Roles             []string `json:"roles,omitempty"`
+	// Scope is the space separated list of the OAuth scopes granted to the token
+	Scope string `json:"scope,omitempty"`
+	// Project is the slug of the project the token was issued to, set for the clients of a platform
+	Project string `json:"project,omitempty"`
+	// RealmAccess carries the roles of Keycloak tokens, they are merged into Roles
+	RealmAccess struct {
+		Roles []string `json:"roles,omitempty"`
+	} `json:"realm_access,omitempty"`
+}
+
+// HasRole reports whether the token was granted role
+func (c *Claims) HasRole(role string) bool {
+	for _, granted := range c.Roles {
+		if granted == role {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the token was granted scope
+func (c *Claims) HasScope(scope string) bool {
+	for _, granted := range strings.Fields(c.Scope) {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize merges the Keycloak realm roles into Roles
+func (c *Claims) normalize() {
+	for _, role := range c.RealmAccess.Roles {
+		if !c.HasRole(role) {
+			c.Roles = append(c.Roles, role)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package token
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	DefaultIntrospectionCache = time.Minute
+	introspectionTimeout      = 10 * time.Second
+)
+
+// IntrospectionCache keeps the claims of introspected tokens by the hash of the token
+type IntrospectionCache interface {
+	GetClaims(ctx context.Context, key string) (*Claims, bool, error)
+	SetClaims(ctx context.Context, key string, claims *Claims, ttl time.Duration) error
+}
+
+type introspectionRequest struct {
+	ClientID string `json:"client_id"`
+	Token    string `json:"token"`
+}
+
+type introspectionResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    struct {
+		Message string `json:"message"`
+		Result  struct {
+			Sub               string   `json:"sub"`
+			Name              string   `json:"name"`
+			PreferredUsername string   `json:"preferred_username"`
+			Email             string   `json:"email"`
+			Roles             []string `json:"roles"`
+			Scope             string   `json:"scope"`
+			Project           string   `json:"project"`
+		} `json:"result"`
+	} `json:"data"`
+	Success bool `json:"success"`
+}
+
+// Introspector asks the token validation service about every token it has not seen within the cache
+// time. Only accepted tokens are cached, and never past their expiry when the service reports one.
+type Introspector struct {
+	url      string
+	clientID string
+	apiKey   string
+	cache    IntrospectionCache
+	ttl      time.Duration
+	client   *http.Client
+}
+
+func NewIntrospector(url, clientID, apiKey string, cache IntrospectionCache, ttl time.Duration) *Introspector {
+	if ttl <= 0 {
+		ttl = DefaultIntrospectionCache
+	}
+	return &Introspector{
+		url:      url,
+		clientID: clientID,
+		apiKey:   apiKey,
+		cache:    cache,
+		ttl:      ttl,
+		client:   &http.Client{Timeout: introspectionTimeout},
+	}
+}
+
+func (i *Introspector) Authenticate(ctx context.Context, raw string) (*Claims, error) {
+	sum := sha256.Sum256([]byte(raw))
+	key := hex.EncodeToString(sum[:])
+	if i.cache != nil {
+		if claims, ok, err := i.cache.GetClaims(ctx, key); err == nil && ok {
+			return claims, nil
+		}
+	}
+
+	claims, err := i.introspect(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+	if i.cache != nil {
+		ttl := i.ttl
+		if claims.ExpiresAt != nil && time.Until(claims.ExpiresAt.Time) < ttl {
+			ttl = time.Until(claims.ExpiresAt.Time)
+		}
+		if ttl > 0 {
+			// a cache that is down only costs the next request an introspection
+			i.cache.SetClaims(ctx, key, claims, ttl)
+		}
+	}
+	return claims, nil
+}
+
+func (i *Introspector) introspect(ctx context.Context, raw string) (*Claims, error) {
+	body, err := json.Marshal(introspectionRequest{ClientID: i.clientID, Token: raw})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", i.apiKey)
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("introspect token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result introspectionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("introspect token: %w", err)
+	}
+	if !result.Success || result.Code != http.StatusOK || result.Data.Result.Sub == "" {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, result.Message)
+	}
+	claims := &Claims{
+		Name:              result.Data.Result.Name,
+		PreferredUsername: result.Data.Result.PreferredUsername,
+		Email:             result.Data.Result.Email,
+		Roles:             result.Data.Result.Roles,
+		Scope:             result.Data.Result.Scope,
+		Project:           result.Data.Result.Project,
+	}
+	claims.Subject = result.Data.Result.Sub
+	return claims, nil
+}
@@ -0,0 +1,228 @@
+package token
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultJwksRefresh = time.Hour
+	// minJwksRefresh limits the refreshes forced by tokens with an unknown kid
+	minJwksRefresh = 30 * time.Second
+	jwksTimeout    = 10 * time.Second
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// KeySet is a JSON Web Key Set read from a URL or a file and cached by kid. It is read again after the
+// refresh interval, and sooner when a token names a kid it does not know, so rotated keys are picked up
+// without a restart. A failed refresh keeps the keys already known.
+type KeySet struct {
+	source  string
+	refresh time.Duration
+	client  *http.Client
+
+	mu        sync.RWMutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// NewKeySet returns the key set at source, an http(s) URL or a file path
+func NewKeySet(source string, refresh time.Duration) *KeySet {
+	if refresh <= 0 {
+		refresh = DefaultJwksRefresh
+	}
+	return &KeySet{
+		source:  source,
+		refresh: refresh,
+		client:  &http.Client{Timeout: jwksTimeout},
+		keys:    make(map[string]crypto.PublicKey),
+	}
+}
+
+// Key returns the key with kid. An empty kid is accepted when the set has a single key.
+func (ks *KeySet) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	ks.mu.RLock()
+	key, ok := ks.lookup(kid)
+	stale := time.Since(ks.fetchedAt) > ks.refresh
+	canForce := time.Since(ks.fetchedAt) > minJwksRefresh
+	ks.mu.RUnlock()
+	if ok && !stale {
+		return key, nil
+	}
+	if ok || canForce {
+		if err := ks.Refresh(ctx); err != nil && !ok {
+			return nil, err
+		}
+	}
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	if key, ok := ks.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+}
+
+// lookup finds a key, ks.mu must be held
+func (ks *KeySet) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(ks.keys) == 1 {
+		for _, key := range ks.keys {
+			return key, true
+		}
+	}
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+// Refresh reads the key set again and replaces the cached keys
+func (ks *KeySet) Refresh(ctx context.Context) error {
+	data, err := ks.read(ctx)
+	if err == nil {
+		var keys map[string]crypto.PublicKey
+		keys, err = ParseJWKS(data)
+		if err == nil {
+			ks.mu.Lock()
+			ks.keys = keys
+			ks.fetchedAt = time.Now()
+			ks.mu.Unlock()
+			return nil
+		}
+	}
+	// without keys the next attempt waits minJwksRefresh instead of running on every request
+	ks.mu.Lock()
+	if len(ks.keys) == 0 {
+		ks.fetchedAt = time.Now()
+	}
+	ks.mu.Unlock()
+	return fmt.Errorf("read jwks %s: %w", ks.source, err)
+}
+
+func (ks *KeySet) read(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(ks.source, "http://") && !strings.HasPrefix(ks.source, "https://") {
+		return os.ReadFile(ks.source)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ks.source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := ks.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// ParseJWKS reads the signing keys of a JSON Web Key Set by kid, RSA, EC and Ed25519 keys are supported.
+// Encryption keys and key types it does not know are skipped.
+func ParseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", jwk.Kid, err)
+		}
+		if key != nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no signing keys")
+	}
+	return keys, nil
+}
+
+func (jwk jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("curve %q is not supported", jwk.Crv)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("curve %q is not supported", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, nil
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
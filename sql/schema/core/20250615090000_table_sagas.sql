@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE sagas (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    saga_type TEXT NOT NULL,
+    reference TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'running',
+    step INT NOT NULL DEFAULT 0,
+    data JSONB NOT NULL,
+    last_error TEXT,
+    timeout_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE UNIQUE INDEX sagas_type_reference_idx ON sagas (saga_type, reference);
+CREATE INDEX sagas_running_timeout_idx ON sagas (timeout_at) WHERE status = 'running';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE sagas;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE project_members (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    project_id INT NOT NULL,
+    user_id TEXT NOT NULL,
+    role TEXT NOT NULL DEFAULT 'member',
+    date_created TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE UNIQUE INDEX project_members_project_user_idx ON project_members (project_id, user_id);
+CREATE INDEX project_members_user_idx ON project_members (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE project_members;
+-- +goose StatementEnd
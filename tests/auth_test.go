@@ -0,0 +1,208 @@
+package tests
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ecom/global"
+	"ecom/internal/middlewares"
+	"ecom/internal/repo"
+	"ecom/pkg/response"
+	"ecom/pkg/token"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type signingKey struct {
+	kid string
+	key *rsa.PrivateKey
+}
+
+func newSigningKey(t *testing.T, kid string) signingKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return signingKey{kid: kid, key: key}
+}
+
+func writeJWKS(t *testing.T, path string, keys ...signingKey) {
+	var set struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	for _, k := range keys {
+		set.Keys = append(set.Keys, map[string]string{
+			"kty": "RSA",
+			"kid": k.kid,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(k.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.key.E)).Bytes()),
+		})
+	}
+	data, err := json.Marshal(set)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+}
+
+func signToken(t *testing.T, k signingKey, claims jwt.MapClaims) string {
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	tok.Header["kid"] = k.kid
+	raw, err := tok.SignedString(k.key)
+	require.NoError(t, err)
+	return raw
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":          "user-1",
+		"name":         "Jane",
+		"iss":          "https://auth.example.com",
+		"aud":          "ecom",
+		"exp":          time.Now().Add(time.Hour).Unix(),
+		"iat":          time.Now().Unix(),
+		"roles":        []string{"admin"},
+		"realm_access": map[string]interface{}{"roles": []string{"operator"}},
+	}
+}
+
+func TestVerifierChecksSignatureAndClaims(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	current := newSigningKey(t, "key-1")
+	writeJWKS(t, path, current)
+	verifier := token.NewVerifier(token.NewKeySet(path, time.Hour), "https://auth.example.com", "ecom", time.Minute)
+
+	claims, err := verifier.Authenticate(context.Background(), signToken(t, current, validClaims()))
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", claims.Subject)
+	assert.Equal(t, "Jane", claims.Name)
+	assert.True(t, claims.HasRole("admin"))
+	assert.True(t, claims.HasRole("operator"))
+
+	for name, change := range map[string]func(jwt.MapClaims){
+		"expired":        func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-2 * time.Minute).Unix() },
+		"wrong issuer":   func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" },
+		"wrong audience": func(c jwt.MapClaims) { c["aud"] = "other" },
+		"no expiry":      func(c jwt.MapClaims) { delete(c, "exp") },
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := validClaims()
+			change(c)
+			_, err := verifier.Authenticate(context.Background(), signToken(t, current, c))
+			assert.ErrorIs(t, err, token.ErrInvalidToken)
+		})
+	}
+
+	// within the clock skew
+	c := validClaims()
+	c["exp"] = time.Now().Add(-30 * time.Second).Unix()
+	_, err = verifier.Authenticate(context.Background(), signToken(t, current, c))
+	assert.NoError(t, err)
+
+	// signed by a key that is not in the set
+	_, err = verifier.Authenticate(context.Background(), signToken(t, newSigningKey(t, "key-1"), validClaims()))
+	assert.ErrorIs(t, err, token.ErrInvalidToken)
+}
+
+func TestKeySetPicksUpRotatedKeysByKid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	old := newSigningKey(t, "key-1")
+	writeJWKS(t, path, old)
+	keys := token.NewKeySet(path, time.Hour)
+	_, err := keys.Key(context.Background(), "key-1")
+	require.NoError(t, err)
+
+	rotated := newSigningKey(t, "key-2")
+	writeJWKS(t, path, old, rotated)
+	// the first fetch was less than the forced refresh interval ago
+	_, err = keys.Key(context.Background(), "key-2")
+	assert.ErrorIs(t, err, token.ErrUnknownKey)
+
+	require.NoError(t, keys.Refresh(context.Background()))
+	_, err = keys.Key(context.Background(), "key-2")
+	assert.NoError(t, err)
+}
+
+func TestIntrospectorCachesAcceptedTokens(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		var req struct {
+			Token string `json:"token"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Token != "good" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"code": 401, "message": "invalid", "success": false})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"code":    200,
+			"success": true,
+			"data":    map[string]interface{}{"result": map[string]interface{}{"sub": "user-1", "name": "Jane"}},
+		})
+	}))
+	defer server.Close()
+
+	global.Rdb = redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	introspector := token.NewIntrospector(server.URL, "ecom", "key", repo.NewTokenRepository(), time.Minute)
+
+	for i := 0; i < 2; i++ {
+		claims, err := introspector.Authenticate(context.Background(), "good")
+		require.NoError(t, err)
+		assert.Equal(t, "user-1", claims.Subject)
+		assert.Equal(t, "Jane", claims.Name)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	_, err := introspector.Authenticate(context.Background(), "bad")
+	assert.ErrorIs(t, err, token.ErrInvalidToken)
+}
+
+func TestAuthMiddlewareSetsClaims(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	key := newSigningKey(t, "key-1")
+	writeJWKS(t, path, key)
+	global.Authenticator = token.NewVerifier(token.NewKeySet(path, time.Hour), "", "", 0)
+
+	r := gin.New()
+	r.Use(middlewares.ErrorHandlerMiddleware())
+	r.GET("/me", middlewares.AuthMiddleware(), func(c *gin.Context) {
+		claims, ok := middlewares.ClaimsOf(c)
+		require.True(t, ok)
+		response.SuccessResponse(c, response.Success, gin.H{"userId": c.GetString(middlewares.ContextKeyUserID), "name": claims.Name})
+	})
+
+	serve := func(authorization string) response.ResponseData {
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var body response.ResponseData
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return body
+	}
+
+	body := serve("Bearer " + signToken(t, key, validClaims()))
+	assert.True(t, body.Success)
+	assert.Equal(t, map[string]interface{}{"userId": "user-1", "name": "Jane"}, body.Data)
+
+	assert.Equal(t, response.Unauthorized, serve("").Code)
+	assert.Equal(t, response.Unauthorized, serve("Bearer not-a-jwt").Code)
+}
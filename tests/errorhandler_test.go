@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ecom/internal/middlewares"
+	"ecom/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestErrorHandlerRendersAppErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logs := observeLogs(t)
+
+	r := gin.New()
+	r.Use(middlewares.ErrorHandlerMiddleware())
+	r.GET("/invalid", func(c *gin.Context) {
+		c.Error(response.ErrBadRequest.WithMessage("Invalid amount").WithDetails(gin.H{"field": "amount"}))
+	})
+	r.GET("/missing", func(c *gin.Context) {
+		c.Error(response.ErrNotFound.Wrap(errors.New("sql: no rows in result set")))
+	})
+	r.GET("/unexpected", func(c *gin.Context) {
+		c.Error(errors.New("connection refused"))
+	})
+	r.GET("/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+	r.GET("/written", func(c *gin.Context) {
+		response.ErrorResponse(c, response.InvalidRequest, "Invalid request")
+		c.Error(errors.New("already answered"))
+	})
+
+	serve := func(path string) (int, response.ResponseData) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var body response.ResponseData
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return w.Code, body
+	}
+
+	status, body := serve("/invalid")
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, response.ResponseData{
+		Code: http.StatusBadRequest, Message: "Invalid amount", ErrorCode: response.ErrorCodeBadRequest,
+		Data: map[string]interface{}{"field": "amount"},
+	}, body)
+
+	status, body = serve("/missing")
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Equal(t, response.ErrorCodeNotFound, body.ErrorCode)
+	assert.Equal(t, "Not Found", body.Message)
+
+	status, body = serve("/unexpected")
+	assert.Equal(t, http.StatusInternalServerError, status)
+	assert.Equal(t, response.ErrorCodeInternal, body.ErrorCode)
+	assert.Equal(t, "Internal Server Error", body.Message)
+	require.Equal(t, 1, logs.FilterMessage("Request failed").Len())
+
+	status, body = serve("/panic")
+	assert.Equal(t, http.StatusInternalServerError, status)
+	assert.Equal(t, response.ErrorCodeInternal, body.ErrorCode)
+	panics := logs.FilterMessage("Recovered from panic").All()
+	require.Len(t, panics, 1)
+	assert.Equal(t, zapcore.ErrorLevel, panics[0].Level)
+	assert.Equal(t, "boom", panics[0].ContextMap()["panic"])
+	assert.Contains(t, panics[0].ContextMap()["stack"], "errorhandler_test.go")
+
+	status, body = serve("/written")
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "Invalid request", body.Message)
+	// the envelope code is the HTTP status, like the one of an AppError reported with c.Error
+	assert.Equal(t, http.StatusBadRequest, body.Code)
+	assert.Equal(t, response.ErrorCodeBadRequest, body.ErrorCode)
+}
+
+func TestAppErrorsMatchByCode(t *testing.T) {
+	err := response.ErrNotFound.WithMessage("Test not found").Wrap(errors.New("no rows"))
+	assert.ErrorIs(t, err, response.ErrNotFound)
+	assert.NotErrorIs(t, err, response.ErrBadRequest)
+	assert.Equal(t, "Not Found", response.ErrNotFound.Message)
+	assert.Equal(t, err, response.AsAppError(err))
+	assert.Equal(t, response.ErrorCodeInternal, response.AsAppError(errors.New("boom")).Code)
+}
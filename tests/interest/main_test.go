@@ -8,6 +8,7 @@ import (
 
 	"ecom/internal/model"
 	"ecom/internal/utils/interest"
+	"ecom/pkg/money"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -17,11 +18,11 @@ func TestCalculateInterestDeposit(t *testing.T) {
 	t.Run("Normal case", func(t *testing.T) {
 		// Mock data for balanceBeforeUpdate (this simulates the wallet data)
 		balanceBeforeUpdate := model.Wallet{
-			LastTimeUpdate: "1741686996",        // Mock last time update as UNIX timestamp
-			TimeDeposit:    "1741591420",        // Mock time deposit as UNIX timestamp
-			Balance:        "18.94508622222222", // Mock balance as a string
-			IsNew:          false,               // Simulate a new wallet
-			AmountInterest: "0",
+			LastTimeUpdate: "1741686996",                         // Mock last time update as UNIX timestamp
+			TimeDeposit:    "1741591420",                         // Mock time deposit as UNIX timestamp
+			Balance:        money.MustParse("18.94508622222222"), // Mock balance
+			IsNew:          false,                                // Simulate a new wallet
+			AmountInterest: money.Zero,
 			ProviderKey:    "123456abc",
 		}
 
@@ -59,10 +60,10 @@ func TestCalculateInterest(t *testing.T) {
 	t.Run("Normal case", func(t *testing.T) {
 		// Mock data for balanceBeforeUpdate (this simulates the wallet data)
 		balanceBeforeUpdate := model.Wallet{
-			LastTimeUpdate: "1633014000", // Mock last time update as UNIX timestamp
-			TimeDeposit:    "1633014000", // Mock time deposit as UNIX timestamp
-			Balance:        "1000",       // Mock balance as a string
-			IsNew:          true,         // Simulate a new wallet
+			LastTimeUpdate: "1633014000",            // Mock last time update as UNIX timestamp
+			TimeDeposit:    "1633014000",            // Mock time deposit as UNIX timestamp
+			Balance:        money.MustParse("1000"), // Mock balance
+			IsNew:          true,                    // Simulate a new wallet
 		}
 
 		// Mock settings for interest calculation
@@ -94,11 +95,11 @@ func TestCalculateInterest(t *testing.T) {
 
 		// Expected values (based on your business logic, replace with actual expected results)
 		expectedLastTimeUpdate := nowTime
-		expectedAmountInterest := 10.0 // Example expected interest
+		expectedAmountInterest := money.MustParse("10") // Example expected interest
 
 		// Assert that the actual and expected results are the same
 		assert.Equal(t, expectedLastTimeUpdate, lastTimeUpdate, "LastTimeUpdate should match the current time")
-		assert.Equal(t, expectedAmountInterest, amountInterestUpdate, "AmountInterest should match the expected interest")
+		assert.True(t, expectedAmountInterest.Equal(amountInterestUpdate), "AmountInterest should match the expected interest")
 	})
 
 	// Test Case 2: Case when IsNew is false (should not calculate any interest)
@@ -106,7 +107,7 @@ func TestCalculateInterest(t *testing.T) {
 		balanceBeforeUpdate := model.Wallet{
 			LastTimeUpdate: "1633014000",
 			TimeDeposit:    "1633014000",
-			Balance:        "1000",
+			Balance:        money.MustParse("1000"),
 			IsNew:          false, // Wallet is not new, so interest should not be calculated
 		}
 
@@ -133,7 +134,7 @@ func TestCalculateInterest(t *testing.T) {
 		_, amountInterestUpdate := interest.CalculateInterest(&balanceBeforeUpdate, &settings, nowTime)
 
 		// Assert that no interest is calculated when IsNew is false
-		assert.Equal(t, float64(0), amountInterestUpdate, "AmountInterest should be 0 when wallet is not new")
+		assert.True(t, amountInterestUpdate.IsZero(), "AmountInterest should be 0 when wallet is not new")
 	})
 
 	// Test Case 3: Case when lastTimeUpdate equals nowTime (no time difference)
@@ -141,7 +142,7 @@ func TestCalculateInterest(t *testing.T) {
 		balanceBeforeUpdate := model.Wallet{
 			LastTimeUpdate: "1633014000",
 			TimeDeposit:    "1633014000",
-			Balance:        "1000",
+			Balance:        money.MustParse("1000"),
 			IsNew:          true,
 		}
 
@@ -170,7 +171,7 @@ func TestCalculateInterest(t *testing.T) {
 		_, amountInterestUpdate := interest.CalculateInterest(&balanceBeforeUpdate, &settings, nowTime)
 
 		// Assert that no interest is calculated because no time has passed
-		assert.Equal(t, float64(0), amountInterestUpdate, "AmountInterest should be 0 if no time has passed")
+		assert.True(t, amountInterestUpdate.IsZero(), "AmountInterest should be 0 if no time has passed")
 	})
 
 	// Test Case 4: Case when balanceBeforeUpdate is invalid (empty balance)
@@ -178,7 +179,7 @@ func TestCalculateInterest(t *testing.T) {
 		balanceBeforeUpdate := model.Wallet{
 			LastTimeUpdate: "1633014000",
 			TimeDeposit:    "1633014000",
-			Balance:        "", // Invalid balance
+			Balance:        money.Zero, // Empty balance
 			IsNew:          true,
 		}
 
@@ -205,6 +206,6 @@ func TestCalculateInterest(t *testing.T) {
 		_, amountInterestUpdate := interest.CalculateInterest(&balanceBeforeUpdate, &settings, nowTime)
 
 		// Assert that the function handles the error gracefully
-		assert.Equal(t, float64(0), amountInterestUpdate, "AmountInterest should be 0 when balance is invalid")
+		assert.True(t, amountInterestUpdate.IsZero(), "AmountInterest should be 0 when balance is invalid")
 	})
 }
@@ -0,0 +1,60 @@
+package interest
+
+import (
+	"testing"
+
+	"ecom/internal/model"
+	"ecom/internal/utils/convert"
+	consts "ecom/pkg/const"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvertSettingInterest(t *testing.T) {
+	source := convert.SettingInterestSource{
+		WalletIntegration: model.WalletIntegration{
+			ID:                1,
+			Key:               "provider",
+			InterestDefault:   3,
+			InterestDetail:    `[{"cycle":2,"rates":[2]},{"cycle":1,"rates":[1]}]`,
+			FeeSetting:        `[{"transactionType":7,"feeFixed":1,"feePercent":0.5,"feeIn":true}]`,
+			ProfitTakingCycle: 1,
+			MinDeposit:        10,
+		},
+		InterestRates: []model.PlatformInterestRate{
+			{ID: 1, LockTime: 60, PercentPrincipal: 100, PercentInterest: 1},
+			{ID: 2, LockTime: 120, PercentPrincipal: 50, PercentInterest: 2},
+			{ID: 3, LockTime: 300, PercentPrincipal: 100, PercentInterest: 0.5, PercentForAdmin: 10},
+		},
+		Cycles: []model.Cycle{
+			{ID: 1, Key: "day", Value: 86400},
+			{ID: 2, Key: "week", Value: 604800},
+		},
+		TransactionTypes: []model.TransactionType{{ID: 7, Slug: consts.TransactionTypeWithdrawn}},
+		Currencies: []model.WalletIntegrationCurrency{
+			{Type: consts.WalletIntegrationCurrencyTypeDeposit, Currency: model.Currency{Slug: "usdt"}},
+			{Type: consts.WalletIntegrationCurrencyTypeOutputWithdrawn, Currency: model.Currency{Slug: "usdc"}},
+		},
+		Project: &model.Project{Slug: "project"},
+	}
+
+	setting, err := convert.ConvertSettingInterest(source)
+	assert.NoError(t, err)
+	assert.Equal(t, "project", setting.Platform)
+	assert.Equal(t, 86400, setting.ProfitTakingCycle)
+	assert.Equal(t, int64(300), setting.LockTimeDefault.LockTimeDefault)
+	assert.Equal(t, 0.5, setting.LockTimeDefault.PercentDefault)
+	assert.Len(t, setting.Percents, 2)
+	assert.Equal(t, 86400, setting.Percents[0].Seconds)
+	assert.Equal(t, int64(60), setting.Percents[0].Settings[0].LockTime)
+	assert.Equal(t, 604800, setting.Percents[1].Seconds)
+	assert.Len(t, setting.FeeSetting, 1)
+	assert.Equal(t, 10.0, setting.Deposit.MinDeposit)
+	assert.Len(t, setting.Deposit.CurrencySupportDeposit, 1)
+	assert.Len(t, setting.Withdrawn.CurrencySupportInput, 0)
+	assert.Len(t, setting.Withdrawn.CurrencySupportOutput, 1)
+
+	source.WalletIntegration.InterestDetail = `[{"cycle":9,"rates":[1]}]`
+	_, err = convert.ConvertSettingInterest(source)
+	assert.Error(t, err)
+}
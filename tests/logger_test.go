@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ecom/internal/middlewares"
+	"ecom/pkg/logger"
+	"ecom/pkg/rabbitmq"
+
+	"github.com/gin-gonic/gin"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// observeLogs makes zap.L() record its entries for the test
+func observeLogs(t *testing.T) *observer.ObservedLogs {
+	core, logs := observer.New(zapcore.DebugLevel)
+	t.Cleanup(zap.ReplaceGlobals(zap.New(core)))
+	return logs
+}
+
+func TestLoggerMiddlewarePropagatesRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logs := observeLogs(t)
+
+	r := gin.New()
+	r.Use(middlewares.LoggerMiddleware())
+	var correlationID string
+	r.GET("/tests/:id", func(c *gin.Context) {
+		correlationID = logger.CorrelationID(c.Request.Context())
+		logger.FromContext(c.Request.Context()).Info("Handling")
+		c.Set(middlewares.ContextKeyUserID, "user-1")
+		c.Status(http.StatusNotFound)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/tests/42", nil)
+	req.Header.Set(middlewares.HeaderRequestID, "req-1")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, "req-1", w.Header().Get(middlewares.HeaderRequestID))
+	assert.Equal(t, "req-1", correlationID)
+	require.Equal(t, 2, logs.Len())
+	assert.Equal(t, "req-1", logs.All()[0].ContextMap()["correlationId"])
+
+	access := logs.All()[1]
+	assert.Equal(t, zapcore.WarnLevel, access.Level)
+	fields := access.ContextMap()
+	assert.Equal(t, "req-1", fields["correlationId"])
+	assert.Equal(t, "/tests/:id", fields["route"])
+	assert.Equal(t, "/tests/42", fields["path"])
+	assert.Equal(t, int64(http.StatusNotFound), fields["status"])
+	assert.Equal(t, "user-1", fields["userId"])
+	assert.Contains(t, fields, "latency")
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/tests/42", nil))
+	assert.Len(t, w.Header().Get(middlewares.HeaderRequestID), 36)
+}
+
+type capturingPublisher struct {
+	published []amqp.Publishing
+}
+
+func (p *capturingPublisher) Publish(exchange, routingKey string, msg amqp.Publishing) error {
+	p.published = append(p.published, msg)
+	return nil
+}
+
+func (p *capturingPublisher) PublishWithConfirm(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) error {
+	return p.Publish(exchange, routingKey, msg)
+}
+
+func (p *capturingPublisher) PublishToExchange(exchange, routingKey, body string) error {
+	return p.Publish(exchange, routingKey, amqp.Publishing{Body: []byte(body)})
+}
+
+func TestCorrelationIDFollowsPublishedMessages(t *testing.T) {
+	logs := observeLogs(t)
+	publisher := &capturingPublisher{}
+	ctx := logger.WithCorrelationID(context.Background(), "req-1")
+	require.NoError(t, rabbitmq.PublishEnvelope(ctx, publisher, "ex", "key", rabbitmq.Envelope{EventType: "wallet.deposited"}, rabbitmq.JSONCodec, map[string]string{"a": "b"}))
+	require.Len(t, publisher.published, 1)
+
+	published := publisher.published[0]
+	delivery := amqp.Delivery{Headers: published.Headers, MessageId: published.MessageId, Type: published.Type}
+	assert.Equal(t, "req-1", rabbitmq.EnvelopeOf(delivery).CorrelationID)
+
+	consumed := rabbitmq.MessageContext(context.Background(), delivery)
+	assert.Equal(t, "req-1", logger.CorrelationID(consumed))
+	logger.FromContext(consumed).Info("Consumed")
+	fields := logs.All()[0].ContextMap()
+	assert.Equal(t, "req-1", fields["correlationId"])
+	assert.Equal(t, published.MessageId, fields["messageId"])
+	assert.Equal(t, "wallet.deposited", fields["eventType"])
+
+	// a message without correlation id is correlated by its own id
+	delivery.Headers = amqp.Table{}
+	assert.Equal(t, published.MessageId, logger.CorrelationID(rabbitmq.MessageContext(context.Background(), delivery)))
+}
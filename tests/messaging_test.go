@@ -1 +1,509 @@
 package tests
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ecom/global"
+	"ecom/internal/database"
+	"ecom/internal/messaging"
+	"ecom/internal/model"
+	"ecom/internal/worker"
+	"ecom/pkg/rabbitmq"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newTestBroker() *rabbitmq.MemoryBroker {
+	options := rabbitmq.DefaultConsumerOptions()
+	options.MaxRetries = 2
+	options.RetryBaseDelay = time.Millisecond
+	options.RetryMaxDelay = 5 * time.Millisecond
+	return rabbitmq.NewMemoryBroker(options)
+}
+
+func TestMemoryBrokerKeepsKeyOrderOnOneShard(t *testing.T) {
+	for _, mode := range []rabbitmq.ShardMode{rabbitmq.ShardByExchange, rabbitmq.ShardByClient} {
+		t.Run(string(mode), func(t *testing.T) {
+			broker := newTestBroker()
+			defer broker.Close()
+			require.NoError(t, broker.DeclareShardedExchange(rabbitmq.ShardedExchange{
+				Exchange: "test.sharded",
+				Queue:    "shard:4",
+				Mode:     mode,
+			}))
+
+			keys := []string{"user-1", "user-2", "user-3", "user-4", "user-5"}
+			var mu sync.Mutex
+			queues := make(map[string]map[string]bool) // key -> queues it was consumed from
+			sequences := make(map[string][]int)
+			var wg sync.WaitGroup
+			wg.Add(len(keys) * 10)
+			for i := 0; i < 4; i++ {
+				queue := fmt.Sprintf("shard:%d", i)
+				require.NoError(t, broker.Consume(queue, func(msg amqp.Delivery) error {
+					var body struct {
+						Key      string
+						Sequence int
+					}
+					require.NoError(t, json.Unmarshal(msg.Body, &body))
+					mu.Lock()
+					if queues[body.Key] == nil {
+						queues[body.Key] = make(map[string]bool)
+					}
+					queues[body.Key][queue] = true
+					sequences[body.Key] = append(sequences[body.Key], body.Sequence)
+					mu.Unlock()
+					wg.Done()
+					return nil
+				}))
+			}
+
+			for sequence := 0; sequence < 10; sequence++ {
+				for _, key := range keys {
+					body := fmt.Sprintf(`{"Key":%q,"Sequence":%d}`, key, sequence)
+					require.NoError(t, broker.PublishToExchange("test.sharded", key, body))
+				}
+			}
+			wg.Wait()
+
+			for _, key := range keys {
+				assert.Len(t, queues[key], 1, "messages of %s were spread over several shards", key)
+				assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, sequences[key])
+			}
+		})
+	}
+}
+
+func TestMemoryBrokerRetriesThenDeadLetters(t *testing.T) {
+	broker := newTestBroker()
+	defer broker.Close()
+	require.NoError(t, broker.DeclareQueue("orders"))
+
+	var calls int32
+	done := make(chan struct{})
+	require.NoError(t, broker.Consume("orders", func(msg amqp.Delivery) error {
+		if atomic.AddInt32(&calls, 1) == 3 {
+			defer close(done)
+		}
+		return errors.New("service unavailable")
+	}))
+	require.NoError(t, broker.Publish("", "orders", amqp.Publishing{Body: []byte("order")}))
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("message was not retried")
+	}
+	require.Eventually(t, func() bool {
+		return len(broker.Messages(rabbitmq.DeadLetterQueueName("orders"))) == 1
+	}, time.Second, time.Millisecond)
+
+	dead := broker.Messages(rabbitmq.DeadLetterQueueName("orders"))[0]
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	assert.Equal(t, 2, rabbitmq.RetryCount(dead))
+	assert.Equal(t, "service unavailable", dead.Headers[rabbitmq.HeaderError])
+	assert.Equal(t, "orders", dead.Headers[rabbitmq.HeaderOriginalQueue])
+}
+
+func TestMemoryBrokerDeadLettersPermanentErrorsAtOnce(t *testing.T) {
+	broker := newTestBroker()
+	defer broker.Close()
+	require.NoError(t, broker.DeclareQueue("orders"))
+
+	var calls int32
+	require.NoError(t, broker.Consume("orders", func(msg amqp.Delivery) error {
+		atomic.AddInt32(&calls, 1)
+		return rabbitmq.Permanent(errors.New("malformed"))
+	}))
+	require.NoError(t, broker.Publish("", "orders", amqp.Publishing{Body: []byte("order")}))
+
+	require.Eventually(t, func() bool {
+		return len(broker.Messages(rabbitmq.DeadLetterQueueName("orders"))) == 1
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestMemoryBrokerReplaysAndPurgesDeadLetters(t *testing.T) {
+	broker := newTestBroker()
+	defer broker.Close()
+	require.NoError(t, broker.ApplyTopology(rabbitmq.Topology{
+		Exchanges: []rabbitmq.ExchangeSpec{{Name: "orders.events", Kind: amqp.ExchangeDirect}},
+		Queues:    []rabbitmq.QueueSpec{{Name: "orders"}},
+		Bindings:  []rabbitmq.BindingSpec{{Queue: "orders", Exchange: "orders.events", RoutingKey: "created"}},
+	}))
+
+	var healthy int32
+	handled := make(chan string, 2)
+	require.NoError(t, broker.Consume("orders", func(msg amqp.Delivery) error {
+		if atomic.LoadInt32(&healthy) == 0 {
+			return rabbitmq.Permanent(errors.New("malformed"))
+		}
+		handled <- msg.MessageId
+		return nil
+	}))
+	for _, id := range []string{"order-1", "order-2"} {
+		require.NoError(t, broker.PublishWithConfirm(context.Background(), "orders.events", "created", amqp.Publishing{MessageId: id, Body: []byte(id)}))
+	}
+	require.Eventually(t, func() bool {
+		return len(broker.Messages(rabbitmq.DeadLetterQueueName("orders"))) == 2
+	}, time.Second, time.Millisecond)
+
+	letters, err := broker.PeekDeadLetters(context.Background(), "orders", 10)
+	require.NoError(t, err)
+	require.Len(t, letters, 2)
+	assert.Equal(t, "order-1", letters[0].MessageID)
+	assert.Equal(t, "orders.events", letters[0].Exchange)
+	assert.Equal(t, "created", letters[0].RoutingKey)
+	assert.Equal(t, "malformed", letters[0].Error)
+
+	// a failed publish keeps the dead letters
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = broker.ReplayDeadLetters(cancelled, "orders", nil)
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Len(t, broker.Messages(rabbitmq.DeadLetterQueueName("orders")), 2)
+
+	atomic.StoreInt32(&healthy, 1)
+	replayed, err := broker.ReplayDeadLetters(context.Background(), "orders", []string{"order-1"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, replayed)
+	select {
+	case id := <-handled:
+		assert.Equal(t, "order-1", id)
+	case <-time.After(time.Second):
+		t.Fatal("dead letter was not replayed")
+	}
+
+	purged, err := broker.PurgeDeadLetters(context.Background(), "orders", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	assert.Empty(t, broker.Messages(rabbitmq.DeadLetterQueueName("orders")))
+}
+
+func TestMemoryBrokerUnroutable(t *testing.T) {
+	broker := newTestBroker()
+	defer broker.Close()
+	require.NoError(t, broker.DeclareExchange("events", amqp.ExchangeTopic))
+
+	err := broker.PublishToExchange("events", "wallet.deposited", "{}")
+	assert.ErrorIs(t, err, rabbitmq.ErrUnroutable)
+}
+
+type fakeTestService struct {
+	updates int32
+	// failing makes UpdateTest fail while set
+	failing int32
+}
+
+func (s *fakeTestService) GetTestById(id uuid.UUID) (database.Test, error) {
+	return database.Test{ID: id}, nil
+}
+
+func (s *fakeTestService) CreateTest(req *database.CreateTestParams) (database.Test, error) {
+	return database.Test{Name: req.Name}, nil
+}
+
+// UpdateTest adds to the balance, applying a message twice shows in the count
+func (s *fakeTestService) UpdateTest(req *database.UpdateTestParams) (database.Test, error) {
+	if atomic.LoadInt32(&s.failing) == 1 {
+		return database.Test{}, errors.New("database is down")
+	}
+	count := atomic.AddInt32(&s.updates, 1)
+	return database.Test{ID: req.ID, Name: req.Name, Balance: sql.NullString{String: fmt.Sprint(count), Valid: true}}, nil
+}
+
+type fakeWalletService struct{}
+
+func (fakeWalletService) TakeInterest(ctx context.Context, userID string, providerKey string) ([]model.Transaction, error) {
+	return nil, nil
+}
+
+// memoryMessageRepository keeps the message guard state in memory instead of Redis
+type memoryMessageRepository struct {
+	mu        sync.Mutex
+	sequences map[string]int64
+	applied   map[string]int64
+	responses map[string]rabbitmq.QueueResponse
+	locks     map[string]string
+}
+
+func newMemoryMessageRepository() *memoryMessageRepository {
+	return &memoryMessageRepository{
+		sequences: make(map[string]int64),
+		applied:   make(map[string]int64),
+		responses: make(map[string]rabbitmq.QueueResponse),
+		locks:     make(map[string]string),
+	}
+}
+
+func (r *memoryMessageRepository) NextSequence(ctx context.Context, key string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sequences[key]++
+	return r.sequences[key], nil
+}
+
+func (r *memoryMessageRepository) AcquireKeyLock(ctx context.Context, key, token string, ttl time.Duration) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.locks[key]; ok {
+		return false, nil
+	}
+	r.locks[key] = token
+	return true, nil
+}
+
+func (r *memoryMessageRepository) ReleaseKeyLock(ctx context.Context, key, token string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.locks[key] == token {
+		delete(r.locks, key)
+	}
+	return nil
+}
+
+func (r *memoryMessageRepository) GetResponse(ctx context.Context, messageID string) (*rabbitmq.QueueResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	response, ok := r.responses[messageID]
+	if !ok {
+		return nil, nil
+	}
+	return &response, nil
+}
+
+func (r *memoryMessageRepository) GetAppliedSequence(ctx context.Context, key string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.applied[key], nil
+}
+
+func (r *memoryMessageRepository) SaveResult(ctx context.Context, messageID, key string, sequence int64, response rabbitmq.QueueResponse) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if messageID != "" {
+		r.responses[messageID] = response
+	}
+	if sequence > 0 {
+		r.applied[key] = sequence
+	}
+	return nil
+}
+
+// startConsumers runs ConsumeMessage on the test queue shards of an in-memory broker
+func startConsumers(t *testing.T, testService *fakeTestService, messageRepository *memoryMessageRepository) *rabbitmq.MemoryBroker {
+	broker := newTestBroker()
+	global.RabbitMQManager = broker
+	global.Config.Exchange.Test = "test.sharded"
+	global.Config.Queue.Test = "test:2"
+	require.NoError(t, broker.DeclareShardedExchange(rabbitmq.ShardedExchange{
+		Exchange: global.Config.Exchange.Test,
+		Queue:    global.Config.Queue.Test,
+	}))
+
+	consumeMessage := messaging.NewConsumeMessage(testService, fakeWalletService{}, messageRepository)
+	w := worker.NewWorker(broker, zap.NewNop(), worker.Options{ScaleInterval: time.Hour})
+	consumeMessage.RegisterConsumers(w)
+	ctx, cancel := context.WithCancel(context.Background())
+	go w.Start(ctx)
+	t.Cleanup(func() {
+		cancel()
+		broker.Close()
+	})
+	return broker
+}
+
+func TestConsumeMessageRepliesOnceForDuplicates(t *testing.T) {
+	testService := &fakeTestService{}
+	messageRepository := newMemoryMessageRepository()
+	broker := startConsumers(t, testService, messageRepository)
+
+	id := uuid.New()
+	message := messaging.BodyMessage{
+		Action: "update",
+		Data:   database.UpdateTestParams{ID: id, Name: "test"},
+		Key:    id.String(),
+	}
+	require.NoError(t, messaging.NewSequencer(messageRepository).Stamp(context.Background(), &message))
+	body, err := json.Marshal(message)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	first, err := broker.PublishToExchangeAndWait(ctx, global.Config.Exchange.Test, message.Key, string(body))
+	require.NoError(t, err)
+	second, err := broker.PublishToExchangeAndWait(ctx, global.Config.Exchange.Test, message.Key, string(body))
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, first.CodeResult)
+	assert.Equal(t, first, second)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&testService.updates))
+
+	var updated database.Test
+	require.NoError(t, first.Decode(&updated))
+	assert.Equal(t, "1", updated.Balance.String)
+}
+
+func TestConsumeMessageRejectsUnknownAction(t *testing.T) {
+	broker := startConsumers(t, &fakeTestService{}, newMemoryMessageRepository())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	response, err := broker.PublishToExchangeAndWait(ctx, global.Config.Exchange.Test, "user-1", `{"action":"unknown","user_id":"user-1"}`)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, response.CodeResult)
+	assert.Contains(t, response.Error, "unknown action")
+	// the reply is sent before the message is dead-lettered
+	dlq := rabbitmq.DeadLetterQueueName(fmt.Sprintf("test:%d", rabbitmq.ShardIndex("user-1", 2)))
+	assert.Eventually(t, func() bool {
+		return len(broker.Messages(dlq)) == 1
+	}, time.Second, time.Millisecond)
+}
+
+func TestConsumeMessageRunsReplayedDeadLetters(t *testing.T) {
+	testService := &fakeTestService{failing: 1}
+	messageRepository := newMemoryMessageRepository()
+	broker := startConsumers(t, testService, messageRepository)
+
+	id := uuid.New()
+	message := messaging.BodyMessage{
+		Action: "update",
+		Data:   database.UpdateTestParams{ID: id, Name: "test"},
+		Key:    id.String(),
+	}
+	require.NoError(t, messaging.NewSequencer(messageRepository).Stamp(context.Background(), &message))
+	body, err := json.Marshal(message)
+	require.NoError(t, err)
+	require.NoError(t, broker.PublishWithConfirm(context.Background(), global.Config.Exchange.Test, message.Key, amqp.Publishing{Body: body}))
+
+	queue := fmt.Sprintf("test:%d", rabbitmq.ShardIndex(message.Key, 2))
+	require.Eventually(t, func() bool {
+		return len(broker.Messages(rabbitmq.DeadLetterQueueName(queue))) == 1
+	}, time.Second, time.Millisecond)
+	// the last attempt stored its result and moved the key on
+	stored, err := messageRepository.GetResponse(context.Background(), message.MessageID)
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+	applied, err := messageRepository.GetAppliedSequence(context.Background(), message.Key)
+	require.NoError(t, err)
+	require.Equal(t, message.Sequence, applied)
+
+	atomic.StoreInt32(&testService.failing, 0)
+	replayed, err := broker.ReplayDeadLetters(context.Background(), queue, nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, replayed)
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&testService.updates) == 1
+	}, time.Second, time.Millisecond)
+
+	// the replay leaves the sequence of the key alone, the next message of the key still runs
+	applied, err = messageRepository.GetAppliedSequence(context.Background(), message.Key)
+	require.NoError(t, err)
+	assert.Equal(t, message.Sequence, applied)
+	next := messaging.BodyMessage{
+		Action: "update",
+		Data:   database.UpdateTestParams{ID: id, Name: "next"},
+		Key:    id.String(),
+	}
+	require.NoError(t, messaging.NewSequencer(messageRepository).Stamp(context.Background(), &next))
+	body, err = json.Marshal(next)
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	response, err := broker.PublishToExchangeAndWait(ctx, global.Config.Exchange.Test, next.Key, string(body))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.CodeResult)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&testService.updates))
+}
+
+func TestEventRouterDispatchesSchemaVersionsSideBySide(t *testing.T) {
+	router := messaging.NewEventRouter()
+	router.RegisterEventHandler("rename", messaging.Handle(func(ctx context.Context, msg messaging.Message, data *struct{ Name string }) (interface{}, error) {
+		return "v1 " + data.Name, nil
+	}))
+	router.RegisterEventHandlerVersion("rename", 2, messaging.Handle(func(ctx context.Context, msg messaging.Message, data *struct{ FirstName, LastName string }) (interface{}, error) {
+		return fmt.Sprintf("v%d %s %s", msg.Envelope.SchemaVersion, data.FirstName, data.LastName), nil
+	}))
+
+	legacy := amqp.Delivery{ContentType: rabbitmq.ContentTypeText, Body: []byte(`{"action":"rename","data":{"Name":"alice"}}`)}
+	response, err := router.Dispatch(context.Background(), legacy)
+	require.NoError(t, err)
+	var result string
+	require.NoError(t, response.Decode(&result))
+	assert.Equal(t, "v1 alice", result)
+
+	body, err := rabbitmq.ProtoCodec.Marshal(map[string]interface{}{
+		"data": map[string]string{"FirstName": "alice", "LastName": "smith"},
+	})
+	require.NoError(t, err)
+	msg := amqp.Publishing{ContentType: rabbitmq.ContentTypeProtobuf, Body: body}
+	envelope := rabbitmq.Envelope{SchemaVersion: 2, EventType: "rename", Producer: "tests"}.Apply(&msg)
+	response, err = router.Dispatch(context.Background(), amqp.Delivery{
+		Headers:     msg.Headers,
+		ContentType: msg.ContentType,
+		MessageId:   msg.MessageId,
+		Body:        msg.Body,
+	})
+	require.NoError(t, err)
+	require.NoError(t, response.Decode(&result))
+	assert.Equal(t, "v2 alice smith", result)
+	assert.NotEmpty(t, envelope.MessageID)
+}
+
+func TestPublishMessageWithProtobufCodec(t *testing.T) {
+	testService := &fakeTestService{}
+	startConsumers(t, testService, newMemoryMessageRepository())
+	global.Config.Messaging.Codec = "protobuf"
+	defer func() { global.Config.Messaging.Codec = "" }()
+
+	id := uuid.New()
+	err := messaging.PublishMessage(context.Background(), global.Config.Exchange.Test, messaging.BodyMessage{
+		Action:    "update",
+		Data:      database.UpdateTestParams{ID: id, Name: "test"},
+		Key:       id.String(),
+		MessageID: uuid.NewString(),
+	}, rabbitmq.Envelope{TraceID: "trace-1"})
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&testService.updates) == 1
+	}, time.Second, time.Millisecond)
+}
+
+func TestMemoryBrokerCancelsScheduledMessages(t *testing.T) {
+	broker := newTestBroker()
+	defer broker.Close()
+	require.NoError(t, broker.DeclareQueue("reminders"))
+
+	received := make(chan string, 2)
+	require.NoError(t, broker.Consume("reminders", func(msg amqp.Delivery) error {
+		received <- string(msg.Body)
+		return nil
+	}))
+	_, err := broker.PublishDelayed("", "reminders", "due", 50*time.Millisecond)
+	require.NoError(t, err)
+	cancelled, err := broker.PublishAt("", "reminders", "cancelled", time.Now().Add(20*time.Millisecond))
+	require.NoError(t, err)
+	require.NoError(t, broker.CancelScheduled(context.Background(), cancelled))
+
+	select {
+	case body := <-received:
+		assert.Equal(t, "due", body)
+	case <-time.After(time.Second):
+		t.Fatal("scheduled message was not published")
+	}
+	assert.ErrorIs(t, broker.CancelScheduled(context.Background(), cancelled), rabbitmq.ErrScheduleNotFound)
+	assert.Empty(t, received)
+}
@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ecom/internal/middlewares"
+	"ecom/internal/model"
+	"ecom/internal/service"
+	consts "ecom/pkg/const"
+	"ecom/pkg/response"
+	"ecom/pkg/token"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestPolicyRequiresRolesAndScopes(t *testing.T) {
+	policy := middlewares.Policy{Roles: []string{"support", "finance"}, Scopes: []string{"queues:read", "queues:write"}}
+
+	assert.False(t, policy.Allows(nil))
+	assert.False(t, policy.Allows(&token.Claims{Roles: []string{"support"}, Scope: "queues:read"}))
+	assert.False(t, policy.Allows(&token.Claims{Roles: []string{"other"}, Scope: "queues:read queues:write"}))
+	assert.True(t, policy.Allows(&token.Claims{Roles: []string{"finance"}, Scope: "openid queues:write queues:read"}))
+	assert.True(t, policy.Allows(&token.Claims{Roles: []string{consts.RoleAdmin}}))
+	assert.True(t, middlewares.Policy{}.Allows(&token.Claims{}))
+}
+
+func TestAuthorizeDeniesWithForbiddenEnvelope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middlewares.ErrorHandlerMiddleware(), func(c *gin.Context) {
+		c.Set(middlewares.ContextKeyClaims, &token.Claims{Scope: c.GetHeader("X-Scope")})
+	})
+	r.GET("/queues", middlewares.Authorize(middlewares.Policy{Scopes: []string{consts.ScopeQueuesRead}}), func(c *gin.Context) {
+		response.SuccessResponse(c, response.Success, nil)
+	})
+
+	serve := func(scope string) (int, response.ResponseData) {
+		req := httptest.NewRequest(http.MethodGet, "/queues", nil)
+		req.Header.Set("X-Scope", scope)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var body response.ResponseData
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return w.Code, body
+	}
+
+	status, body := serve(consts.ScopeQueuesRead)
+	assert.Equal(t, http.StatusOK, status)
+	assert.True(t, body.Success)
+
+	status, body = serve(consts.ScopeDeposit)
+	assert.Equal(t, http.StatusForbidden, status)
+	assert.Equal(t, response.ResponseData{Code: response.Forbidden, Message: "Forbidden", ErrorCode: response.ErrorCodeForbidden}, body)
+}
+
+type fakeProjectRepository struct {
+	projects map[string]model.Project
+}
+
+func (r *fakeProjectRepository) GetProjectByWalletIntegration(int32) (model.Project, error) {
+	return model.Project{}, gorm.ErrRecordNotFound
+}
+
+func (r *fakeProjectRepository) GetProjectBySlug(slug string) (model.Project, error) {
+	project, ok := r.projects[slug]
+	if !ok {
+		return model.Project{}, gorm.ErrRecordNotFound
+	}
+	return project, nil
+}
+
+type fakeProjectMemberRepository struct {
+	members map[int32][]string
+}
+
+func (r *fakeProjectMemberRepository) IsProjectMember(projectID int32, userID string) (bool, error) {
+	for _, member := range r.members[projectID] {
+		if member == userID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func TestProjectServiceChecksMembership(t *testing.T) {
+	projectService := service.NewProjectService(
+		&fakeProjectRepository{projects: map[string]model.Project{"alpha": {ID: 1, Slug: "alpha"}, "beta": {ID: 2, Slug: "beta"}}},
+		&fakeProjectMemberRepository{members: map[int32][]string{1: {"user-1"}}},
+	)
+	member := &token.Claims{}
+	member.Subject = "user-1"
+	admin := &token.Claims{Roles: []string{consts.RoleAdmin}}
+	admin.Subject = "user-2"
+
+	ctx := context.Background()
+	assert.NoError(t, projectService.AuthorizeProject(ctx, "alpha", member))
+	assert.ErrorIs(t, projectService.AuthorizeProject(ctx, "beta", member), service.ErrProjectAccessDenied)
+	assert.ErrorIs(t, projectService.AuthorizeProject(ctx, "unknown", member), service.ErrProjectAccessDenied)
+	assert.ErrorIs(t, projectService.AuthorizeProject(ctx, "alpha", nil), service.ErrProjectAccessDenied)
+	assert.NoError(t, projectService.AuthorizeProject(ctx, "beta", admin))
+}
@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ecom/internal/controller"
+	"ecom/internal/middlewares"
+	"ecom/internal/service"
+	"ecom/internal/vo"
+	"ecom/pkg/rabbitmq"
+	"ecom/pkg/token"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeQueueService records the operator and the message ids of the last purge
+type fakeQueueService struct {
+	operator   string
+	messageIDs []string
+	purged     bool
+}
+
+func (s *fakeQueueService) ListQueues(ctx context.Context, operator string) ([]vo.QueueInfo, error) {
+	return nil, nil
+}
+
+func (s *fakeQueueService) PeekDeadLetters(ctx context.Context, operator, queueName string, limit int) ([]rabbitmq.DeadLetter, error) {
+	return nil, nil
+}
+
+func (s *fakeQueueService) ReplayDeadLetters(ctx context.Context, operator, queueName string, messageIDs []string) (int, error) {
+	return 0, nil
+}
+
+func (s *fakeQueueService) PurgeDeadLetters(ctx context.Context, operator, queueName string, messageIDs []string) (int, error) {
+	if operator == "" {
+		return 0, service.ErrMissingOperator
+	}
+	s.operator, s.messageIDs, s.purged = operator, messageIDs, true
+	return len(messageIDs), nil
+}
+
+func TestPurgeDeadLettersRequiresASelectionAndAnOperator(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	queueService := &fakeQueueService{}
+	r := gin.New()
+	r.Use(middlewares.ErrorHandlerMiddleware(), func(c *gin.Context) {
+		if subject := c.GetHeader("X-Subject"); subject != "" {
+			c.Set(middlewares.ContextKeyClaims, &token.Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: subject}})
+		}
+	})
+	r.POST("/queues/:name/dlq/purge", controller.NewQueueController(queueService).PurgeDeadLetters)
+
+	serve := func(subject, body string, chunked bool) int {
+		req := httptest.NewRequest(http.MethodPost, "/queues/orders/dlq/purge", strings.NewReader(body))
+		if chunked {
+			req.ContentLength = -1
+		}
+		req.Header.Set("X-Subject", subject)
+		// a client supplied operator is ignored
+		req.Header.Set("X-Operator", "mallory")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for name, body := range map[string]string{
+		"empty body":        "",
+		"empty selection":   `{}`,
+		"no message ids":    `{"messageIds": []}`,
+		"ids and all":       `{"messageIds": ["m-1"], "all": true}`,
+		"all set to false":  `{"all": false}`,
+		"malformed request": `{"messageIds":`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, serve("user-1", body, false), name)
+	}
+	assert.Equal(t, http.StatusBadRequest, serve("user-1", "", true), "chunked empty body")
+	assert.False(t, queueService.purged)
+
+	assert.Equal(t, http.StatusUnauthorized, serve("", `{"all": true}`, false))
+	assert.False(t, queueService.purged)
+
+	assert.Equal(t, http.StatusOK, serve("user-1", `{"messageIds": ["m-1", "m-2"]}`, false))
+	assert.Equal(t, "user-1", queueService.operator)
+	assert.Equal(t, []string{"m-1", "m-2"}, queueService.messageIDs)
+
+	assert.Equal(t, http.StatusOK, serve("user-2", `{"all": true}`, true))
+	assert.Equal(t, "user-2", queueService.operator)
+	assert.Empty(t, queueService.messageIDs)
+}
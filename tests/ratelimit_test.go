@@ -0,0 +1,189 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ecom/global"
+	"ecom/internal/middlewares"
+	"ecom/pkg/logger"
+	"ecom/pkg/ratelimit"
+	"ecom/pkg/response"
+	"ecom/pkg/setting"
+	"ecom/pkg/token"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func assertLimiterAllowsBurst(t *testing.T, limiter ratelimit.Limiter) {
+	ctx := context.Background()
+	limit := ratelimit.Limit{Rate: 3, Period: time.Minute}
+
+	for remaining := 2; remaining >= 0; remaining-- {
+		res, err := limiter.Allow(ctx, "user-1", limit)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, remaining, res.Remaining)
+	}
+
+	res, err := limiter.Allow(ctx, "user-1", limit)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+	assert.InDelta(t, 20*time.Second, res.RetryAfter, float64(time.Second))
+	assert.InDelta(t, time.Minute, res.ResetAfter, float64(time.Second))
+
+	res, err = limiter.Allow(ctx, "user-2", limit)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+}
+
+func TestMemoryLimiterAllowsBurst(t *testing.T) {
+	assertLimiterAllowsBurst(t, ratelimit.NewMemoryLimiter())
+}
+
+func TestRedisLimiterAllowsBurst(t *testing.T) {
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	assertLimiterAllowsBurst(t, ratelimit.NewRedisLimiter(rdb))
+
+	// a second instance shares the quota
+	res, err := ratelimit.NewRedisLimiter(rdb).Allow(context.Background(), "user-1", ratelimit.Limit{Rate: 3, Period: time.Minute})
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+}
+
+func TestFallbackLimiterUsesMemoryWithoutRedis(t *testing.T) {
+	server := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+	server.Close()
+
+	var failures []error
+	limiter := ratelimit.NewFallbackLimiter(ratelimit.NewRedisLimiter(rdb), ratelimit.NewMemoryLimiter(), time.Minute, func(err error) {
+		failures = append(failures, err)
+	})
+	assertLimiterAllowsBurst(t, limiter)
+	assert.Len(t, failures, 1)
+}
+
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(context.Context, string, ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("unavailable")
+}
+
+// flakyLimiter counts its calls and fails while down is set
+type flakyLimiter struct {
+	calls int
+	down  bool
+}
+
+func (l *flakyLimiter) Allow(context.Context, string, ratelimit.Limit) (ratelimit.Result, error) {
+	l.calls++
+	if l.down {
+		return ratelimit.Result{}, errors.New("unavailable")
+	}
+	return ratelimit.Result{Allowed: true}, nil
+}
+
+func TestFallbackLimiterLeavesPrimaryAloneDuringCooldown(t *testing.T) {
+	primary := &flakyLimiter{down: true}
+	failures := 0
+	limiter := ratelimit.NewFallbackLimiter(primary, ratelimit.NewMemoryLimiter(), 50*time.Millisecond, func(error) { failures++ })
+	allow := func() {
+		_, err := limiter.Allow(context.Background(), "user-1", ratelimit.Limit{Rate: 100, Period: time.Minute})
+		require.NoError(t, err)
+	}
+
+	for i := 0; i < 5; i++ {
+		allow()
+	}
+	assert.Equal(t, 1, primary.calls)
+
+	// one request tries primary again once the cooldown is over
+	time.Sleep(60 * time.Millisecond)
+	allow()
+	allow()
+	assert.Equal(t, 2, primary.calls)
+	assert.Equal(t, 1, failures)
+
+	primary.down = false
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		allow()
+	}
+	assert.Equal(t, 5, primary.calls)
+}
+
+func TestRateLimitMiddlewareSetsHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	global.Config.RateLimit = setting.RateLimitSetting{Rules: []setting.RateLimitRule{
+		{Name: "global", By: []string{"ip"}, Limit: 10, PeriodSec: 60},
+		{Name: "money", Routes: []string{"/deposit"}, By: []string{"user", "project"}, Limit: 2, PeriodSec: 60},
+	}}
+	defer func() { global.Config.RateLimit = setting.RateLimitSetting{} }()
+	global.RateLimiter = ratelimit.NewMemoryLimiter()
+
+	r := gin.New()
+	r.Use(middlewares.ErrorHandlerMiddleware(), func(c *gin.Context) {
+		c.Set(middlewares.ContextKeyUserID, c.GetHeader("X-User"))
+		if project := c.GetHeader("X-Project"); project != "" {
+			c.Set(middlewares.ContextKeyClaims, &token.Claims{Project: project})
+		}
+	}, middlewares.RateLimitMiddleware())
+	r.POST("/deposit", func(c *gin.Context) { response.SuccessResponse(c, response.Success, nil) })
+	r.GET("/status", func(c *gin.Context) { response.SuccessResponse(c, response.Success, nil) })
+
+	serve := func(method, path, user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("X-User", user)
+		req.Header.Set("X-Project", "alpha")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve(http.MethodPost, "/deposit", "user-1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "30", w.Header().Get("RateLimit-Reset"))
+
+	serve(http.MethodPost, "/deposit", "user-1")
+	w = serve(http.MethodPost, "/deposit", "user-1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	var body response.ResponseData
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, response.TooManyRequests, body.Code)
+
+	// the money quota is per user, the global one still has room
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "/deposit", "user-2").Code)
+	w = serve(http.MethodGet, "/status", "user-1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "10", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "5", w.Header().Get("RateLimit-Remaining"))
+
+	// the money rule needs the project of the token, a client supplied one is not trusted
+	req := httptest.NewRequest(http.MethodPost, "/deposit", nil)
+	req.Header.Set("X-User", "user-1")
+	req.Header.Set("X-Project-Key", "beta")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "10", w.Header().Get("RateLimit-Limit"))
+
+	// requests go through when the limiter fails
+	global.RateLimiter = failingLimiter{}
+	global.Logger = &logger.LoggerZap{Logger: zap.NewNop()}
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/status", "user-1").Code)
+}
@@ -0,0 +1,201 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ecom/pkg/rabbitmq"
+	"ecom/pkg/redisstream"
+
+	"github.com/alicebob/miniredis/v2"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newStreamBroker(t *testing.T) (*redisstream.Broker, *redis.Client) {
+	server := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	options := rabbitmq.DefaultConsumerOptions()
+	options.MaxRetries = 2
+	options.RetryBaseDelay = 10 * time.Millisecond
+	broker := redisstream.NewBroker(rdb, options, "", 0)
+	t.Cleanup(func() {
+		broker.Close()
+		rdb.Close()
+	})
+	return broker, rdb
+}
+
+func TestStreamBrokerReclaimsThenDeadLetters(t *testing.T) {
+	broker, rdb := newStreamBroker(t)
+	require.NoError(t, broker.DeclareQueue("orders"))
+
+	var calls int32
+	retries := make(chan int, 3)
+	require.NoError(t, broker.Consume("orders", func(msg amqp.Delivery) error {
+		atomic.AddInt32(&calls, 1)
+		retries <- rabbitmq.RetryCount(msg)
+		return errors.New("service unavailable")
+	}))
+	require.NoError(t, broker.PublishToExchange("", "orders", "order"))
+
+	require.Eventually(t, func() bool {
+		n, _ := rdb.XLen(context.Background(), "stream:"+rabbitmq.DeadLetterQueueName("orders")).Result()
+		return n == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	assert.Equal(t, []int{0, 1, 2}, []int{<-retries, <-retries, <-retries})
+
+	dead, err := rdb.XRange(context.Background(), "stream:"+rabbitmq.DeadLetterQueueName("orders"), "-", "+").Result()
+	require.NoError(t, err)
+	assert.Equal(t, "order", dead[0].Values["body"])
+	assert.Contains(t, dead[0].Values["headers"], "service unavailable")
+
+	depth, _, err := broker.QueueDepth("orders")
+	require.NoError(t, err)
+	assert.Equal(t, 0, depth)
+}
+
+func TestStreamBrokerBacksOffBetweenRetries(t *testing.T) {
+	server := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	options := rabbitmq.DefaultConsumerOptions()
+	options.MaxRetries = 2
+	options.RetryBaseDelay = 600 * time.Millisecond
+	broker := redisstream.NewBroker(rdb, options, "", 0)
+	t.Cleanup(func() {
+		broker.Close()
+		rdb.Close()
+	})
+	require.NoError(t, broker.DeclareQueue("orders"))
+
+	attempts := make(chan time.Time, 3)
+	require.NoError(t, broker.Consume("orders", func(msg amqp.Delivery) error {
+		attempts <- time.Now()
+		return errors.New("service unavailable")
+	}))
+	require.NoError(t, broker.PublishToExchange("", "orders", "order"))
+
+	var at []time.Time
+	for len(at) < 3 {
+		select {
+		case attempt := <-attempts:
+			at = append(at, attempt)
+		case <-time.After(10 * time.Second):
+			t.Fatalf("got %d attempts, want 3", len(at))
+		}
+	}
+	for retry := 1; retry < len(at); retry++ {
+		delay := rabbitmq.RetryDelay(retry, options.RetryBaseDelay, options.RetryMaxDelay)
+		assert.GreaterOrEqual(t, at[retry].Sub(at[retry-1]), delay, "retry %d", retry)
+	}
+}
+
+func TestStreamBrokerReplaysDeadLetters(t *testing.T) {
+	broker, _ := newStreamBroker(t)
+	require.NoError(t, broker.ApplyTopology(rabbitmq.Topology{
+		Exchanges: []rabbitmq.ExchangeSpec{{Name: "orders.events", Kind: amqp.ExchangeDirect}},
+		Queues:    []rabbitmq.QueueSpec{{Name: "orders"}},
+		Bindings:  []rabbitmq.BindingSpec{{Queue: "orders", Exchange: "orders.events", RoutingKey: "created"}},
+	}))
+
+	var healthy int32
+	handled := make(chan string, 1)
+	require.NoError(t, broker.Consume("orders", func(msg amqp.Delivery) error {
+		if atomic.LoadInt32(&healthy) == 0 {
+			return rabbitmq.Permanent(errors.New("malformed"))
+		}
+		handled <- string(msg.Body)
+		return nil
+	}))
+	require.NoError(t, broker.PublishToExchange("orders.events", "created", "order"))
+
+	var letters []rabbitmq.DeadLetter
+	require.Eventually(t, func() bool {
+		letters, _ = broker.PeekDeadLetters(context.Background(), "orders", 10)
+		return len(letters) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "orders.events", letters[0].Exchange)
+	assert.Equal(t, "created", letters[0].RoutingKey)
+
+	atomic.StoreInt32(&healthy, 1)
+	replayed, err := broker.ReplayDeadLetters(context.Background(), "orders", []string{letters[0].MessageID})
+	require.NoError(t, err)
+	assert.Equal(t, 1, replayed)
+	select {
+	case body := <-handled:
+		assert.Equal(t, "order", body)
+	case <-time.After(5 * time.Second):
+		t.Fatal("dead letter was not replayed")
+	}
+	letters, err = broker.PeekDeadLetters(context.Background(), "orders", 10)
+	require.NoError(t, err)
+	assert.Empty(t, letters)
+}
+
+func TestStreamBrokerRepliesThroughRPC(t *testing.T) {
+	broker, _ := newStreamBroker(t)
+	require.NoError(t, broker.DeclareShardedExchange(rabbitmq.ShardedExchange{
+		Exchange: "test.sharded",
+		Queue:    "test:2",
+		Mode:     rabbitmq.ShardByClient,
+	}))
+	for _, queue := range []string{"test:0", "test:1"} {
+		require.NoError(t, broker.Consume(queue, func(msg amqp.Delivery) error {
+			body, err := json.Marshal(rabbitmq.QueueResponse{CodeResult: http.StatusOK, Error: string(msg.Body)})
+			if err != nil {
+				return err
+			}
+			return broker.Publish("", msg.ReplyTo, amqp.Publishing{CorrelationId: msg.CorrelationId, Body: body})
+		}))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	response, err := broker.PublishToExchangeAndWait(ctx, "test.sharded", "user-1", "ping")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.CodeResult)
+	assert.Equal(t, "ping", response.Error)
+
+	_, err = broker.PublishToExchangeAndWait(ctx, "missing", "user-1", "ping")
+	assert.Error(t, err)
+}
+
+func TestStreamBrokerPublishesScheduledMessages(t *testing.T) {
+	broker, _ := newStreamBroker(t)
+	require.NoError(t, broker.DeclareQueue("reminders"))
+
+	received := make(chan string, 2)
+	require.NoError(t, broker.Consume("reminders", func(msg amqp.Delivery) error {
+		received <- string(msg.Body)
+		return nil
+	}))
+
+	start := time.Now()
+	_, err := broker.PublishDelayed("", "reminders", "due", 300*time.Millisecond)
+	require.NoError(t, err)
+	cancelled, err := broker.PublishDelayed("", "reminders", "cancelled", 200*time.Millisecond)
+	require.NoError(t, err)
+	require.NoError(t, broker.CancelScheduled(context.Background(), cancelled))
+	assert.ErrorIs(t, broker.CancelScheduled(context.Background(), cancelled), rabbitmq.ErrScheduleNotFound)
+
+	select {
+	case body := <-received:
+		assert.Equal(t, "due", body)
+		assert.GreaterOrEqual(t, time.Since(start), 300*time.Millisecond)
+	case <-time.After(5 * time.Second):
+		t.Fatal("scheduled message was not published")
+	}
+	select {
+	case body := <-received:
+		t.Fatalf("cancelled message %q was published", body)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
@@ -0,0 +1,297 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"ecom/global"
+	"ecom/internal/messaging"
+	"ecom/internal/model"
+	"ecom/internal/repo"
+	consts "ecom/pkg/const"
+	"ecom/pkg/rabbitmq"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestSagaOrchestratorRejectsUnknownSagas(t *testing.T) {
+	orchestrator := messaging.NewSagaOrchestrator(nil, nil)
+
+	_, err := orchestrator.Begin(context.Background(), "unknown", "ref-1", nil)
+	assert.ErrorIs(t, err, messaging.ErrUnknownSaga)
+
+	orchestrator.Register(messaging.SagaDefinition{Type: "empty"})
+	_, err = orchestrator.Begin(context.Background(), "empty", "ref-1", nil)
+	assert.Error(t, err)
+}
+
+func TestSagaContextKeepsUpdatedData(t *testing.T) {
+	saga := &messaging.SagaContext{}
+	require.NoError(t, saga.Update(map[string]string{"transactionId": "tx-1"}))
+
+	var data map[string]string
+	require.NoError(t, saga.Decode(&data))
+	assert.Equal(t, "tx-1", data["transactionId"])
+}
+
+// openSagaDB points the core database at an in-memory SQLite holding the saga and outbox tables
+func openSagaDB(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	require.NoError(t, db.Exec(`CREATE TABLE sagas (
+		id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(16)))),
+		saga_type TEXT NOT NULL,
+		reference TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'running',
+		step INTEGER NOT NULL DEFAULT 0,
+		data TEXT NOT NULL,
+		last_error TEXT,
+		timeout_at DATETIME NOT NULL,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL
+	)`).Error)
+	require.NoError(t, db.Exec(`CREATE TABLE outbox_events (
+		id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(16)))),
+		exchange TEXT NOT NULL,
+		routing_key TEXT NOT NULL,
+		message_id TEXT NOT NULL UNIQUE,
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT,
+		available_at DATETIME NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		sent_at DATETIME
+	)`).Error)
+	global.Pdb = db
+}
+
+// sagaRecorder is a saga definition whose steps record their calls, failing the steps named in fail
+type sagaRecorder struct {
+	calls []string
+	fail  map[string]error
+	// finished is the saga handed to OnFinish
+	finished *messaging.SagaContext
+}
+
+func (r *sagaRecorder) step(name string, compensate, pivot bool) messaging.SagaStep {
+	step := messaging.SagaStep{
+		Name: name,
+		Action: func(ctx context.Context, saga *messaging.SagaContext) error {
+			r.calls = append(r.calls, name)
+			if pivot && saga.Tx != nil {
+				return errors.New("pivot ran in the saga transaction")
+			}
+			return r.fail[name]
+		},
+		Pivot: pivot,
+	}
+	if compensate {
+		step.Compensate = func(ctx context.Context, saga *messaging.SagaContext) error {
+			r.calls = append(r.calls, "undo "+name)
+			return nil
+		}
+	}
+	return step
+}
+
+func (r *sagaRecorder) definition(sagaType string, steps ...messaging.SagaStep) messaging.SagaDefinition {
+	return messaging.SagaDefinition{
+		Type:  sagaType,
+		Steps: steps,
+		OnFinish: func(ctx context.Context, saga *messaging.SagaContext) error {
+			r.finished = saga
+			return nil
+		},
+	}
+}
+
+// takeSagaCommands returns the saga commands written to the outbox since the last call
+func takeSagaCommands(t *testing.T) []messaging.SagaCommand {
+	var events []model.OutboxEvent
+	require.NoError(t, global.Pdb.Order("created_at, rowid").Find(&events).Error)
+	require.NoError(t, global.Pdb.Where("1 = 1").Delete(&model.OutboxEvent{}).Error)
+	commands := make([]messaging.SagaCommand, 0, len(events))
+	for _, event := range events {
+		assert.Equal(t, consts.SagaQueueName, event.RoutingKey)
+		var command messaging.SagaCommand
+		require.NoError(t, json.Unmarshal(event.Payload, &command))
+		commands = append(commands, command)
+	}
+	return commands
+}
+
+// runSaga executes the saga commands until none is left
+func runSaga(t *testing.T, orchestrator *messaging.SagaOrchestrator) {
+	for commands := takeSagaCommands(t); len(commands) > 0; commands = takeSagaCommands(t) {
+		for _, command := range commands {
+			require.NoError(t, orchestrator.Execute(context.Background(), command, true))
+		}
+	}
+}
+
+func sagaRow(t *testing.T, id string) model.Saga {
+	row, err := repo.NewSagaRepository().GetSaga(id)
+	require.NoError(t, err)
+	return row
+}
+
+func newTestSagaOrchestrator(t *testing.T) *messaging.SagaOrchestrator {
+	openSagaDB(t)
+	return messaging.NewSagaOrchestrator(repo.NewSagaRepository(), repo.NewOutboxRepository())
+}
+
+func TestSagaAdvancesThroughItsSteps(t *testing.T) {
+	orchestrator := newTestSagaOrchestrator(t)
+	recorder := &sagaRecorder{}
+	orchestrator.Register(recorder.definition("order",
+		recorder.step("reserve", true, false),
+		recorder.step("pay", false, true),
+		recorder.step("ship", false, false),
+	))
+
+	saga, err := orchestrator.Begin(context.Background(), "order", "ref-1", map[string]string{"id": "1"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"reserve"}, recorder.calls)
+
+	commands := takeSagaCommands(t)
+	assert.Equal(t, []messaging.SagaCommand{{SagaID: saga.ID, Step: 1}}, commands)
+	require.NoError(t, orchestrator.Execute(context.Background(), commands[0], false))
+	assert.Equal(t, int32(2), sagaRow(t, saga.ID).Step)
+
+	runSaga(t, orchestrator)
+	assert.Equal(t, []string{"reserve", "pay", "ship"}, recorder.calls)
+	assert.Equal(t, consts.SagaStatusCompleted, sagaRow(t, saga.ID).Status)
+	require.NotNil(t, recorder.finished)
+	assert.Equal(t, consts.SagaStatusCompleted, recorder.finished.Status)
+}
+
+func TestSagaCompensatesCompletedStepsInReverseOrder(t *testing.T) {
+	orchestrator := newTestSagaOrchestrator(t)
+	recorder := &sagaRecorder{fail: map[string]error{"pay": errors.New("card declined")}}
+	orchestrator.Register(recorder.definition("order",
+		recorder.step("reserve", true, false),
+		recorder.step("notify", false, false),
+		recorder.step("charge_fee", true, false),
+		recorder.step("pay", false, true),
+	))
+
+	saga, err := orchestrator.Begin(context.Background(), "order", "ref-1", nil)
+	require.NoError(t, err)
+	// a retried failure is left to the next delivery
+	require.NoError(t, orchestrator.Execute(context.Background(), takeSagaCommands(t)[0], false))
+	require.NoError(t, orchestrator.Execute(context.Background(), takeSagaCommands(t)[0], false))
+	command := takeSagaCommands(t)[0]
+	assert.Error(t, orchestrator.Execute(context.Background(), command, false))
+	assert.Equal(t, consts.SagaStatusRunning, sagaRow(t, saga.ID).Status)
+
+	require.NoError(t, orchestrator.Execute(context.Background(), command, true))
+	runSaga(t, orchestrator)
+
+	assert.Equal(t, []string{"reserve", "notify", "charge_fee", "pay", "pay", "undo charge_fee", "undo reserve"}, recorder.calls)
+	row := sagaRow(t, saga.ID)
+	assert.Equal(t, consts.SagaStatusCompensated, row.Status)
+	assert.Equal(t, "pay: card declined", row.LastError)
+	assert.False(t, recorder.finished.Committed)
+}
+
+func TestSagaDoesNotCompensatePastItsPivot(t *testing.T) {
+	orchestrator := newTestSagaOrchestrator(t)
+	recorder := &sagaRecorder{fail: map[string]error{"complete": rabbitmq.Permanent(errors.New("db down"))}}
+	orchestrator.Register(recorder.definition("withdraw",
+		recorder.step("reserve", true, false),
+		recorder.step("payout", false, true),
+		recorder.step("complete", false, false),
+	))
+
+	saga, err := orchestrator.Begin(context.Background(), "withdraw", "ref-1", nil)
+	require.NoError(t, err)
+	runSaga(t, orchestrator)
+
+	assert.Equal(t, []string{"reserve", "payout", "complete"}, recorder.calls)
+	row := sagaRow(t, saga.ID)
+	assert.Equal(t, consts.SagaStatusFailed, row.Status)
+	assert.Equal(t, "complete: db down", row.LastError)
+	require.NotNil(t, recorder.finished)
+	assert.True(t, recorder.finished.Committed)
+}
+
+func TestSagaDropsStaleAndDuplicateCommands(t *testing.T) {
+	orchestrator := newTestSagaOrchestrator(t)
+	recorder := &sagaRecorder{}
+	orchestrator.Register(recorder.definition("order",
+		recorder.step("reserve", true, false),
+		recorder.step("pay", false, true),
+		recorder.step("ship", false, false),
+	))
+
+	saga, err := orchestrator.Begin(context.Background(), "order", "ref-1", nil)
+	require.NoError(t, err)
+	command := takeSagaCommands(t)[0]
+	require.NoError(t, orchestrator.Execute(context.Background(), command, false))
+	// delivered twice
+	require.NoError(t, orchestrator.Execute(context.Background(), command, false))
+	// a compensation the saga does not wait for
+	require.NoError(t, orchestrator.Execute(context.Background(), messaging.SagaCommand{SagaID: saga.ID, Step: 0, Compensate: true}, true))
+
+	assert.Equal(t, []string{"reserve", "pay"}, recorder.calls)
+	assert.Len(t, takeSagaCommands(t), 1)
+	row := sagaRow(t, saga.ID)
+	assert.Equal(t, consts.SagaStatusRunning, row.Status)
+	assert.Equal(t, int32(2), row.Step)
+
+	err = orchestrator.Execute(context.Background(), messaging.SagaCommand{SagaID: "missing", Step: 1}, false)
+	assert.True(t, rabbitmq.IsPermanent(err))
+}
+
+func TestSagaSweepCompensatesTimedOutSagasBeforeTheirPivot(t *testing.T) {
+	orchestrator := newTestSagaOrchestrator(t)
+	recorder := &sagaRecorder{}
+	definition := recorder.definition("order",
+		recorder.step("reserve", true, false),
+		recorder.step("charge_fee", true, false),
+		recorder.step("payout", false, true),
+		recorder.step("complete", false, false),
+	)
+	definition.Timeout = time.Nanosecond
+	orchestrator.Register(definition)
+
+	before, err := orchestrator.Begin(context.Background(), "order", "ref-1", nil)
+	require.NoError(t, err)
+	takeSagaCommands(t)
+
+	atPivot, err := orchestrator.Begin(context.Background(), "order", "ref-2", nil)
+	require.NoError(t, err)
+	require.NoError(t, orchestrator.Execute(context.Background(), takeSagaCommands(t)[0], false))
+	pending := takeSagaCommands(t)
+	require.Len(t, pending, 1)
+	assert.Equal(t, 2, pending[0].Step)
+
+	time.Sleep(time.Millisecond)
+	require.NoError(t, orchestrator.Sweep(context.Background()))
+	runSaga(t, orchestrator)
+
+	row := sagaRow(t, before.ID)
+	assert.Equal(t, consts.SagaStatusCompensated, row.Status)
+	assert.Equal(t, "charge_fee: timed out", row.LastError)
+	row = sagaRow(t, atPivot.ID)
+	assert.Equal(t, consts.SagaStatusRunning, row.Status)
+	assert.Equal(t, int32(2), row.Step)
+
+	// the pending payout still moves the saga forward
+	require.NoError(t, orchestrator.Execute(context.Background(), pending[0], false))
+	runSaga(t, orchestrator)
+	assert.Equal(t, consts.SagaStatusCompleted, sagaRow(t, atPivot.ID).Status)
+	assert.Equal(t, []string{"reserve", "reserve", "charge_fee", "undo reserve", "payout", "complete"}, recorder.calls)
+}
@@ -0,0 +1,374 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"ecom/global"
+	"ecom/internal/model"
+	"ecom/internal/repo"
+	"ecom/internal/service"
+	"ecom/internal/utils/interest"
+	"ecom/internal/vo"
+	consts "ecom/pkg/const"
+	"ecom/pkg/money"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTransactionDB points the core database at an in-memory SQLite holding the transactions table
+func openTransactionDB(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	require.NoError(t, db.Exec(`CREATE TABLE transactions (
+		id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(16)))),
+		details TEXT,
+		amount TEXT,
+		rate_usd REAL,
+		user_id TEXT,
+		date_created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		date_updated DATETIME,
+		transaction_type TEXT,
+		platform TEXT,
+		icon TEXT,
+		code TEXT,
+		status TEXT,
+		description TEXT,
+		currency TEXT
+	)`).Error)
+	global.Pdb = db
+}
+
+func TestCountTransactionsSinceCountsPendingWithdrawals(t *testing.T) {
+	openTransactionDB(t)
+	transactionRepository := repo.NewTransactionRepository()
+
+	monthStart := time.Date(2026, time.October, 1, 0, 0, 0, 0, time.UTC)
+	details, err := json.Marshal(map[string]string{"providerKey": "provider-1"})
+	require.NoError(t, err)
+	for i, row := range []struct {
+		transactionType string
+		status          string
+		userID          string
+		created         time.Time
+	}{
+		{consts.TransactionTypeWithdrawn, consts.TransactionStatusPending, "user-1", monthStart.Add(time.Hour)},
+		{consts.TransactionTypeWithdrawn, consts.TransactionStatusSuccess, "user-1", monthStart.Add(2 * time.Hour)},
+		{consts.TransactionTypeWithdrawn, consts.TransactionStatusFailed, "user-1", monthStart.Add(3 * time.Hour)},
+		{consts.TransactionTypeWithdrawn, consts.TransactionStatusSuccess, "user-1", monthStart.Add(-time.Hour)},
+		{consts.TransactionTypeWithdrawn, consts.TransactionStatusPending, "user-2", monthStart.Add(time.Hour)},
+		{consts.TransactionTypeDeposit, consts.TransactionStatusSuccess, "user-1", monthStart.Add(time.Hour)},
+	} {
+		require.NoError(t, transactionRepository.CreateTransaction(&model.Transaction{
+			Details:         details,
+			Amount:          money.NewFromFloat(10),
+			UserID:          row.userID,
+			DateCreated:     row.created,
+			DateUpdated:     row.created,
+			TransactionType: row.transactionType,
+			Code:            fmt.Sprintf("tx-%d", i),
+			Status:          row.status,
+			Currency:        "usdt",
+		}))
+	}
+
+	// a pending withdrawal uses up a free withdrawal like a successful one, a failed one does not
+	count, err := transactionRepository.CountTransactionsSince("user-1", "provider-1", consts.TransactionTypeWithdrawn, monthStart)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+}
+
+type fakeSettingService struct {
+	setting interest.InterestSetting
+}
+
+func (s *fakeSettingService) GetSettingByProviderKey(ctx context.Context, providerKey string) (*interest.InterestSetting, error) {
+	setting := s.setting
+	return &setting, nil
+}
+
+func (s *fakeSettingService) Invalidate(providerKey string) {}
+
+func (s *fakeSettingService) InvalidateAll() {}
+
+// fakeWalletRepository holds at most one wallet, a nil wallet is not found
+type fakeWalletRepository struct {
+	wallet *model.Wallet
+}
+
+func (r *fakeWalletRepository) WithTx(tx *gorm.DB) repo.IWalletRepository {
+	return r
+}
+
+func (r *fakeWalletRepository) LockWallet(userID string, providerKey string, currency string) error {
+	return nil
+}
+
+func (r *fakeWalletRepository) GetWallet(userID string, providerKey string, currency string) (model.Wallet, error) {
+	if r.wallet == nil {
+		return model.Wallet{}, gorm.ErrRecordNotFound
+	}
+	return *r.wallet, nil
+}
+
+func (r *fakeWalletRepository) GetWalletsByUser(userID string, providerKey string) ([]model.Wallet, error) {
+	return nil, nil
+}
+
+func (r *fakeWalletRepository) GetUserIDsByProviderKey(providerKey string) ([]string, error) {
+	return nil, nil
+}
+
+func (r *fakeWalletRepository) CreateWallet(wallet *model.Wallet) error {
+	wallet.ID = "wallet-1"
+	created := *wallet
+	r.wallet = &created
+	return nil
+}
+
+func (r *fakeWalletRepository) UpdateWallet(wallet *model.Wallet) error {
+	updated := *wallet
+	r.wallet = &updated
+	return nil
+}
+
+// fakeTransactionRepository records the created transactions, withdrawals is the count of the month
+type fakeTransactionRepository struct {
+	withdrawals int64
+	since       time.Time
+	existing    map[string]bool
+	created     []model.Transaction
+}
+
+func (r *fakeTransactionRepository) WithTx(tx *gorm.DB) repo.ITransactionRepository {
+	return r
+}
+
+func (r *fakeTransactionRepository) CreateTransaction(transaction *model.Transaction) error {
+	transaction.ID = fmt.Sprintf("tx-%d", len(r.created)+1)
+	r.created = append(r.created, *transaction)
+	return nil
+}
+
+func (r *fakeTransactionRepository) GetTransactionByCode(code string) (model.Transaction, error) {
+	if r.existing[code] {
+		return model.Transaction{Code: code}, nil
+	}
+	return model.Transaction{}, gorm.ErrRecordNotFound
+}
+
+func (r *fakeTransactionRepository) UpdateTransactionStatus(id string, status string, dateUpdated time.Time) error {
+	return nil
+}
+
+func (r *fakeTransactionRepository) CountTransactionsSince(userID string, providerKey string, transactionType string, since time.Time) (int64, error) {
+	r.since = since
+	return r.withdrawals, nil
+}
+
+type fakeOutboxRepository struct {
+	events []model.OutboxEvent
+}
+
+func (r *fakeOutboxRepository) WithTx(tx *gorm.DB) repo.IOutboxRepository {
+	return r
+}
+
+func (r *fakeOutboxRepository) CreateEvent(event *model.OutboxEvent) error {
+	r.events = append(r.events, *event)
+	return nil
+}
+
+func (r *fakeOutboxRepository) LockPendingEvents(limit int) ([]model.OutboxEvent, error) {
+	return nil, nil
+}
+
+func (r *fakeOutboxRepository) MarkEventSent(id string, sentAt time.Time) error {
+	return nil
+}
+
+func (r *fakeOutboxRepository) MarkEventFailed(id string, lastError string, availableAt time.Time) error {
+	return nil
+}
+
+// feeSetting locks deposits for a day, charges 2% inside the lock time and a withdrawal fee of 1 + 1%
+// after 2 free withdrawals of up to 100 a month
+func feeSetting(feeIn bool) interest.InterestSetting {
+	currencies := []model.Currency{{Slug: "usdt"}, {Slug: "eur"}}
+	return interest.InterestSetting{
+		DepositLockTime:            86400,
+		UrgentWithdrawalFeePercent: 2,
+		FreeWithdrawalsCount:       2,
+		FreeWithdrawalLimit:        100,
+		FeeSetting: []interest.FeeSettingItem{{
+			TransactionType: model.TransactionType{Slug: consts.TransactionTypeWithdrawn},
+			FeeFixed:        1,
+			FeePercent:      1,
+			FeeIn:           feeIn,
+		}},
+		Deposit:   interest.Deposit{CurrencySupportDeposit: currencies, MinDeposit: 1},
+		Withdrawn: interest.Withdrawn{CurrencySupportInput: currencies, CurrencySupportOutput: currencies},
+	}
+}
+
+func TestReserveWithdrawAppliesTheFeeRules(t *testing.T) {
+	rates := consts.CurrencyRates{"usdt": {USD: 1}, "eur": {USD: 1.2}}
+	unlocked := time.Now().Add(-48 * time.Hour).Unix()
+	locked := time.Now().Add(-time.Hour).Unix()
+	for _, tc := range []struct {
+		name        string
+		amount      string
+		toCurrency  string
+		feeIn       bool
+		withdrawals int64
+		timeDeposit int64
+		err         error
+		// expected fee breakdown, debit from the balance and amount received in toCurrency
+		urgentFee     string
+		withdrawalFee string
+		chargedFee    string
+		netAmount     string
+		receiveAmount string
+	}{
+		{name: "free withdrawal", amount: "50", withdrawals: 1, timeDeposit: unlocked,
+			urgentFee: "0", withdrawalFee: "0", chargedFee: "0", netAmount: "50", receiveAmount: "50"},
+		{name: "free withdrawals of the month used up", amount: "50", withdrawals: 2, timeDeposit: unlocked,
+			urgentFee: "0", withdrawalFee: "1.5", chargedFee: "1.5", netAmount: "50", receiveAmount: "50"},
+		{name: "above the free withdrawal limit", amount: "150", timeDeposit: unlocked,
+			urgentFee: "0", withdrawalFee: "2.5", chargedFee: "2.5", netAmount: "150", receiveAmount: "150"},
+		{name: "fee taken from the amount", amount: "50", feeIn: true, withdrawals: 2, timeDeposit: unlocked,
+			urgentFee: "0", withdrawalFee: "1.5", chargedFee: "0", netAmount: "48.5", receiveAmount: "48.5"},
+		{name: "urgent fee inside the lock time", amount: "50", timeDeposit: locked,
+			urgentFee: "1", withdrawalFee: "0", chargedFee: "0", netAmount: "49", receiveAmount: "49"},
+		{name: "urgent fee rounded half up", amount: "10.000025", timeDeposit: locked,
+			urgentFee: "0.200001", withdrawalFee: "0", chargedFee: "0", netAmount: "9.800024", receiveAmount: "9.800024"},
+		{name: "converted amount rounded down", amount: "50", toCurrency: "eur", timeDeposit: unlocked,
+			urgentFee: "0", withdrawalFee: "0", chargedFee: "0", netAmount: "50", receiveAmount: "41.66"},
+		{name: "fee above the amount", amount: "1", feeIn: true, withdrawals: 2, timeDeposit: unlocked,
+			err: service.ErrAmountNotCoverFee},
+		{name: "balance not covering the fee on top", amount: "1000", withdrawals: 2, timeDeposit: unlocked,
+			err: service.ErrInsufficientBalance},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			walletRepository := &fakeWalletRepository{wallet: &model.Wallet{
+				ID:          "wallet-1",
+				Balance:     money.MustParse("1000"),
+				TimeDeposit: strconv.FormatInt(tc.timeDeposit, 10),
+				Currency:    "usdt",
+			}}
+			transactionRepository := &fakeTransactionRepository{withdrawals: tc.withdrawals}
+			withdrawService := service.NewWithdrawService(walletRepository, transactionRepository, &fakeOutboxRepository{},
+				&fakeSettingService{setting: feeSetting(tc.feeIn)})
+
+			reservation, transaction, err := withdrawService.ReserveWithdraw(context.Background(), nil, &vo.WithdrawRequest{
+				UserID:          "user-1",
+				Currency:        "usdt",
+				Amount:          money.MustParse(tc.amount),
+				ProviderKey:     "provider-1",
+				TransactionCode: "code-1",
+				RateCurrency:    rates,
+				ToCurrency:      tc.toCurrency,
+			})
+			// the free withdrawals are counted from the start of the month in UTC
+			now := time.Now().UTC()
+			assert.Equal(t, time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC), transactionRepository.since)
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+				assert.Equal(t, "1000", walletRepository.wallet.Balance.String())
+				assert.Empty(t, transactionRepository.created)
+				return
+			}
+			require.NoError(t, err)
+
+			var details struct {
+				DebitAmount   money.Amount `json:"debitAmount"`
+				NetAmount     money.Amount `json:"netAmount"`
+				ReceiveAmount money.Amount `json:"receiveAmount"`
+				Fee           struct {
+					IsLocked         bool         `json:"isLocked"`
+					IsFreeWithdrawal bool         `json:"isFreeWithdrawal"`
+					UrgentFee        money.Amount `json:"urgentFee"`
+					WithdrawalFee    money.Amount `json:"withdrawalFee"`
+				} `json:"fee"`
+			}
+			require.NoError(t, json.Unmarshal(transaction.Details, &details))
+			assert.Equal(t, tc.timeDeposit == locked, details.Fee.IsLocked)
+			assert.Equal(t, tc.withdrawalFee == "0", details.Fee.IsFreeWithdrawal)
+			assert.Equal(t, tc.urgentFee, details.Fee.UrgentFee.String())
+			assert.Equal(t, tc.withdrawalFee, details.Fee.WithdrawalFee.String())
+			assert.Equal(t, tc.netAmount, details.NetAmount.String())
+			assert.Equal(t, tc.receiveAmount, details.ReceiveAmount.String())
+			assert.Equal(t, tc.chargedFee, reservation.ChargedFee.String())
+
+			// the amount is reserved now, a fee charged on top is debited by the next saga step
+			debit := money.MustParse(tc.amount).Add(money.MustParse(tc.chargedFee))
+			assert.Equal(t, debit.String(), details.DebitAmount.String())
+			assert.Equal(t, debit.String(), transaction.Amount.String())
+			assert.Equal(t, tc.amount, reservation.ReservedAmount.String())
+			assert.Equal(t, money.MustParse("1000").Sub(money.MustParse(tc.amount)).String(), walletRepository.wallet.Balance.String())
+			assert.Equal(t, consts.TransactionStatusPending, transaction.Status)
+		})
+	}
+}
+
+func TestDepositCreditsTheWallet(t *testing.T) {
+	openTransactionDB(t)
+	for _, tc := range []struct {
+		name     string
+		amount   string
+		currency string
+		wallet   *model.Wallet
+		existing bool
+		err      error
+		balance  string
+	}{
+		{name: "new wallet", amount: "10.5", currency: "usdt", balance: "10.5"},
+		{name: "existing wallet", amount: "5.25", currency: "USDT", wallet: &model.Wallet{ID: "wallet-1", Balance: money.MustParse("10"), Currency: "usdt"}, balance: "15.25"},
+		{name: "zero amount", amount: "0", currency: "usdt", err: service.ErrInvalidAmount},
+		{name: "more decimals than the currency", amount: "1.0000001", currency: "usdt", err: service.ErrAmountPrecision},
+		{name: "below the minimum deposit", amount: "0.5", currency: "usdt", err: service.ErrAmountBelowMinDeposit},
+		{name: "unsupported currency", amount: "10", currency: "btc", err: service.ErrCurrencyNotSupported},
+		{name: "duplicate transaction code", amount: "10", currency: "usdt", existing: true, err: service.ErrDuplicateTransaction},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			walletRepository := &fakeWalletRepository{wallet: tc.wallet}
+			transactionRepository := &fakeTransactionRepository{existing: map[string]bool{"code-1": tc.existing}}
+			outboxRepository := &fakeOutboxRepository{}
+			depositService := service.NewDepositService(nil, walletRepository, transactionRepository, outboxRepository,
+				&fakeSettingService{setting: feeSetting(false)})
+
+			transaction, err := depositService.Deposit(context.Background(), &vo.DepositRequest{
+				UserID:          "user-1",
+				Currency:        tc.currency,
+				Amount:          money.MustParse(tc.amount),
+				ProviderKey:     "provider-1",
+				TransactionCode: "code-1",
+			})
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+				assert.Empty(t, transactionRepository.created)
+				assert.Empty(t, outboxRepository.events)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.balance, walletRepository.wallet.Balance.String())
+			assert.Equal(t, "usdt", walletRepository.wallet.Currency)
+			assert.Equal(t, tc.amount, transaction.Amount.String())
+			assert.Equal(t, consts.TransactionStatusSuccess, transaction.Status)
+			require.Len(t, outboxRepository.events, 1)
+			assert.Equal(t, consts.WalletEventDeposited, outboxRepository.events[0].RoutingKey)
+		})
+	}
+}